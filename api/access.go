@@ -0,0 +1,209 @@
+package api
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/kun/log"
+)
+
+// accessLog the access log settings, the request id is set even if the access log is disabled
+var accessLog = AccessLog{}
+var accessLogLock sync.RWMutex
+
+// accessWriteLock the lines are written one by one
+var accessWriteLock sync.Mutex
+
+// AccessLog the access log settings of the api routes
+type AccessLog struct {
+	Writer  io.Writer // the writer of the JSON lines, the access log is disabled if nil
+	Header  string    // the header of the request id, the default is X-Request-Id
+	Sample  float64   // the sample rate from 0 to 1, the default is 1. the 5xx responses are always logged
+	Headers []string  // the request headers to log, * logs all the headers
+	Redact  []string  // the headers to redact, the default is Authorization, Cookie and Proxy-Authorization
+}
+
+// AccessEntry a line of the access log
+type AccessEntry struct {
+	Time      string            `json:"time"`
+	RequestID string            `json:"request_id"`
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	URI       string            `json:"uri"`
+	Status    int               `json:"status"`
+	Latency   float64           `json:"latency"` // milliseconds
+	Bytes     int               `json:"bytes"`
+	IP        string            `json:"ip"`
+	User      interface{}       `json:"user,omitempty"` // the guard identity
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+// SetAccessLog set the access log of the api routes
+func SetAccessLog(option AccessLog) {
+	if option.Header == "" {
+		option.Header = "X-Request-Id"
+	}
+
+	if option.Sample <= 0 || option.Sample > 1 {
+		option.Sample = 1
+	}
+
+	if option.Redact == nil {
+		option.Redact = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+	}
+
+	accessLogLock.Lock()
+	accessLog = option
+	accessLogLock.Unlock()
+}
+
+// requestHandler set the request id and write the access log after the handlers
+func requestHandler(c *gin.Context) {
+	accessLogLock.RLock()
+	option := accessLog
+	accessLogLock.RUnlock()
+
+	header := option.Header
+	if header == "" {
+		header = "X-Request-Id"
+	}
+
+	id := c.GetHeader(header)
+	if !validRequestID(id) {
+		id = uuid.NewString()
+	}
+	c.Set("__request_id", id)
+	c.Writer.Header().Set(header, id)
+
+	if option.Writer == nil {
+		return
+	}
+
+	start := time.Now()
+	defer func() {
+		// the panics are responded by the recovery, logged as 500
+		if recovered := recover(); recovered != nil {
+			option.write(c, id, start, 500)
+			panic(recovered)
+		}
+	}()
+
+	c.Next()
+	option.write(c, id, start, c.Writer.Status())
+}
+
+// write the access log line, the line is sampled by the sample rate
+func (option AccessLog) write(c *gin.Context, id string, start time.Time, status int) {
+	if status < 500 && option.Sample < 1 && rand.Float64() >= option.Sample {
+		return
+	}
+
+	entry := AccessEntry{
+		Time:      start.Format(time.RFC3339Nano),
+		RequestID: id,
+		Method:    c.Request.Method,
+		Path:      c.FullPath(),
+		URI:       c.Request.URL.Path,
+		Status:    status,
+		Latency:   float64(time.Since(start).Microseconds()) / 1000,
+		Bytes:     c.Writer.Size(),
+		IP:        c.ClientIP(),
+		Headers:   option.headers(c.Request.Header),
+	}
+
+	if entry.Bytes < 0 {
+		entry.Bytes = 0
+	}
+
+	if user, has := c.Get("__user_id"); has {
+		entry.User = user
+	}
+
+	data, err := jsoniter.Marshal(entry)
+	if err != nil {
+		log.Error("[API] access log: %s", err.Error())
+		return
+	}
+
+	accessWriteLock.Lock()
+	defer accessWriteLock.Unlock()
+	_, err = option.Writer.Write(append(data, '\n'))
+	if err != nil {
+		log.Error("[API] access log: %s", err.Error())
+	}
+}
+
+// headers the request headers to log, the redacted headers are replaced
+func (option AccessLog) headers(header http.Header) map[string]string {
+	if len(option.Headers) == 0 {
+		return nil
+	}
+
+	names := option.Headers
+	for _, name := range option.Headers {
+		if name == "*" {
+			names = []string{}
+			for name := range header {
+				names = append(names, name)
+			}
+			break
+		}
+	}
+
+	values := map[string]string{}
+	for _, name := range names {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+
+		for _, redact := range option.Redact {
+			if strings.EqualFold(redact, name) {
+				value = "[REDACTED]"
+				break
+			}
+		}
+		values[http.CanonicalHeaderKey(name)] = value
+	}
+	return values
+}
+
+// globalOf the global data of the process with the request id, nil if both are not set
+func globalOf(c *gin.Context) map[string]interface{} {
+	var global map[string]interface{}
+	if v, has := c.Get("__global"); has {
+		global, _ = v.(map[string]interface{})
+	}
+
+	id := c.GetString("__request_id")
+	if id == "" {
+		return global
+	}
+
+	data := map[string]interface{}{"__request_id": id}
+	for key, value := range global {
+		data[key] = value
+	}
+	return data
+}
+
+// validRequestID the request id from the header should be short and printable
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/kun/exception"
+)
+
+func TestAccessLog(t *testing.T) {
+	router := prepareAccess(t)
+	defer delete(APIs, "unit.access")
+	defer SetAccessLog(AccessLog{})
+
+	buffer := &bytes.Buffer{}
+	SetAccessLog(AccessLog{Writer: buffer, Headers: []string{"Authorization", "User-Agent"}})
+
+	request := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		return response
+	}
+
+	entries := func() []AccessEntry {
+		res := []AccessEntry{}
+		for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+			entry := AccessEntry{}
+			err := jsoniter.UnmarshalFromString(line, &entry)
+			assert.Nil(t, err)
+			res = append(res, entry)
+		}
+		buffer.Reset()
+		return res
+	}
+
+	// the request id from the header
+	res := request("/api/unit/access/pets/1", map[string]string{"X-Request-Id": "unit-request-1", "Authorization": "Bearer secret", "User-Agent": "unit"})
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "unit-request-1", res.Header().Get("X-Request-Id"))
+	assert.Equal(t, `"unit-request-1"`, res.Body.String())
+
+	lines := entries()
+	assert.Len(t, lines, 1)
+	assert.Equal(t, "unit-request-1", lines[0].RequestID)
+	assert.Equal(t, "GET", lines[0].Method)
+	assert.Equal(t, "/api/unit/access/pets/:id", lines[0].Path)
+	assert.Equal(t, "/api/unit/access/pets/1", lines[0].URI)
+	assert.Equal(t, 200, lines[0].Status)
+	assert.Equal(t, len(res.Body.String()), lines[0].Bytes)
+	assert.Equal(t, "[REDACTED]", lines[0].Headers["Authorization"])
+	assert.Equal(t, "unit", lines[0].Headers["User-Agent"])
+	assert.Nil(t, lines[0].User)
+
+	// the generated request id
+	res = request("/api/unit/access/pets/1", nil)
+	id := res.Header().Get("X-Request-Id")
+	assert.Len(t, id, 36)
+	assert.Equal(t, `"`+id+`"`, res.Body.String())
+	assert.Equal(t, id, entries()[0].RequestID)
+
+	// the user id from the guard
+	res = request("/api/unit/access/me", nil)
+	assert.Equal(t, 200, res.Code)
+	lines = entries()
+	assert.Len(t, lines, 1)
+	assert.Equal(t, float64(42), lines[0].User)
+
+	// the sampling, the errors are always logged
+	SetAccessLog(AccessLog{Writer: buffer, Header: "X-Trace-Id", Sample: 0.000001})
+	for i := 0; i < 10; i++ {
+		request("/api/unit/access/pets/1", nil)
+	}
+	assert.Empty(t, buffer.String())
+
+	res = request("/api/unit/access/error", map[string]string{"X-Trace-Id": "unit-trace-1"})
+	assert.Equal(t, 500, res.Code)
+	assert.Equal(t, "unit-trace-1", res.Header().Get("X-Trace-Id"))
+	lines = entries()
+	assert.Len(t, lines, 1)
+	assert.Equal(t, 500, lines[0].Status)
+	assert.Nil(t, lines[0].Headers)
+}
+
+func prepareAccess(t *testing.T) *gin.Engine {
+	process.Register("unit.api.requestid", func(process *process.Process) interface{} {
+		return process.Global["__request_id"]
+	})
+
+	process.Register("unit.api.guard.access", func(process *process.Process) interface{} {
+		return map[string]interface{}{"__user_id": 42}
+	})
+
+	process.Register("unit.api.error", func(process *process.Process) interface{} {
+		exception.New("unit error", 500).Throw()
+		return nil
+	})
+
+	source := `{
+		"name": "access", "version": "1.0.0", "guard": "-",
+		"paths": [
+			{"path": "/pets/:id", "method": "GET", "process": "unit.api.requestid", "out": {"status": 200, "type": "application/json"}},
+			{"path": "/error", "method": "GET", "process": "unit.api.error", "out": {"status": 200, "type": "application/json"}},
+			{"path": "/me", "method": "GET", "process": "unit.api.requestid", "guard": "unit.api.guard.access", "out": {"status": 200, "type": "application/json"}}
+		]
+	}`
+
+	api, err := LoadSource("<unit.access>.http.json", []byte(source), "unit.access")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	api.HTTP.Routes(router, "/api")
+	return router
+}
@@ -3,12 +3,15 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/yaoapp/kun/log"
 
 	"github.com/gin-gonic/gin"
 	"github.com/yaoapp/gou/application"
+	"github.com/yaoapp/gou/store"
 	"github.com/yaoapp/kun/exception"
 	"github.com/yaoapp/xun"
 )
@@ -16,6 +19,13 @@ import (
 // APIs 已加载API列表
 var APIs = map[string]*API{}
 
+// apisLock the apis are loaded and unloaded while the routes are rebuilt
+var apisLock sync.RWMutex
+
+// defaultStore the in-memory store of the rate limit counters and the response cache
+var defaultStore store.Store
+var defaultStoreOnce sync.Once
+
 // Load load the api
 func Load(file, id string, guard ...string) (*API, error) {
 
@@ -43,8 +53,37 @@ func LoadSource(file string, data []byte, id string, guard ...string) (*API, err
 	}
 
 	// Validate API
+	if err := http.validate(); err != nil {
+		log.Error("[API] Load %s Error: %s", id, err.Error())
+		return nil, fmt.Errorf("[API] Load %s Error: %s", id, err.Error())
+	}
+
+	if http.Limit != nil {
+		if err := http.Limit.validate(); err != nil {
+			log.Error("[API] Load %s Error: %s", id, err.Error())
+			return nil, fmt.Errorf("[API] Load %s Error: %s", id, err.Error())
+		}
+	}
+
 	uniquePathCheck := map[string]bool{}
 	for _, path := range http.Paths {
+		if path.Limit != nil {
+			if err := path.Limit.validate(); err != nil {
+				log.Error("[API] Load %s %s Error: %s", id, path.Path, err.Error())
+				return nil, fmt.Errorf("[API] Load %s %s Error: %s", id, path.Path, err.Error())
+			}
+		}
+
+		if err := path.validate(); err != nil {
+			log.Error("[API] Load %s %s Error: %s", id, path.Path, err.Error())
+			return nil, fmt.Errorf("[API] Load %s %s Error: %s", id, path.Path, err.Error())
+		}
+
+		if path.Out.Type == "websocket" && strings.ToUpper(path.Method) != "GET" {
+			log.Error("[API] Load %s %s Error: the method of the websocket should be GET", id, path.Path)
+			return nil, fmt.Errorf("[API] Load %s %s Error: the method of the websocket should be GET", id, path.Path)
+		}
+
 		unique := fmt.Sprintf("%s.%s", path.Method, path.Path)
 		if _, has := uniquePathCheck[unique]; has {
 			log.Error("[API] Load %s is already registered", id)
@@ -53,35 +92,91 @@ func LoadSource(file string, data []byte, id string, guard ...string) (*API, err
 		uniquePathCheck[unique] = true
 	}
 
+	http.id = id
+
 	// Default Guard
 	if http.Guard == "" && len(guard) > 0 {
 		http.Guard = guard[0]
 	}
 
-	APIs[id] = &API{
+	api := &API{
 		ID:   id,
 		File: file,
 		HTTP: http,
 		Type: "http",
 	}
 
-	return APIs[id], nil
+	apisLock.Lock()
+	APIs[id] = api
+	apisLock.Unlock()
+	return api, nil
 }
 
 // Select select api
 func Select(id string) *API {
+	apisLock.RLock()
 	api, has := APIs[id]
+	apisLock.RUnlock()
 	if !has {
 		exception.New("[API] %s not loaded", 500, id).Throw()
 	}
 	return api
 }
 
+// loaded the loaded apis in the order of the ids
+func loaded() []*API {
+	apisLock.RLock()
+	defer apisLock.RUnlock()
+	ids := make([]string, 0, len(APIs))
+	for id := range APIs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	apis := make([]*API, 0, len(ids))
+	for _, id := range ids {
+		apis = append(apis, APIs[id])
+	}
+	return apis
+}
+
+// storeOf get the store by the name, the in-memory store if the name is empty
+func storeOf(name string) (store.Store, error) {
+	if name != "" {
+		stor, has := store.Pools[name]
+		if !has {
+			return nil, fmt.Errorf("the store %s does not load", name)
+		}
+		return stor, nil
+	}
+
+	var err error
+	defaultStoreOnce.Do(func() { defaultStore, err = store.New(nil, nil) })
+	if err != nil {
+		return nil, err
+	}
+
+	if defaultStore == nil {
+		return nil, fmt.Errorf("the default store is not available")
+	}
+	return defaultStore, nil
+}
+
 // SetRoutes set the api routes
 func SetRoutes(router *gin.Engine, path string, allows ...string) {
 
 	// Error handler
-	router.Use(gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+	router.Use(recovery())
+
+	// Load apis
+	for _, api := range loaded() {
+		api.HTTP.Routes(router, path, allows...)
+	}
+}
+
+// recovery responses the panics of the handlers as the JSON error
+func recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
 
 		var code = http.StatusInternalServerError
 
@@ -110,12 +205,7 @@ func SetRoutes(router *gin.Engine, path string, allows ...string) {
 		}
 
 		c.AbortWithStatus(code)
-	}))
-
-	// Load apis
-	for _, api := range APIs {
-		api.HTTP.Routes(router, path, allows...)
-	}
+	})
 }
 
 // SetGuards set guards
@@ -128,7 +218,20 @@ func AddGuard(name string, guard gin.HandlerFunc) {
 	HTTPGuards[name] = guard
 }
 
-// Reload API
+// Reload API, the dynamic routers are rebuilt with the reloaded api
 func (api *API) Reload() (*API, error) {
-	return Load(api.File, api.ID)
+	reloaded, err := Load(api.File, api.ID)
+	if err != nil {
+		return nil, err
+	}
+	rebuild()
+	return reloaded, nil
+}
+
+// Unload remove the api, the dynamic routers are rebuilt without the api
+func Unload(id string) {
+	apisLock.Lock()
+	delete(APIs, id)
+	apisLock.Unlock()
+	rebuild()
 }
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/helper"
+	"github.com/yaoapp/kun/log"
+)
+
+// cachePrefix the key prefix of the cached responses
+const cachePrefix = "api.cache:"
+
+// cacheEntry the cached response
+type cacheEntry struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    []byte            `json:"body"`
+	ETag    string            `json:"etag"`
+}
+
+// bufferWriter buffers the response to generate the ETag and to cache the response
+type bufferWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// Purge remove the cached responses of the key prefix from the stores of the loaded apis, returns the number of removed responses
+func Purge(prefix string) (int, error) {
+	names := map[string]bool{"": true}
+	for _, api := range loaded() {
+		for _, path := range api.HTTP.Paths {
+			if path.Out.Cache != nil {
+				names[path.Out.Cache.Store] = true
+			}
+		}
+	}
+
+	count := 0
+	for name := range names {
+		stor, err := storeOf(name)
+		if err != nil {
+			return count, err
+		}
+
+		keys := []string{}
+		for _, key := range stor.Keys() {
+			if strings.HasPrefix(key, cachePrefix+prefix) {
+				keys = append(keys, key)
+			}
+		}
+		stor.DelMulti(keys)
+		count = count + len(keys)
+	}
+	return count, nil
+}
+
+// cacheKey the cache key of the request, the key template is bound with $in.N, $param.name and $query.name.
+// the default key is the path and the inputs of the session, the responses of the guarded users are not shared
+func (path Path) cacheKey(c *gin.Context, args []interface{}) string {
+	cache := path.Out.Cache
+	key := ""
+	if cache.Key != "" {
+		data := map[string]interface{}{}
+		for i, arg := range args {
+			data[fmt.Sprintf("$in.%d", i)] = cacheValue(arg)
+		}
+
+		for _, param := range c.Params {
+			data[fmt.Sprintf("$param.%s", param.Key)] = param.Value
+		}
+
+		for name, values := range c.Request.URL.Query() {
+			if len(values) > 0 {
+				data[fmt.Sprintf("$query.%s", name)] = values[0]
+			}
+		}
+		key = fmt.Sprintf("%v", helper.Bind(cache.Key, data))
+
+	} else {
+		values := []string{}
+		for _, arg := range args {
+			values = append(values, cacheValue(arg))
+		}
+
+		// the global data without the request id, the request id makes every key unique
+		global := map[string]interface{}{}
+		if v, has := c.Get("__global"); has {
+			data, _ := v.(map[string]interface{})
+			for name, value := range data {
+				if name != "__request_id" {
+					global[name] = value
+				}
+			}
+		}
+		user, _ := c.Get("__user_id")
+		values = append(values, c.GetString("__sid"), cacheValue(global), cacheValue(user))
+		key = fmt.Sprintf("%s:%x", c.FullPath(), sha1.Sum([]byte(strings.Join(values, "\n"))))
+	}
+
+	for _, name := range cache.Vary {
+		key = fmt.Sprintf("%s|%s=%s", key, strings.ToLower(name), c.GetHeader(name))
+	}
+	return cachePrefix + key
+}
+
+// cached write the cached response, returns false if the response is not cached
+func (path Path) cached(c *gin.Context, key string) bool {
+	stor, err := storeOf(path.Out.Cache.Store)
+	if err != nil {
+		log.Error("[API] %s cache: %s", path.Path, err.Error())
+		return false
+	}
+
+	value, has := stor.Get(key)
+	if !has {
+		return false
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return false
+	}
+
+	entry := cacheEntry{}
+	err = jsoniter.UnmarshalFromString(text, &entry)
+	if err != nil {
+		return false
+	}
+
+	for name, value := range entry.Headers {
+		c.Writer.Header().Set(name, value)
+	}
+	c.Writer.Header().Set("ETag", entry.ETag)
+	c.Writer.Header().Set("X-Cache", "HIT")
+	path.setVary(c)
+
+	if matchETag(c.GetHeader("If-None-Match"), entry.ETag) {
+		c.Status(304)
+		c.Writer.WriteHeaderNow()
+		return true
+	}
+
+	c.Data(entry.Status, entry.Headers["Content-Type"], entry.Body)
+	return true
+}
+
+// buffer the response of the handler, call flush to write the response
+func (path Path) buffer(c *gin.Context) *bufferWriter {
+	writer := &bufferWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	return writer
+}
+
+// flush write the buffered response with the ETag, responses 304 if the ETag matched, the response is cached if the key is given
+func (path Path) flush(c *gin.Context, writer *bufferWriter, key string) {
+	c.Writer = writer.ResponseWriter
+	status := writer.status
+	if status == 0 {
+		status = 200
+	}
+
+	body := writer.body.Bytes()
+	if status != 200 {
+		c.Writer.WriteHeader(status)
+		c.Writer.Write(body)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum(body))
+	c.Writer.Header().Set("ETag", etag)
+	if key != "" {
+		c.Writer.Header().Set("X-Cache", "MISS")
+		path.setVary(c)
+		path.save(c, key, cacheEntry{Status: status, Body: body, ETag: etag})
+	}
+
+	if matchETag(c.GetHeader("If-None-Match"), etag) {
+		c.Writer.WriteHeader(304)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+
+	c.Writer.WriteHeader(status)
+	c.Writer.Write(body)
+}
+
+// save the response to the cache
+func (path Path) save(c *gin.Context, key string, entry cacheEntry) {
+	entry.Headers = map[string]string{}
+	if contentType := c.Writer.Header().Get("Content-Type"); contentType != "" {
+		entry.Headers["Content-Type"] = contentType
+	}
+
+	for name := range path.Out.Headers {
+		if value := c.Writer.Header().Get(name); value != "" {
+			entry.Headers[name] = value
+		}
+	}
+
+	stor, err := storeOf(path.Out.Cache.Store)
+	if err != nil {
+		log.Error("[API] %s cache: %s", path.Path, err.Error())
+		return
+	}
+
+	data, err := jsoniter.MarshalToString(entry)
+	if err != nil {
+		log.Error("[API] %s cache: %s", path.Path, err.Error())
+		return
+	}
+
+	err = stor.Set(key, data, time.Duration(path.Out.Cache.TTL)*time.Second)
+	if err != nil {
+		log.Error("[API] %s cache: %s", path.Path, err.Error())
+	}
+}
+
+// setVary set the Vary header
+func (path Path) setVary(c *gin.Context) {
+	if len(path.Out.Cache.Vary) > 0 {
+		c.Writer.Header().Set("Vary", strings.Join(path.Out.Cache.Vary, ", "))
+	}
+}
+
+// WriteHeader buffer the status code
+func (writer *bufferWriter) WriteHeader(code int) {
+	writer.status = code
+}
+
+// WriteHeaderNow the header is written by flush
+func (writer *bufferWriter) WriteHeaderNow() {}
+
+// Write buffer the data
+func (writer *bufferWriter) Write(data []byte) (int, error) {
+	return writer.body.Write(data)
+}
+
+// WriteString buffer the string
+func (writer *bufferWriter) WriteString(s string) (int, error) {
+	return writer.body.WriteString(s)
+}
+
+// Status the buffered status code
+func (writer *bufferWriter) Status() int {
+	if writer.status == 0 {
+		return 200
+	}
+	return writer.status
+}
+
+// Size the size of the buffered body
+func (writer *bufferWriter) Size() int {
+	return writer.body.Len()
+}
+
+// Written the response is not written until flush
+func (writer *bufferWriter) Written() bool {
+	return false
+}
+
+// matchETag check the If-None-Match header
+func matchETag(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	for _, value := range strings.Split(header, ",") {
+		value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+		if value == "*" || value == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheValue the value as string in the cache key
+func cacheValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case *gin.Context:
+		return v.Request.URL.RequestURI()
+	}
+
+	data, err := jsoniter.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/process"
+)
+
+func TestCache(t *testing.T) {
+	var calls int64
+	router := prepareCache(t, &calls)
+	defer delete(APIs, "unit.cache")
+	defer Purge("")
+
+	request := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		return response
+	}
+
+	res := request("/api/unit/cache/pets/1", map[string]string{"Accept-Language": "en"})
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "MISS", res.Header().Get("X-Cache"))
+	assert.Equal(t, "Accept-Language", res.Header().Get("Vary"))
+	assert.Equal(t, "1", res.Header().Get("X-Pet"))
+	etag := res.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	body := res.Body.String()
+
+	// the cached response
+	res = request("/api/unit/cache/pets/1", map[string]string{"Accept-Language": "en"})
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "HIT", res.Header().Get("X-Cache"))
+	assert.Equal(t, "1", res.Header().Get("X-Pet"))
+	assert.Equal(t, body, res.Body.String())
+	assert.Equal(t, etag, res.Header().Get("ETag"))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&calls))
+
+	// the conditional request
+	res = request("/api/unit/cache/pets/1", map[string]string{"Accept-Language": "en", "If-None-Match": etag})
+	assert.Equal(t, 304, res.Code)
+	assert.Empty(t, res.Body.String())
+
+	// the vary headers and the other keys
+	request("/api/unit/cache/pets/1", map[string]string{"Accept-Language": "fr"})
+	request("/api/unit/cache/pets/2", nil)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&calls))
+
+	// the purge
+	count, err := process.New("api.Purge", "pets:1").Exec()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	res = request("/api/unit/cache/pets/1", map[string]string{"Accept-Language": "en"})
+	assert.Equal(t, "MISS", res.Header().Get("X-Cache"))
+	assert.Equal(t, int64(4), atomic.LoadInt64(&calls))
+
+	// the ETag of the uncached path
+	res = request("/api/unit/cache/etag", nil)
+	assert.Equal(t, 200, res.Code)
+	etag = res.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Empty(t, res.Header().Get("X-Cache"))
+
+	res = request("/api/unit/cache/etag", map[string]string{"If-None-Match": "W/" + etag})
+	assert.Equal(t, 304, res.Code)
+
+	// the default key of the guarded path is separated by the users
+	atomic.StoreInt64(&calls, 0)
+	assert.Equal(t, "MISS", request("/api/unit/cache/me", map[string]string{"X-User": "alice"}).Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", request("/api/unit/cache/me", map[string]string{"X-User": "alice"}).Header().Get("X-Cache"))
+	assert.Equal(t, "MISS", request("/api/unit/cache/me", map[string]string{"X-User": "bob"}).Header().Get("X-Cache"))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&calls))
+}
+
+func prepareCache(t *testing.T, calls *int64) *gin.Engine {
+	process.Register("unit.api.pet", func(process *process.Process) interface{} {
+		atomic.AddInt64(calls, 1)
+		return map[string]interface{}{"id": process.ArgsString(0), "lang": process.ArgsString(1)}
+	})
+
+	process.Register("unit.api.guard.cache", func(process *process.Process) interface{} {
+		headers, _ := process.Args[4].(http.Header)
+		return map[string]interface{}{"__user_id": headers.Get("X-User")}
+	})
+
+	source := `{
+		"name": "cache", "version": "1.0.0", "guard": "-",
+		"paths": [
+			{
+				"path": "/pets/:id", "method": "GET", "process": "unit.api.pet", "in": ["$param.id", "$header.Accept-Language"],
+				"out": {
+					"status": 200, "type": "application/json", "headers": {"X-Pet": "{{id}}"},
+					"cache": {"ttl": 60, "key": "pets:{{ $param.id }}", "vary": ["Accept-Language"]}
+				}
+			},
+			{ "path": "/etag", "method": "GET", "process": "unit.api.pet", "in": ["etag"], "out": {"status": 200, "type": "application/json"} },
+			{
+				"path": "/me", "method": "GET", "process": "unit.api.pet", "in": ["me"], "guard": "unit.api.guard.cache",
+				"out": {"status": 200, "type": "application/json", "cache": {"ttl": 60}}
+			}
+		]
+	}`
+
+	api, err := LoadSource("<unit.cache>.http.json", []byte(source), "unit.cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	api.HTTP.Routes(router, "/api")
+	return router
+}
+
+func TestCacheKeyGlobal(t *testing.T) {
+	path := Path{Path: "/cached", Out: Out{Cache: &Cache{}}}
+	keyOf := func(global map[string]interface{}) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/cached", nil)
+		c.Set("__global", global)
+		return path.cacheKey(c, []interface{}{"arg"})
+	}
+
+	// the request id is not a part of the key
+	key := keyOf(map[string]interface{}{"tenant": "a", "__request_id": "1"})
+	assert.Equal(t, key, keyOf(map[string]interface{}{"tenant": "a", "__request_id": "2"}))
+	assert.NotEqual(t, key, keyOf(map[string]interface{}{"tenant": "b", "__request_id": "1"}))
+}
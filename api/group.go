@@ -0,0 +1,368 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// versionRoutes the routes negotiated with the Accept-Version header, the engine|method|path => route
+var versionRoutes = map[string]*versionRoute{}
+var versionRoutesLock sync.RWMutex
+
+// versionRoute the handlers of the versions of a route
+type versionRoute struct {
+	versions map[string][]gin.HandlerFunc
+	latest   string
+}
+
+// validate the group settings
+func (http HTTP) validate() error {
+	switch http.Versioning {
+	case "", "path", "header":
+	default:
+		return fmt.Errorf("the versioning %s is invalid, should be path or header", http.Versioning)
+	}
+
+	if http.Versioning != "" && versionOf(http.Version) == "" {
+		return fmt.Errorf("the version is required by the versioning %s", http.Versioning)
+	}
+
+	if http.Timeout != "" {
+		timeout, err := time.ParseDuration(http.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("the timeout %s is invalid", http.Timeout)
+		}
+	}
+
+	if http.MaxBodySize < 0 {
+		return fmt.Errorf("the maxBodySize should be greater than 0")
+	}
+	return nil
+}
+
+// prefix the route prefix of the api, eg: /api/v1/user
+func (http HTTP) prefix(root string) string {
+	if http.Versioning == "path" {
+		root = filepath.Join(root, "/", versionOf(http.Version))
+	}
+
+	if http.Group != "" {
+		root = filepath.Join(root, "/", http.Group)
+	}
+	return root
+}
+
+// groupHandlers the handlers shared by the paths of the api: the version headers, the timeout and the body size limit.
+// the timeout and the body size limit of the path override the settings of the group
+func (http HTTP) groupHandlers(path Path) []gin.HandlerFunc {
+	handlers := []gin.HandlerFunc{}
+
+	headers := map[string]string{}
+	if http.Versioning != "" {
+		headers["Api-Version"] = http.Version
+	}
+
+	if http.Deprecated != nil {
+		headers["Deprecation"] = "true"
+		if date, err := time.Parse("2006-01-02", http.Deprecated.Date); err == nil {
+			headers["Deprecation"] = fmt.Sprintf("@%d", date.Unix())
+		}
+
+		if http.Deprecated.Sunset != "" {
+			headers["Sunset"] = httpDate(http.Deprecated.Sunset)
+		}
+
+		if http.Deprecated.Link != "" {
+			headers["Link"] = fmt.Sprintf(`<%s>; rel="deprecation"`, http.Deprecated.Link)
+		}
+	}
+
+	if len(headers) > 0 {
+		handlers = append(handlers, func(c *gin.Context) {
+			for name, value := range headers {
+				c.Writer.Header().Set(name, value)
+			}
+		})
+	}
+
+	timeout := http.Timeout
+	if path.Timeout != "" {
+		timeout = path.Timeout
+	}
+
+	if timeout != "" {
+		timeout, _ := time.ParseDuration(timeout)
+		handlers = append(handlers, func(c *gin.Context) {
+			c.Set("__timeout", timeout)
+		})
+	}
+
+	maxBodySize := http.MaxBodySize
+	if path.MaxBodySize > 0 {
+		maxBodySize = path.MaxBodySize
+	}
+
+	if maxBodySize > 0 {
+		handlers = append(handlers, bodyLimit(maxBodySize))
+	}
+
+	return handlers
+}
+
+// negotiate register the handlers of the version, returns the dispatcher of the route if the route is not registered
+func (http HTTP) negotiate(method string, path string, router gin.IRoutes, handlers []gin.HandlerFunc) (gin.HandlerFunc, bool) {
+	base := ""
+	if group, ok := router.(interface{ BasePath() string }); ok {
+		base = group.BasePath()
+	}
+
+	version := versionOf(http.Version)
+	key := fmt.Sprintf("%p|%s|%s|%s", http.engine, method, base, path)
+
+	versionRoutesLock.Lock()
+	defer versionRoutesLock.Unlock()
+	route, has := versionRoutes[key]
+	if !has {
+		route = &versionRoute{versions: map[string][]gin.HandlerFunc{}}
+		versionRoutes[key] = route
+	}
+
+	route.versions[version] = handlers
+	if route.latest == "" || compareVersion(version, route.latest) > 0 {
+		route.latest = version
+	}
+
+	return route.dispatch, has
+}
+
+// dispatch run the handlers of the version in the Accept-Version header, the latest version if the header is empty.
+// the handlers run in order until aborted
+func (route *versionRoute) dispatch(c *gin.Context) {
+	c.Writer.Header().Add("Vary", "Accept-Version")
+	requested := c.GetHeader("Accept-Version")
+
+	versionRoutesLock.RLock()
+	version := route.latest
+	if requested != "" {
+		version = versionOf(requested)
+	}
+
+	handlers, has := route.versions[version]
+	versions := []string{}
+	if !has {
+		for name := range route.versions {
+			versions = append(versions, name)
+		}
+	}
+	versionRoutesLock.RUnlock()
+
+	if !has {
+		sort.Strings(versions)
+		c.JSON(400, gin.H{
+			"code":    400,
+			"message": fmt.Sprintf("the version %s is not supported, the supported versions: %s", requested, strings.Join(versions, ", ")),
+		})
+		c.Abort()
+		return
+	}
+
+	for _, handler := range handlers {
+		handler(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+}
+
+// validate the timeout and the size limits of the path
+func (path Path) validate() error {
+	if path.Timeout != "" {
+		timeout, err := time.ParseDuration(path.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("the timeout %s is invalid", path.Timeout)
+		}
+	}
+
+	if path.MaxBodySize < 0 || path.MaxFileSize < 0 {
+		return fmt.Errorf("the maxBodySize and the maxFileSize should be greater than 0")
+	}
+
+	if path.Upload != nil && path.Upload.Expiration != "" {
+		expiration, err := time.ParseDuration(path.Upload.Expiration)
+		if err != nil || expiration <= 0 {
+			return fmt.Errorf("the expiration %s of the upload is invalid", path.Upload.Expiration)
+		}
+	}
+	return nil
+}
+
+// context the context of the process, with the timeout of the path or the group
+func (path Path) context(c *gin.Context) (context.Context, context.CancelFunc) {
+	if timeout, has := c.Get("__timeout"); has {
+		if timeout, ok := timeout.(time.Duration); ok && timeout > 0 {
+			return context.WithTimeout(context.Background(), timeout)
+		}
+	}
+	return context.WithCancel(context.Background())
+}
+
+// bodyLimit limit the size of the request body
+func bodyLimit(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > max {
+			c.JSON(413, gin.H{"code": 413, "message": fmt.Sprintf("the request body is larger than %d bytes", max)})
+			c.Abort()
+			return
+		}
+
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+		}
+	}
+}
+
+// fileLimit limit the size of the uploaded files, the parts are checked while streaming.
+// the body is spooled to a temp file and replayed to the handlers
+func fileLimit(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			return
+		}
+
+		_, params, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if err != nil || params["boundary"] == "" {
+			c.JSON(400, gin.H{"code": 400, "message": "the multipart form is invalid"})
+			c.Abort()
+			return
+		}
+
+		spool, err := os.CreateTemp("", "upload-*")
+		if err != nil {
+			c.JSON(500, gin.H{"code": 500, "message": err.Error()})
+			c.Abort()
+			return
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		body := io.TeeReader(c.Request.Body, spool)
+		code, err := fileSizes(multipart.NewReader(body, params["boundary"]), max)
+		if err == nil {
+			_, err = io.Copy(io.Discard, body)
+			if err != nil {
+				code = errorCode(err)
+			}
+		}
+
+		if err != nil {
+			c.JSON(code, gin.H{"code": code, "message": err.Error()})
+			c.Abort()
+			return
+		}
+
+		_, err = spool.Seek(0, io.SeekStart)
+		if err != nil {
+			c.JSON(500, gin.H{"code": 500, "message": err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = io.NopCloser(spool)
+		c.Next()
+	}
+}
+
+// fileSizes read the parts of the multipart form, returns 413 once a file is larger than the max size
+func fileSizes(reader *multipart.Reader, max int64) (int, error) {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return 0, nil
+		}
+
+		if err != nil {
+			if tooLarge(err) {
+				return 413, err
+			}
+			return 400, err
+		}
+
+		size, err := io.Copy(io.Discard, io.LimitReader(part, max+1))
+		if err != nil {
+			if tooLarge(err) {
+				return 413, err
+			}
+			return 400, err
+		}
+
+		if part.FileName() != "" && size > max {
+			return 413, fmt.Errorf("the file %s is larger than %d bytes", part.FormName(), max)
+		}
+
+		_, err = io.Copy(io.Discard, part)
+		if err != nil {
+			return errorCode(err), err
+		}
+	}
+}
+
+// errorCode the status code of the process error, 504 if the deadline is exceeded, 413 if the body is too large
+func errorCode(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return 504
+	}
+
+	if tooLarge(err) {
+		return 413
+	}
+	return 500
+}
+
+// tooLarge the error is caused by the body size limit
+func tooLarge(err error) bool {
+	var maxBytesError *http.MaxBytesError
+	return errors.As(err, &maxBytesError)
+}
+
+// versionOf the version segment, eg: 1.0.0 => v1, v2 => v2, 2.1 => v2, beta => beta
+func versionOf(version string) string {
+	version = strings.ToLower(strings.TrimSpace(version))
+	major := strings.Split(strings.TrimPrefix(version, "v"), ".")[0]
+	if _, err := strconv.Atoi(major); err != nil {
+		return version
+	}
+	return "v" + major
+}
+
+// compareVersion compare the version segments, the numeric versions are compared by the number
+func compareVersion(a, b string) int {
+	na, erra := strconv.Atoi(strings.TrimPrefix(a, "v"))
+	nb, errb := strconv.Atoi(strings.TrimPrefix(b, "v"))
+	if erra == nil && errb == nil {
+		return na - nb
+	}
+	return strings.Compare(a, b)
+}
+
+// httpDate format the date as the HTTP date, eg: 2024-06-30 => Sun, 30 Jun 2024 00:00:00 GMT
+func httpDate(value string) string {
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return value
+	}
+	return date.UTC().Format(http.TimeFormat)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/process"
+)
+
+func TestVersioning(t *testing.T) {
+	router := prepareGroup(t)
+	defer delete(APIs, "unit.pets.v1")
+	defer delete(APIs, "unit.pets.v2")
+	defer delete(APIs, "unit.orders")
+
+	request := func(method string, path string, version string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		if version != "" {
+			req.Header.Set("Accept-Version", version)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		return response
+	}
+
+	// the latest version
+	res := request("GET", "/api/pets/1", "")
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, `["v2","1"]`, res.Body.String())
+	assert.Equal(t, "2.0.0", res.Header().Get("Api-Version"))
+	assert.Empty(t, res.Header().Get("Deprecation"))
+
+	// the deprecated version
+	res = request("GET", "/api/pets/1", "v1")
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, `["v1","1"]`, res.Body.String())
+	assert.Equal(t, "1.0.0", res.Header().Get("Api-Version"))
+	assert.Equal(t, "@1704067200", res.Header().Get("Deprecation"))
+	assert.Equal(t, "Sun, 30 Jun 2024 00:00:00 GMT", res.Header().Get("Sunset"))
+	assert.Equal(t, `</docs/v2>; rel="deprecation"`, res.Header().Get("Link"))
+	assert.Equal(t, "Accept-Version", res.Header().Get("Vary"))
+
+	res = request("GET", "/api/pets/1", "2.1")
+	assert.Equal(t, `["v2","1"]`, res.Body.String())
+
+	res = request("GET", "/api/pets/1", "v3")
+	assert.Equal(t, 400, res.Code)
+	assert.Contains(t, res.Body.String(), "v1, v2")
+
+	// the path only in v2
+	assert.Equal(t, 200, request("GET", "/api/pets/search", "").Code)
+	assert.Equal(t, 400, request("GET", "/api/pets/search", "v1").Code)
+
+	// the path versioning and the group settings
+	res = request("GET", "/api/v3/orders/1", "")
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "3", res.Header().Get("Api-Version"))
+
+	req, _ := http.NewRequest("POST", "/api/v3/orders/", bytes.NewBufferString(`{"name": "a very long name"}`))
+	req.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, req)
+	assert.Equal(t, 413, response.Code)
+
+	// the CORS allows of the group
+	req, _ = http.NewRequest("GET", "/api/v3/orders/1", nil)
+	req.Header.Set("Origin", "http://other.com")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, req)
+	assert.Equal(t, 403, response.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v3/orders/1", nil)
+	req.Header.Set("Origin", "http://orders.com")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, req)
+	assert.Equal(t, 200, response.Code)
+	assert.Equal(t, "http://orders.com", response.Header().Get("Access-Control-Allow-Origin"))
+
+	// the invalid settings
+	_, err := LoadSource("<unit.invalid>.http.json", []byte(`{"name": "invalid", "versioning": "query", "version": "1"}`), "unit.invalid")
+	assert.NotNil(t, err)
+	_, err = LoadSource("<unit.invalid>.http.json", []byte(`{"name": "invalid", "timeout": "1x"}`), "unit.invalid")
+	assert.NotNil(t, err)
+}
+
+func prepareGroup(t *testing.T) *gin.Engine {
+	process.Register("unit.api.args", func(process *process.Process) interface{} {
+		return process.Args
+	})
+
+	sources := map[string]string{
+		"unit.pets.v1": `{
+			"name": "pets", "version": "1.0.0", "group": "pets", "guard": "-", "versioning": "header",
+			"deprecated": {"date": "2024-01-01", "sunset": "2024-06-30", "link": "/docs/v2"},
+			"paths": [
+				{"path": "/:id", "method": "GET", "process": "unit.api.args", "in": ["v1", "$param.id"], "out": {"status": 200, "type": "application/json"}}
+			]
+		}`,
+		"unit.pets.v2": `{
+			"name": "pets", "version": "2.0.0", "group": "pets", "guard": "-", "versioning": "header",
+			"paths": [
+				{"path": "/search", "method": "GET", "process": "unit.api.args", "in": ["v2"], "out": {"status": 200, "type": "application/json"}},
+				{"path": "/:id", "method": "GET", "process": "unit.api.args", "in": ["v2", "$param.id"], "out": {"status": 200, "type": "application/json"}}
+			]
+		}`,
+		"unit.orders": `{
+			"name": "orders", "version": "3", "group": "orders", "guard": "-", "versioning": "path",
+			"allows": ["orders.com"], "timeout": "5s", "maxBodySize": 10,
+			"paths": [
+				{"path": "/:id", "method": "GET", "process": "unit.api.args", "in": ["$param.id"], "out": {"status": 200, "type": "application/json"}},
+				{"path": "/", "method": "POST", "process": "unit.api.args", "in": [":payload"], "out": {"status": 200, "type": "application/json"}}
+			]
+		}`,
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	for _, id := range []string{"unit.pets.v1", "unit.pets.v2", "unit.orders"} {
+		api, err := LoadSource("<"+id+">.http.json", []byte(sources[id]), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		api.HTTP.Routes(router, "/api")
+	}
+	return router
+}
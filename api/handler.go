@@ -26,14 +26,32 @@ import (
 func (path Path) defaultHandler(getArgs argsHandler) func(c *gin.Context) {
 	return func(c *gin.Context) {
 
-		ctx, cancel := context.WithCancel(context.Background())
+		ctx, cancel := path.context(c)
 		defer cancel()
-		path.setPayload(c)
+		if !path.setPayload(c) {
+			return
+		}
+
 		var status int = path.Out.Status
 		var contentType = path.reqContentType(c) // Get the defined content type at API DSL
 
+		// the response cache and the ETag of the GET requests
+		// bind the arguments before the process runs, the errors of reading the request are responded by the recovery
+		args := getArgs(c)
+		getArgs = func(c *gin.Context) []interface{} { return args }
+
+		conditional := c.Request.Method == "GET" || c.Request.Method == "HEAD"
+		cacheKey := ""
+		if conditional && path.Out.Cache != nil {
+			cacheKey = path.cacheKey(c, args)
+			if path.cached(c, cacheKey) {
+				c.Done()
+				return
+			}
+		}
+
 		chRes := make(chan interface{}, 1)
-		go path.execProcess(ctx, chRes, c, getArgs)
+		go path.execProcess(ctx, chRes, c.Copy(), getArgs) // the copy is safe to use after the handler returns
 
 		select {
 		case resp := <-chRes:
@@ -56,6 +74,12 @@ func (path Path) defaultHandler(getArgs argsHandler) func(c *gin.Context) {
 				}
 			}
 
+			// Buffer the response to generate the ETag
+			if _, ok := body.(io.ReadCloser); !ok && conditional {
+				writer := path.buffer(c)
+				defer path.flush(c, writer, cacheKey)
+			}
+
 			// Release Memory
 			defer func() { resp = nil; body = nil }()
 			switch data := body.(type) {
@@ -78,7 +102,7 @@ func (path Path) defaultHandler(getArgs argsHandler) func(c *gin.Context) {
 				return
 
 			case error:
-				ex := exception.Err(data, 500)
+				ex := exception.Err(data, errorCode(data))
 				c.JSON(ex.Code, gin.H{"message": ex.Message, "code": ex.Code})
 
 			case nil:
@@ -97,6 +121,13 @@ func (path Path) defaultHandler(getArgs argsHandler) func(c *gin.Context) {
 				return
 			}
 
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				c.JSON(504, gin.H{"message": "the process timed out", "code": 504})
+			}
+			c.Abort()
+			return
+
 		case <-c.Request.Context().Done():
 			c.Abort()
 			return
@@ -120,10 +151,12 @@ func (path Path) processHandler() func(c *gin.Context) {
 func (path Path) redirectHandler(getArgs argsHandler) func(c *gin.Context) {
 	return func(c *gin.Context) {
 
-		ctx, cancel := context.WithCancel(context.Background())
+		ctx, cancel := path.context(c)
 		defer cancel()
 
-		path.setPayload(c)
+		if !path.setPayload(c) {
+			return
+		}
 		contentType := path.reqContentType(c)
 
 		// run process
@@ -145,12 +178,14 @@ func (path Path) redirectHandler(getArgs argsHandler) func(c *gin.Context) {
 func (path Path) streamHandler(getArgs argsHandler) func(c *gin.Context) {
 	return func(c *gin.Context) {
 
-		path.setPayload(c)
+		if !path.setPayload(c) {
+			return
+		}
 		path.reqContentType(c)
 
 		chanStream := make(chan ssEventData, 1)
 		chanError := make(chan error, 1)
-		ctx, cancel := context.WithCancel(context.Background())
+		ctx, cancel := path.context(c)
 		defer cancel()
 
 		wg := &sync.WaitGroup{}
@@ -225,10 +260,8 @@ func (path Path) runStreamScript(ctx context.Context, c *gin.Context, getArgs ar
 			sid = v
 		}
 	}
-	if v, has := c.Get("__global"); has { // set global
-		if v, ok := v.(map[string]interface{}); ok {
-			global = v
-		}
+	if v := globalOf(c); v != nil { // set global
+		global = v
 	}
 
 	// make a new script context
@@ -284,10 +317,8 @@ func (path Path) execProcess(ctx context.Context, chRes chan<- interface{}, c *g
 		}
 	}
 
-	if global, has := c.Get("__global"); has { // 设定全局变量
-		if global, ok := global.(map[string]interface{}); ok {
-			process.WithGlobal(global)
-		}
+	if global := globalOf(c); global != nil { // 设定全局变量
+		process.WithGlobal(global)
 	}
 
 	process.WithContext(ctx)
@@ -311,17 +342,15 @@ func (path Path) runProcess(ctx context.Context, c *gin.Context, getArgs argsHan
 		}
 	}
 
-	if global, has := c.Get("__global"); has { // 设定全局变量
-		if global, ok := global.(map[string]interface{}); ok {
-			process.WithGlobal(global)
-		}
+	if global := globalOf(c); global != nil { // 设定全局变量
+		process.WithGlobal(global)
 	}
 
 	process.WithContext(ctx)
 	err := process.Execute()
 	if err != nil {
 		log.Error("[Path] %s %s", path.Path, err.Error())
-		exception.Err(err, 500).Throw()
+		exception.Err(err, errorCode(err)).Throw()
 	}
 	return process.Value()
 }
@@ -365,25 +394,31 @@ func (path Path) setResponseHeaders(c *gin.Context, resp interface{}, contentTyp
 	return contentType
 }
 
-func (path Path) setPayload(c *gin.Context) {
+// setPayload read the JSON payload, returns false if the body is larger than the limit and the 413 is responded
+func (path Path) setPayload(c *gin.Context) bool {
 
 	if strings.HasPrefix(strings.ToLower(c.GetHeader("content-type")), "application/json") {
 
 		if c.Request.Body == nil {
 			c.Set("__payloads", map[string]interface{}{})
-			return
+			return true
 		}
 
 		bytes, err := io.ReadAll(c.Request.Body)
 		if err != nil {
+			if tooLarge(err) {
+				c.JSON(413, gin.H{"code": 413, "message": err.Error()})
+				c.Abort()
+				return false
+			}
 			c.Set("__payloads", map[string]interface{}{})
 			log.Error("[Path] %s %s", path.Path, err.Error())
-			return
+			return true
 		}
 
 		if bytes == nil || len(bytes) == 0 {
 			c.Set("__payloads", map[string]interface{}{})
-			return
+			return true
 
 		}
 
@@ -399,6 +434,7 @@ func (path Path) setPayload(c *gin.Context) {
 
 		c.Request.Body = io.NopCloser(strings.NewReader(string(bytes)))
 	}
+	return true
 }
 
 func isFirstNonSpaceChar(text string, char rune) bool {
@@ -20,7 +20,6 @@ import (
 
 // HTTPGuards 支持的中间件
 var HTTPGuards = map[string]gin.HandlerFunc{}
-var registeredOptions = map[string]bool{}
 
 // ProcessGuard guard process
 func ProcessGuard(name string) gin.HandlerFunc {
@@ -67,10 +66,8 @@ func ProcessGuard(name string) gin.HandlerFunc {
 			}
 		}
 
-		if global, has := c.Get("__global"); has { // Set global variables
-			if global, ok := global.(map[string]interface{}); ok {
-				process.WithGlobal(global)
-			}
+		if global := globalOf(c); global != nil { // Set global variables
+			process.WithGlobal(global)
 		}
 
 		err = process.Execute()
@@ -91,6 +88,11 @@ func ProcessGuard(name string) gin.HandlerFunc {
 			if global, ok := data["__global"].(map[string]interface{}); ok {
 				c.Set("__global", global)
 			}
+
+			// the identity of the user, used by the rate limits and the access log
+			if id, ok := data["__user_id"]; ok && id != nil {
+				c.Set("__user_id", id)
+			}
 		}
 	}
 }
@@ -135,32 +137,38 @@ func IsAllowed(c *gin.Context, allowsMap map[string]bool) bool {
 // Routes 配置转换为路由
 func (http HTTP) Routes(router *gin.Engine, path string, allows ...string) {
 	var group gin.IRoutes = router
-	if http.Group != "" {
-		path = filepath.Join(path, "/", http.Group)
-	}
+	path = http.prefix(path)
 	group = router.Group(path)
+	http.engine = router
+	http.options = map[string]bool{}
+	if len(http.Allows) > 0 {
+		allows = append(append([]string{}, allows...), http.Allows...)
+	}
+
 	for _, path := range http.Paths {
 		path.Method = strings.ToUpper(path.Method)
 		http.Route(group, path, allows...)
 	}
-	registeredOptions = map[string]bool{}
 }
 
 // Route 路径配置转换为路由
 func (http HTTP) Route(router gin.IRoutes, path Path, allows ...string) {
 	getArgs := http.parseIn(path.In)
-	handlers := []gin.HandlerFunc{}
+	handlers := http.groupHandlers(path)
 
 	// 跨域访问
+	var cors gin.HandlerFunc
 	if allows != nil && len(allows) > 0 {
 		allowsMap := map[string]bool{}
 		for _, allow := range allows {
 			allowsMap[allow] = true
 		}
 
-		// Cross domain
-		http.setCorsOption(path.Path, allowsMap, router)
-		handlers = append(handlers, func(c *gin.Context) {
+		// Cross domain, the options of the tus upload are responded by the upload handler
+		if path.Out.Type != "tus" {
+			http.setCorsOption(path.Path, allowsMap, router)
+		}
+		cors = func(c *gin.Context) {
 			origin := getOrigin(c)
 			if origin != "" {
 
@@ -179,11 +187,27 @@ func (http HTTP) Route(router gin.IRoutes, path Path, allows ...string) {
 				c.Writer.Header().Set("Access-Control-Allow-Headers", allowHeaders)
 				c.Writer.Header().Set("Access-Control-Allow-Methods", allowMethods)
 			}
-		})
+		}
+		handlers = append(handlers, cors)
 	}
 
+	// rate limits, the limits keyed by the guard identity run after the guards
+	limits, guardLimits := http.limits(path)
+	handlers = append(handlers, limits...)
+
 	// set middlewares
 	http.guard(&handlers, path.Guard, http.Guard)
+	handlers = append(handlers, guardLimits...)
+
+	// the size limit of the uploaded files
+	if path.MaxFileSize > 0 {
+		handlers = append(handlers, fileLimit(path.MaxFileSize))
+	}
+
+	// validate the request
+	if path.Request != nil {
+		handlers = append(handlers, path.validateHandler())
+	}
 
 	// set http handler
 	if path.Out.Redirect != nil {
@@ -192,6 +216,28 @@ func (http HTTP) Route(router gin.IRoutes, path Path, allows ...string) {
 	} else if path.ProcessHandler {
 		handlers = append(handlers, path.processHandler())
 
+	} else if path.Out.Type == "tus" {
+		// the upload is created at the path, and resumed at the path of the upload id.
+		// the discovery requests are responded without the guards and the limits
+		tus := path.tusHandler(getArgs)
+		options := []gin.HandlerFunc{tus}
+		if cors != nil {
+			options = []gin.HandlerFunc{cors, tus}
+		}
+
+		handlers = append(handlers, tus)
+		uploadPath := strings.TrimSuffix(path.Path, "/") + "/:uid"
+		http.method("POST", path.Path, router, handlers...)
+		http.method("OPTIONS", path.Path, router, options...)
+		for _, method := range []string{"HEAD", "PATCH", "DELETE"} {
+			http.method(method, uploadPath, router, handlers...)
+		}
+		http.method("OPTIONS", uploadPath, router, options...)
+		return
+
+	} else if path.Out.Type == "websocket" {
+		handlers = append(handlers, path.socketHandler(getArgs, allows))
+
 	} else if strings.HasPrefix(path.Out.Type, "text/event-stream") {
 		handlers = append(handlers, path.streamHandler(getArgs))
 
@@ -224,10 +270,12 @@ func (http HTTP) guard(handlers *[]gin.HandlerFunc, guard string, defaults strin
 
 // setCorsOption 跨域许可
 func (http HTTP) setCorsOption(path string, allows map[string]bool, router gin.IRoutes) {
-	if _, has := registeredOptions[fmt.Sprintf("%s.%s", http.Name, path)]; has {
-		return
+	if http.options != nil {
+		if _, has := http.options[path]; has {
+			return
+		}
+		http.options[path] = true
 	}
-	registeredOptions[fmt.Sprintf("%s.%s", http.Name, path)] = true
 	http.method("OPTIONS", path, router, func(c *gin.Context) {
 		referer := c.Request.Referer()
 		if referer != "" {
@@ -266,6 +314,9 @@ func (http HTTP) parseIn(in []interface{}) func(c *gin.Context) []interface{} {
 			getValues = append(getValues, func(c *gin.Context) interface{} {
 				bytes, err := io.ReadAll(c.Request.Body)
 				if err != nil {
+					if tooLarge(err) {
+						exception.New(err.Error(), 413).Throw()
+					}
 					panic(err)
 				}
 				return string(bytes)
@@ -414,6 +465,19 @@ func (http HTTP) parseIn(in []interface{}) func(c *gin.Context) []interface{} {
 
 // router 方法设定
 func (http HTTP) method(name string, path string, router gin.IRoutes, handlers ...gin.HandlerFunc) {
+
+	// the versions of the route are dispatched by the Accept-Version header
+	if http.Versioning == "header" && http.engine != nil {
+		dispatch, registered := http.negotiate(name, path, router, handlers)
+		if registered {
+			return
+		}
+		handlers = []gin.HandlerFunc{dispatch}
+	}
+
+	// the request id and the access log
+	handlers = append([]gin.HandlerFunc{requestHandler}, handlers...)
+
 	switch name {
 	case "POST":
 		router.POST(path, handlers...)
@@ -424,6 +488,9 @@ func (http HTTP) method(name string, path string, router gin.IRoutes, handlers .
 	case "PUT":
 		router.PUT(path, handlers...)
 		return
+	case "PATCH":
+		router.PATCH(path, handlers...)
+		return
 	case "DELETE":
 		router.DELETE(path, handlers...)
 		return
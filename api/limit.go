@@ -0,0 +1,305 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yaoapp/gou/session"
+	"github.com/yaoapp/gou/store"
+	"github.com/yaoapp/gou/store/lru"
+	"github.com/yaoapp/kun/log"
+)
+
+// limitLock the lock of the counters, the counters of a scope may be shared by the routes
+var limitLock sync.Mutex
+
+// scripter the shared stores running the scripts atomically, eg: the redis store
+type scripter interface {
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// bucketScript take a token of the bucket atomically, the bucket is a hash of the tokens and the updated time (ms).
+// args: capacity, rate (tokens per second), now (ms). returns {allowed, tokens}
+const bucketScript = `
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local tokens = capacity
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+if bucket[1] and bucket[2] then
+	local elapsed = math.max(0, now - tonumber(bucket[2])) / 1000
+	tokens = math.min(capacity, tonumber(bucket[1]) + elapsed * rate)
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`
+
+// limiter the token bucket of the limit
+type limiter struct {
+	scope    string
+	limit    Limit
+	rate     float64 // the tokens refilled per second
+	capacity float64
+}
+
+// limits the rate limit handlers of the path, the limit of the api is shared by the paths of the api only.
+// returns the handlers run before the guards and the handlers run after the guards
+func (http HTTP) limits(path Path) ([]gin.HandlerFunc, []gin.HandlerFunc) {
+	before := []gin.HandlerFunc{}
+	after := []gin.HandlerFunc{}
+	add := func(limit *Limit, scope string) {
+		if limit == nil {
+			return
+		}
+
+		if limit.afterGuard() {
+			after = append(after, limit.handler(scope))
+			return
+		}
+		before = append(before, limit.handler(scope))
+	}
+
+	scope := http.id
+	if scope == "" {
+		scope = http.Group
+	}
+
+	add(http.Limit, scope)
+	add(path.Limit, fmt.Sprintf("%s:%s:%s", scope, path.Method, path.Path))
+	return before, after
+}
+
+// validate the limit
+func (limit Limit) validate() error {
+	if limit.Requests <= 0 {
+		return fmt.Errorf("the requests of the limit should be greater than 0")
+	}
+
+	window, err := time.ParseDuration(limit.Window)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("the window %s of the limit is invalid", limit.Window)
+	}
+
+	if limit.Burst < 0 {
+		return fmt.Errorf("the burst of the limit should be greater than 0")
+	}
+
+	// the counters of the in-memory stores are taken under the lock of the process, the shared stores run the scripts
+	if limit.Store != "" {
+		if stor, has := store.Pools[limit.Store]; has && !atomicStore(stor) {
+			return fmt.Errorf("the store %s of the limit should be an in-memory or a redis store", limit.Store)
+		}
+	}
+
+	key := limit.Key
+	if key != "" && key != "ip" && key != "user" &&
+		!strings.HasPrefix(key, "header.") && !strings.HasPrefix(key, "session.") && !strings.HasPrefix(key, "global.") {
+		return fmt.Errorf("the key %s of the limit is invalid", key)
+	}
+	return nil
+}
+
+// afterGuard the key of the limit is provided by the guard
+func (limit Limit) afterGuard() bool {
+	return limit.Key == "user" || strings.HasPrefix(limit.Key, "session.") || strings.HasPrefix(limit.Key, "global.")
+}
+
+// handler the rate limit handler of the scope, the counters of the same scope are shared
+func (limit Limit) handler(scope string) gin.HandlerFunc {
+	window, _ := time.ParseDuration(limit.Window)
+	capacity := limit.Burst
+	if capacity == 0 {
+		capacity = limit.Requests
+	}
+
+	l := &limiter{
+		scope:    scope,
+		limit:    limit,
+		rate:     float64(limit.Requests) / window.Seconds(),
+		capacity: float64(capacity),
+	}
+
+	return func(c *gin.Context) {
+		allowed, remaining, reset, retry, err := l.take(l.keyOf(c))
+		if err != nil {
+			log.Error("[API] %s rate limit: %s", scope, err.Error())
+			c.JSON(503, gin.H{"code": 503, "message": "the rate limit is unavailable"})
+			c.Abort()
+			return
+		}
+
+		c.Writer.Header().Set("RateLimit-Limit", strconv.Itoa(capacity))
+		c.Writer.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Writer.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(reset)))
+		if !allowed {
+			c.Writer.Header().Set("Retry-After", strconv.Itoa(seconds(retry)))
+			c.JSON(429, gin.H{"code": 429, "message": "too many requests"})
+			c.Abort()
+			return
+		}
+	}
+}
+
+// atomicStore the store takes the tokens atomically, the in-memory stores or the stores running the scripts
+func atomicStore(stor store.Store) bool {
+	if _, ok := stor.(*lru.Cache); ok {
+		return true
+	}
+	_, ok := stor.(scripter)
+	return ok
+}
+
+// take a token of the key, returns the remaining tokens, the duration to refill the bucket and the duration to retry.
+// the request is rejected if the store fails
+func (l *limiter) take(key string) (bool, int, time.Duration, time.Duration, error) {
+	stor, err := storeOf(l.limit.Store)
+	if err != nil {
+		return false, 0, 0, 0, err
+	}
+
+	key = fmt.Sprintf("limit:%s:%s", l.scope, key)
+	var allowed bool
+	var tokens float64
+	switch s := stor.(type) {
+	case *lru.Cache:
+		allowed, tokens, err = l.takeLocal(s, key)
+	case scripter:
+		allowed, tokens, err = l.takeShared(s, key)
+	default:
+		err = fmt.Errorf("the store %s should be an in-memory or a redis store", l.limit.Store)
+	}
+
+	if err != nil {
+		return false, 0, 0, 0, err
+	}
+
+	reset := time.Duration((l.capacity - tokens) / l.rate * float64(time.Second))
+	retry := time.Duration(0)
+	if !allowed {
+		retry = time.Duration((1 - tokens) / l.rate * float64(time.Second))
+	}
+	return allowed, int(math.Floor(tokens)), reset, retry, nil
+}
+
+// takeLocal take a token of the bucket in the memory of the process
+func (l *limiter) takeLocal(stor *lru.Cache, key string) (bool, float64, error) {
+	limitLock.Lock()
+	defer limitLock.Unlock()
+
+	now := time.Now()
+	tokens := l.capacity
+	if value, has := stor.Get(key); has {
+		if last, updated, ok := parseBucket(value); ok {
+			elapsed := now.Sub(updated).Seconds()
+			if elapsed < 0 {
+				elapsed = 0
+			}
+			tokens = math.Min(l.capacity, last+elapsed*l.rate)
+		}
+	}
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+
+	reset := time.Duration((l.capacity - tokens) / l.rate * float64(time.Second))
+	err := stor.Set(key, fmt.Sprintf("%f|%d", tokens, now.UnixNano()), reset+time.Second)
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed, tokens, nil
+}
+
+// takeShared take a token of the bucket in the shared store by the script, the nodes share the bucket
+func (l *limiter) takeShared(stor scripter, key string) (bool, float64, error) {
+	res, err := stor.Eval(bucketScript, []string{key}, l.capacity, l.rate, time.Now().UnixMilli())
+	if err != nil {
+		return false, 0, err
+	}
+
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("the bucket %s is invalid: %v", key, res)
+	}
+
+	tokens, err := strconv.ParseFloat(fmt.Sprintf("%v", values[1]), 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("the bucket %s is invalid: %v", key, res)
+	}
+	return fmt.Sprintf("%v", values[0]) == "1", tokens, nil
+}
+
+// keyOf the key of the request, the ip is used if the value of the key is empty
+func (l *limiter) keyOf(c *gin.Context) string {
+	key := l.limit.Key
+	value := ""
+	switch {
+	case key == "user":
+		if id, has := c.Get("__user_id"); has && id != nil {
+			value = fmt.Sprintf("%v", id)
+		}
+
+	case strings.HasPrefix(key, "header."):
+		value = c.GetHeader(strings.TrimPrefix(key, "header."))
+
+	case strings.HasPrefix(key, "session."):
+		if sid := c.GetString("__sid"); sid != "" {
+			if v, err := session.Global().ID(sid).Get(strings.TrimPrefix(key, "session.")); err == nil && v != nil {
+				value = fmt.Sprintf("%v", v)
+			}
+		}
+
+	case strings.HasPrefix(key, "global."):
+		if global, has := c.Get("__global"); has {
+			if global, ok := global.(map[string]interface{}); ok && global[strings.TrimPrefix(key, "global.")] != nil {
+				value = fmt.Sprintf("%v", global[strings.TrimPrefix(key, "global.")])
+			}
+		}
+	}
+
+	if value == "" {
+		return fmt.Sprintf("ip:%s", c.ClientIP())
+	}
+	return fmt.Sprintf("%s:%s", key, value)
+}
+
+// parseBucket parse the bucket value, tokens|updated
+func parseBucket(value interface{}) (float64, time.Time, bool) {
+	text, ok := value.(string)
+	if !ok {
+		return 0, time.Time{}, false
+	}
+
+	fields := strings.Split(text, "|")
+	if len(fields) != 2 {
+		return 0, time.Time{}, false
+	}
+
+	tokens, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	updated, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	return tokens, time.Unix(0, updated), true
+}
+
+// seconds round up the duration to seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
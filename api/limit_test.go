@@ -0,0 +1,267 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/gou/store"
+)
+
+func TestLimit(t *testing.T) {
+	router := prepareLimit(t)
+	defer delete(APIs, "unit.limit")
+	defer delete(store.Pools, "limit-tests")
+
+	request := func(path string, header string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		if header != "" {
+			req.Header.Set("X-Api-Key", header)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		return response
+	}
+
+	// the path limit, 2 requests at once
+	res := request("/api/unit/limit/path", "")
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "2", res.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", res.Header().Get("RateLimit-Remaining"))
+
+	assert.Equal(t, 200, request("/api/unit/limit/path", "").Code)
+	res = request("/api/unit/limit/path", "")
+	assert.Equal(t, 429, res.Code)
+	assert.Equal(t, "0", res.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", res.Header().Get("Retry-After"))
+
+	// the header key, the counters of the keys are separated
+	assert.Equal(t, 200, request("/api/unit/limit/key", "a").Code)
+	assert.Equal(t, 429, request("/api/unit/limit/key", "a").Code)
+	assert.Equal(t, 200, request("/api/unit/limit/key", "b").Code)
+
+	// the api limit is shared by the paths, 5 requests were made
+	res = request("/api/unit/limit/free", "")
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "0", res.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, 429, request("/api/unit/limit/free", "").Code)
+
+	// the invalid limit
+	_, err := LoadSource("<unit.limit.invalid>.http.json", []byte(`{
+		"name": "invalid", "paths": [{"path": "/", "method": "GET", "process": "unit.api.args", "limit": {"requests": 1, "window": "1x"}}]
+	}`), "unit.limit.invalid")
+	assert.NotNil(t, err)
+
+	// the stores without the scripts are not atomic
+	store.Pools["limit-tests-shared"] = struct{ store.Store }{}
+	defer delete(store.Pools, "limit-tests-shared")
+	_, err = LoadSource("<unit.limit.invalid>.http.json", []byte(`{
+		"name": "invalid", "paths": [{"path": "/", "method": "GET", "process": "unit.api.args", "limit": {"requests": 1, "window": "1m", "store": "limit-tests-shared"}}]
+	}`), "unit.limit.invalid")
+	assert.NotNil(t, err)
+}
+
+func prepareLimit(t *testing.T) *gin.Engine {
+	process.Register("unit.api.args", func(process *process.Process) interface{} {
+		return process.Args
+	})
+
+	stor, err := store.New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Pools["limit-tests"] = stor
+
+	source := `{
+		"name": "limit", "version": "1.0.0", "guard": "-",
+		"limit": {"requests": 7, "window": "1h", "store": "limit-tests"},
+		"paths": [
+			{
+				"path": "/path", "method": "GET", "process": "unit.api.args",
+				"limit": {"requests": 2, "window": "1m", "store": "limit-tests"},
+				"out": {"status": 200, "type": "application/json"}
+			},
+			{
+				"path": "/key", "method": "GET", "process": "unit.api.args",
+				"limit": {"requests": 1, "window": "1m", "key": "header.X-Api-Key"},
+				"out": {"status": 200, "type": "application/json"}
+			},
+			{ "path": "/free", "method": "GET", "process": "unit.api.args", "out": {"status": 200, "type": "application/json"} }
+		]
+	}`
+
+	api, err := LoadSource("<unit.limit>.http.json", []byte(source), "unit.limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	api.HTTP.Routes(router, "/api")
+	return router
+}
+
+func TestLimitUser(t *testing.T) {
+	process.Register("unit.api.args", func(process *process.Process) interface{} {
+		return process.Args
+	})
+
+	// the guard returns the identity of the user by the header
+	process.Register("unit.api.guard.user", func(process *process.Process) interface{} {
+		headers, _ := process.Args[4].(http.Header)
+		if user := headers.Get("X-User"); user != "" {
+			return map[string]interface{}{"__user_id": user}
+		}
+		return nil
+	})
+
+	source := `{
+		"name": "limit", "version": "1.0.0", "guard": "unit.api.guard.user",
+		"paths": [{
+			"path": "/user", "method": "GET", "process": "unit.api.args",
+			"limit": {"requests": 1, "window": "1m", "key": "user"},
+			"out": {"status": 200, "type": "application/json"}
+		}]
+	}`
+
+	api, err := LoadSource("<unit.limit.user>.http.json", []byte(source), "unit.limit.user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer delete(APIs, "unit.limit.user")
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	api.HTTP.Routes(router, "/api")
+
+	request := func(user string) int {
+		req, _ := http.NewRequest("GET", "/api/unit/limit/user/user", nil)
+		req.RemoteAddr = "10.0.0.2:1234"
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		return response.Code
+	}
+
+	// the counters of the users are separated, the ip is used without the user
+	assert.Equal(t, 200, request("alice"))
+	assert.Equal(t, 429, request("alice"))
+	assert.Equal(t, 200, request("bob"))
+	assert.Equal(t, 200, request(""))
+	assert.Equal(t, 429, request(""))
+}
+
+func TestLimitScope(t *testing.T) {
+	process.Register("unit.api.args", func(process *process.Process) interface{} {
+		return process.Args
+	})
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+
+	// the apis of the same group have their own limits
+	for _, id := range []string{"unit.limit.scope.a", "unit.limit.scope.b"} {
+		name := id[len(id)-1:]
+		source := `{
+			"name": "` + name + `", "version": "1.0.0", "group": "scope", "guard": "-",
+			"limit": {"requests": 1, "window": "1m"},
+			"paths": [{"path": "/` + name + `", "method": "GET", "process": "unit.api.args", "out": {"status": 200, "type": "application/json"}}]
+		}`
+
+		api, err := LoadSource("<"+id+">.http.json", []byte(source), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer delete(APIs, id)
+		api.HTTP.Routes(router, "/api")
+	}
+
+	request := func(path string) int {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = "10.0.0.3:1234"
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		return response.Code
+	}
+
+	assert.Equal(t, 200, request("/api/scope/a"))
+	assert.Equal(t, 200, request("/api/scope/b"))
+	assert.Equal(t, 429, request("/api/scope/a"))
+}
+
+func TestLimitShared(t *testing.T) {
+	process.Register("unit.api.args", func(process *process.Process) interface{} {
+		return process.Args
+	})
+
+	shared := &scriptStore{}
+	store.Pools["limit-tests-script"] = shared
+	defer delete(store.Pools, "limit-tests-script")
+
+	source := `{
+		"name": "limit", "version": "1.0.0", "guard": "-",
+		"paths": [{
+			"path": "/shared", "method": "GET", "process": "unit.api.args",
+			"limit": {"requests": 2, "window": "1m", "store": "limit-tests-script"},
+			"out": {"status": 200, "type": "application/json"}
+		}]
+	}`
+
+	api, err := LoadSource("<unit.limit.shared>.http.json", []byte(source), "unit.limit.shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer delete(APIs, "unit.limit.shared")
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	api.HTTP.Routes(router, "/api")
+
+	request := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/unit/limit/shared/shared", nil)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		return response
+	}
+
+	// the tokens are taken by the script of the store
+	shared.tokens = 2
+	res := request()
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "1", res.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, 200, request().Code)
+	assert.Equal(t, 429, request().Code)
+	assert.Equal(t, []interface{}{float64(2), float64(2) / 60}, shared.args[:2])
+
+	// the store fails, the requests are rejected
+	shared.err = fmt.Errorf("the store is down")
+	assert.Equal(t, 503, request().Code)
+}
+
+// scriptStore the shared store runs the bucket script in memory
+type scriptStore struct {
+	store.Store
+	tokens float64
+	args   []interface{}
+	err    error
+}
+
+func (s *scriptStore) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	s.args = args
+	if s.tokens >= 1 {
+		s.tokens--
+		return []interface{}{int64(1), fmt.Sprintf("%v", s.tokens)}, nil
+	}
+	return []interface{}{int64(0), fmt.Sprintf("%v", s.tokens)}, nil
+}
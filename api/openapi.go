@@ -0,0 +1,508 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var reOperationID = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// OpenAPI generate the OpenAPI 3 document of the loaded apis
+func OpenAPI(option OpenAPIOption) map[string]interface{} {
+	apis := map[string]*API{}
+	ids := option.IDs
+	for _, api := range loaded() {
+		apis[api.ID] = api
+		if len(option.IDs) == 0 {
+			ids = append(ids, api.ID)
+		}
+	}
+	sort.Strings(ids)
+
+	paths := map[string]interface{}{}
+	tags := []interface{}{}
+	tagged := map[string]bool{}
+	for _, id := range ids {
+		api, has := apis[id]
+		if !has {
+			continue
+		}
+
+		tag := api.HTTP.Name
+		if tag == "" {
+			tag = id
+		}
+
+		if !tagged[tag] {
+			tagged[tag] = true
+			item := map[string]interface{}{"name": tag}
+			if api.HTTP.Description != "" {
+				item["description"] = api.HTTP.Description
+			}
+			tags = append(tags, item)
+		}
+
+		for _, path := range api.HTTP.Paths {
+			template, names := openapiPath(filepath.Join(api.HTTP.prefix(option.Root), "/", path.Path))
+			for template, ops := range path.operations(api.HTTP, tag, template, names) {
+				item, has := paths[template].(map[string]interface{})
+				if !has {
+					item = map[string]interface{}{}
+					paths[template] = item
+				}
+
+				for method, op := range ops {
+					op["operationId"] = strings.Trim(reOperationID.ReplaceAllString(fmt.Sprintf("%s_%s_%s", id, method, template), "_"), "_")
+					if api.HTTP.Versioning == "header" {
+						openapiVersion(item, method, op, versionOf(api.HTTP.Version))
+						continue
+					}
+					item[method] = op
+				}
+			}
+		}
+	}
+
+	title := option.Title
+	if title == "" {
+		title = "API"
+	}
+
+	version := option.Version
+	if version == "" {
+		version = "1.0.0"
+	}
+
+	info := map[string]interface{}{"title": title, "version": version}
+	if option.Description != "" {
+		info["description"] = option.Description
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    info,
+		"tags":    tags,
+		"paths":   paths,
+	}
+
+	if len(option.Servers) > 0 {
+		servers := []interface{}{}
+		for _, url := range option.Servers {
+			servers = append(servers, map[string]interface{}{"url": url})
+		}
+		doc["servers"] = servers
+	}
+
+	return doc
+}
+
+// SetOpenAPIRoute serve the OpenAPI document of the loaded apis, the document is generated on each request
+func SetOpenAPIRoute(router gin.IRoutes, route string, option OpenAPIOption) {
+	router.GET(route, func(c *gin.Context) {
+		c.JSON(http.StatusOK, OpenAPI(option))
+	})
+}
+
+// operations the OpenAPI operations of the path, the template => method => operation.
+// the tus upload is created at the path and resumed at the path of the upload id
+func (path Path) operations(api HTTP, tag string, template string, names []string) map[string]map[string]map[string]interface{} {
+	if path.Out.Type == "tus" {
+		return path.tusOperations(api, tag, template, names)
+	}
+
+	ops := map[string]map[string]interface{}{}
+	for _, method := range openapiMethods(path.Method) {
+		ops[method] = path.operation(api, tag, names)
+	}
+	return map[string]map[string]map[string]interface{}{template: ops}
+}
+
+// tusOperations the OpenAPI operations of the tus upload
+func (path Path) tusOperations(api HTTP, tag string, template string, names []string) map[string]map[string]map[string]interface{} {
+	header := func(name string, schema map[string]interface{}, required bool) map[string]interface{} {
+		param := map[string]interface{}{"name": name, "in": "header", "schema": schema}
+		if required {
+			param["required"] = true
+		}
+		return param
+	}
+
+	integer := map[string]interface{}{"type": "integer", "format": "int64"}
+	text := map[string]interface{}{"type": "string"}
+	version := header("Tus-Resumable", map[string]interface{}{"type": "string", "enum": []string{tusVersion}}, true)
+	response := func(code int, headers ...string) map[string]interface{} {
+		res := map[string]interface{}{"description": openapiStatus(code)}
+		if len(headers) > 0 {
+			values := map[string]interface{}{}
+			for _, name := range headers {
+				values[name] = map[string]interface{}{"schema": text}
+			}
+			res["headers"] = values
+		}
+		return res
+	}
+
+	op := func(parameters []interface{}, responses map[string]interface{}) map[string]interface{} {
+		op := path.operation(api, tag, names)
+		delete(op, "requestBody")
+		op["parameters"] = parameters
+		op["responses"] = responses
+		op["x-upload"] = "tus"
+		return op
+	}
+
+	params := []interface{}{}
+	for _, name := range names {
+		params = append(params, map[string]interface{}{"name": name, "in": "path", "required": true, "schema": text})
+	}
+
+	create := op(append(append([]interface{}{}, params...), version, header("Upload-Length", integer, true), header("Upload-Metadata", text, false)), map[string]interface{}{
+		"201": response(201, "Location", "Upload-Expires"),
+		"412": response(412),
+		"413": response(413),
+	})
+
+	params = append(params, map[string]interface{}{"name": "uid", "in": "path", "required": true, "schema": text}, version)
+	offset := op(params, map[string]interface{}{
+		"200": response(200, "Upload-Offset", "Upload-Length", "Upload-Expires", "Upload-Metadata"),
+		"404": response(404),
+		"410": response(410),
+	})
+
+	patch := op(append(append([]interface{}{}, params...), header("Upload-Offset", integer, true), header("Upload-Checksum", text, false)), map[string]interface{}{
+		"204": response(204, "Upload-Offset", "Upload-Expires"),
+		"409": response(409),
+		"413": response(413),
+		"415": response(415),
+		"460": response(460),
+	})
+	patch["requestBody"] = map[string]interface{}{
+		"required": true,
+		"content":  map[string]interface{}{"application/offset+octet-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}},
+	}
+
+	terminate := op(params, map[string]interface{}{"204": response(204), "404": response(404)})
+	return map[string]map[string]map[string]interface{}{
+		template: {"post": create},
+		strings.TrimSuffix(template, "/") + "/{uid}": {"head": offset, "patch": patch, "delete": terminate},
+	}
+}
+
+// openapiVersion merge the operation of the header-versioned api, the operations of the versions are listed in x-versions.
+// the operation of the latest version is served without the Accept-Version header
+func openapiVersion(item map[string]interface{}, method string, op map[string]interface{}, version string) {
+	versions := map[string]interface{}{}
+	latest := version
+	if exists, ok := item[method].(map[string]interface{}); ok {
+		if values, ok := exists["x-versions"].(map[string]interface{}); ok {
+			versions = values
+		}
+		if v, ok := exists["x-version"].(string); ok && compareVersion(v, version) > 0 {
+			latest = v
+		}
+	}
+	versions[version] = op
+
+	names := []string{}
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return compareVersion(names[i], names[j]) < 0 })
+
+	merged := map[string]interface{}{}
+	for key, value := range versions[latest].(map[string]interface{}) {
+		merged[key] = value
+	}
+
+	parameters, _ := merged["parameters"].([]interface{})
+	merged["parameters"] = append(append([]interface{}{}, parameters...), map[string]interface{}{
+		"name": "Accept-Version", "in": "header", "schema": map[string]interface{}{"type": "string", "enum": names},
+		"description": fmt.Sprintf("the version of the api, the default is %s", latest),
+	})
+	merged["x-version"] = latest
+	merged["x-versions"] = versions
+	item[method] = merged
+}
+
+// operation the OpenAPI operation of the path
+func (path Path) operation(api HTTP, tag string, names []string) map[string]interface{} {
+	op := map[string]interface{}{
+		"tags":      []string{tag},
+		"responses": path.responses(),
+	}
+
+	if path.Label != "" {
+		op["summary"] = path.Label
+	}
+
+	if path.Description != "" {
+		op["description"] = path.Description
+	}
+
+	guard := path.Guard
+	if guard == "" {
+		guard = api.Guard
+	}
+	if guard != "" && guard != "-" {
+		op["x-guard"] = guard
+	}
+
+	parameters, body := path.inputs(names)
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+
+	if body != nil {
+		op["requestBody"] = body
+	}
+
+	// the websocket upgrade
+	if path.Out.Type == "websocket" {
+		op["responses"] = map[string]interface{}{"101": map[string]interface{}{"description": openapiStatus(101)}}
+		op["x-websocket"] = true
+		if path.Socket != nil && len(path.Socket.Protocols) > 0 {
+			op["x-websocket-protocols"] = path.Socket.Protocols
+		}
+	}
+
+	return op
+}
+
+// inputs the OpenAPI parameters and the request body of the path, parsed from the in bindings and the request schema
+func (path Path) inputs(names []string) ([]interface{}, map[string]interface{}) {
+	req := path.Request
+	if req == nil {
+		req = &Request{}
+	}
+
+	parameters := []interface{}{}
+	added := map[string]bool{}
+	add := func(in string, name string, rule Param, required bool) {
+		key := fmt.Sprintf("%s.%s", in, strings.ToLower(name))
+		if added[key] {
+			return
+		}
+		added[key] = true
+
+		param := map[string]interface{}{"name": name, "in": in, "schema": rule.schema("string")}
+		if rule.Description != "" {
+			param["description"] = rule.Description
+		}
+		if required || rule.Required {
+			param["required"] = true
+		}
+		parameters = append(parameters, param)
+	}
+
+	// the path parameters are always required
+	for _, name := range names {
+		add("path", name, req.Params[name], true)
+	}
+
+	payload := map[string]interface{}{}
+	form := map[string]interface{}{}
+	files := false
+	whole := false
+	raw := false
+	for _, value := range path.In {
+		v, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		switch v {
+		case ":payload":
+			whole = true
+			continue
+		case ":body":
+			raw = true
+			continue
+		}
+
+		arg := strings.Split(v, ".")
+		if len(arg) != 2 {
+			continue
+		}
+
+		name := arg[1]
+		switch arg[0] {
+		case "$query":
+			add("query", name, req.Query[name], false)
+		case "$header":
+			add("header", name, req.Headers[name], false)
+		case "$payload":
+			payload[name] = map[string]interface{}{}
+		case "$form":
+			form[name] = req.Form[name].schema("string")
+		case "$file":
+			form[name] = map[string]interface{}{"type": "string", "format": "binary"}
+			files = true
+		}
+	}
+
+	// the parameters declared but not bound, eg: read with :query or :headers
+	for _, name := range sortedKeys(req.Query) {
+		add("query", name, req.Query[name], false)
+	}
+
+	for _, name := range sortedKeys(req.Headers) {
+		add("header", name, req.Headers[name], false)
+	}
+
+	formRequired := []string{}
+	for _, name := range sortedKeys(req.Form) {
+		if _, has := form[name]; !has {
+			form[name] = req.Form[name].schema("string")
+		}
+		if req.Form[name].Required {
+			formRequired = append(formRequired, name)
+		}
+	}
+
+	content := map[string]interface{}{}
+	switch {
+	case req.Payload != nil:
+		content["application/json"] = map[string]interface{}{"schema": req.Payload}
+	case len(payload) > 0:
+		content["application/json"] = map[string]interface{}{"schema": map[string]interface{}{"type": "object", "properties": payload}}
+	case whole:
+		content["application/json"] = map[string]interface{}{"schema": map[string]interface{}{"type": "object"}}
+	}
+
+	if len(form) > 0 {
+		schema := map[string]interface{}{"type": "object", "properties": form}
+		if len(formRequired) > 0 {
+			schema["required"] = formRequired
+		}
+
+		contentType := "application/x-www-form-urlencoded"
+		if files {
+			contentType = "multipart/form-data"
+		}
+		content[contentType] = map[string]interface{}{"schema": schema}
+	}
+
+	if raw && len(content) == 0 {
+		content["*/*"] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+	}
+
+	if len(content) == 0 {
+		return parameters, nil
+	}
+	return parameters, map[string]interface{}{"content": content}
+}
+
+// responses the OpenAPI responses of the path
+func (path Path) responses() map[string]interface{} {
+	if path.Out.Redirect != nil {
+		code := path.Out.Redirect.Code
+		if code == 0 {
+			code = 301
+		}
+
+		location := map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		if path.Out.Redirect.Location != "" {
+			location["description"] = path.Out.Redirect.Location
+		}
+		return map[string]interface{}{
+			fmt.Sprintf("%d", code): map[string]interface{}{
+				"description": openapiStatus(code),
+				"headers":     map[string]interface{}{"Location": location},
+			},
+		}
+	}
+
+	status := path.Out.Status
+	if status == 0 {
+		status = 200
+	}
+
+	contentType := path.Out.Type
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	schema := path.Out.Schema
+	if schema == nil {
+		schema = map[string]interface{}{}
+	}
+
+	response := map[string]interface{}{
+		"description": openapiStatus(status),
+		"content":     map[string]interface{}{contentType: map[string]interface{}{"schema": schema}},
+	}
+
+	if len(path.Out.Headers) > 0 {
+		headers := map[string]interface{}{}
+		for name := range path.Out.Headers {
+			headers[name] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		}
+		response["headers"] = headers
+	}
+
+	return map[string]interface{}{fmt.Sprintf("%d", status): response}
+}
+
+// schema the JSON schema of the parameter, the type is used if the schema has no type
+func (param Param) schema(defaults string) map[string]interface{} {
+	schema := map[string]interface{}{}
+	for key, value := range param.Schema {
+		schema[key] = value
+	}
+
+	if _, has := schema["type"]; !has {
+		schema["type"] = defaults
+		if param.Type != "" {
+			schema["type"] = param.Type
+		}
+	}
+	return schema
+}
+
+// openapiPath convert the route to the OpenAPI path template, returns the template and the parameter names
+// eg: /user/:id/*path => /user/{id}/{path}
+func openapiPath(route string) (string, []string) {
+	names := []string{}
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			names = append(names, name)
+			segments[i] = fmt.Sprintf("{%s}", name)
+		}
+	}
+	return strings.Join(segments, "/"), names
+}
+
+// openapiMethods the OpenAPI methods of the path method
+func openapiMethods(method string) []string {
+	method = strings.ToLower(method)
+	if method == "any" {
+		return []string{"get", "post", "put", "patch", "delete"}
+	}
+	return []string{method}
+}
+
+// openapiStatus the description of the status code
+func openapiStatus(code int) string {
+	if text := http.StatusText(code); text != "" {
+		return text
+	}
+	return fmt.Sprintf("%d", code)
+}
+
+// sortedKeys the sorted keys of the params
+func sortedKeys(params map[string]Param) []string {
+	keys := []string{}
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/kun/any"
+)
+
+func TestOpenAPI(t *testing.T) {
+	prepareOpenAPI(t)
+	defer delete(APIs, "unit.openapi")
+
+	doc := OpenAPI(OpenAPIOption{Title: "Unit", Root: "/api", Servers: []string{"https://example.com"}, IDs: []string{"unit.openapi"}})
+	data, err := jsoniter.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := any.Of(map[string]interface{}{}).MapStr()
+	err = jsoniter.Unmarshal(data, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot := res.Dot()
+
+	assert.Equal(t, "3.0.3", dot.Get("openapi"))
+	assert.Equal(t, "Unit", dot.Get("info.title"))
+	assert.Equal(t, "https://example.com", dot.Get("servers.0.url"))
+	assert.Equal(t, "pets", dot.Get("tags.0.name"))
+
+	// the path parameters, query and headers
+	get := "paths./api/unit/openapi/pets/{id}.get."
+	assert.Equal(t, "Get a pet", dot.Get(get+"summary"))
+	assert.Equal(t, "bearer-jwt", dot.Get(get+"x-guard"))
+	assert.Equal(t, "id", dot.Get(get+"parameters.0.name"))
+	assert.Equal(t, "path", dot.Get(get+"parameters.0.in"))
+	assert.Equal(t, true, dot.Get(get+"parameters.0.required"))
+	assert.Equal(t, "integer", dot.Get(get+"parameters.0.schema.type"))
+	assert.Equal(t, "fields", dot.Get(get+"parameters.1.name"))
+	assert.Equal(t, "query", dot.Get(get+"parameters.1.in"))
+	assert.Equal(t, "string", dot.Get(get+"parameters.1.schema.type"))
+	assert.Equal(t, "X-Tenant", dot.Get(get+"parameters.2.name"))
+	assert.Equal(t, "header", dot.Get(get+"parameters.2.in"))
+	assert.Equal(t, true, dot.Get(get+"parameters.2.required"))
+	assert.Equal(t, "object", dot.Get(get+"responses.200.content.application/json.schema.type"))
+	assert.Nil(t, dot.Get(get+"requestBody"))
+
+	// the request body
+	post := "paths./api/unit/openapi/pets.post."
+	assert.Nil(t, dot.Get(post+"x-guard"))
+	assert.Equal(t, []interface{}{"name"}, dot.Get(post+"requestBody.content.application/json.schema.required"))
+	assert.Equal(t, "Created", dot.Get(post+"responses.201.description"))
+
+	upload := "paths./api/unit/openapi/pets/{id}/photo.post.requestBody.content.multipart/form-data.schema."
+	assert.Equal(t, "binary", dot.Get(upload+"properties.photo.format"))
+	assert.Equal(t, "string", dot.Get(upload+"properties.caption.type"))
+
+	// the any method and the redirect
+	assert.NotNil(t, dot.Get("paths./api/unit/openapi/search.get"))
+	assert.NotNil(t, dot.Get("paths./api/unit/openapi/search.delete"))
+	assert.Equal(t, "/index.html", dot.Get("paths./api/unit/openapi/home.get.responses.302.headers.Location.description"))
+
+	// the operation ids are unique
+	assert.Equal(t, "unit_openapi_get_api_unit_openapi_pets_id", dot.Get(get+"operationId"))
+
+	// the process and the route
+	output, err := process.New("api.OpenAPI", map[string]interface{}{"ids": []string{"unit.openapi"}}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, output.(map[string]interface{})["paths"], "/unit/openapi/pets")
+
+	router := gin.New()
+	SetOpenAPIRoute(router, "/openapi.json", OpenAPIOption{IDs: []string{"unit.openapi"}})
+	response := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	router.ServeHTTP(response, req)
+	assert.Equal(t, 200, response.Code)
+	assert.Contains(t, response.Body.String(), `"openapi":"3.0.3"`)
+}
+
+func prepareOpenAPI(t *testing.T) {
+	source := `{
+		"name": "pets", "version": "1.0.0", "description": "The pets", "guard": "bearer-jwt",
+		"paths": [
+			{
+				"path": "/pets/:id", "method": "GET", "label": "Get a pet", "process": "models.pet.Find",
+				"in": ["$param.id", "$query.fields", ":headers"],
+				"request": {
+					"params": {"id": {"type": "integer", "description": "the pet id"}},
+					"headers": {"X-Tenant": {"required": true}}
+				},
+				"out": {"status": 200, "type": "application/json", "schema": {"type": "object"}}
+			},
+			{
+				"path": "/pets", "method": "POST", "guard": "-", "process": "models.pet.Create", "in": [":payload"],
+				"request": {"payload": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}},
+				"out": {"status": 201}
+			},
+			{
+				"path": "/pets/:id/photo", "method": "POST", "process": "scripts.pet.Upload",
+				"in": ["$param.id", "$file.photo", "$form.caption"]
+			},
+			{ "path": "/search", "method": "ANY", "process": "scripts.pet.Search", "in": [":query"] },
+			{
+				"path": "/home", "method": "GET", "process": "scripts.pet.Home",
+				"out": {"redirect": {"code": 302, "location": "/index.html"}}
+			}
+		]
+	}`
+
+	_, err := LoadSource("<unit.openapi>.http.json", []byte(source), "unit.openapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	sources := map[string]string{
+		"unit.openapi.tus": `{
+			"name": "files", "version": "1.0.0", "group": "files",
+			"paths": [{"path": "/uploads", "method": "POST", "process": "scripts.file.Uploaded", "out": {"type": "tus"}}]
+		}`,
+		"unit.openapi.socket": `{
+			"name": "chat", "version": "1.0.0", "group": "chat",
+			"paths": [{"path": "/ws", "method": "GET", "process": "scripts.chat.Message", "socket": {"protocols": ["chat"]}, "out": {"type": "websocket"}}]
+		}`,
+		"unit.openapi.v1": `{
+			"name": "orders", "version": "1.0.0", "group": "orders", "versioning": "header",
+			"paths": [{"path": "/:id", "method": "GET", "label": "Order v1", "process": "scripts.order.Find", "in": ["$param.id"]}]
+		}`,
+		"unit.openapi.v2": `{
+			"name": "orders", "version": "2.0.0", "group": "orders", "versioning": "header",
+			"paths": [{"path": "/:id", "method": "GET", "label": "Order v2", "process": "scripts.order.Find", "in": ["$param.id"]}]
+		}`,
+	}
+
+	ids := []string{}
+	for id, source := range sources {
+		_, err := LoadSource("<"+id+">.http.json", []byte(source), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer delete(APIs, id)
+		ids = append(ids, id)
+	}
+
+	data, err := jsoniter.Marshal(OpenAPI(OpenAPIOption{Root: "/api", IDs: ids}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := any.Of(map[string]interface{}{}).MapStr()
+	err = jsoniter.Unmarshal(data, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot := res.Dot()
+
+	// the tus upload is created and resumed
+	assert.NotNil(t, dot.Get("paths./api/files/uploads.post.responses.201.headers.Location"))
+	assert.Equal(t, "Tus-Resumable", dot.Get("paths./api/files/uploads.post.parameters.0.name"))
+	assert.NotNil(t, dot.Get("paths./api/files/uploads/{uid}.head.responses.200.headers.Upload-Offset"))
+	assert.NotNil(t, dot.Get("paths./api/files/uploads/{uid}.patch.requestBody.content.application/offset+octet-stream"))
+	assert.NotNil(t, dot.Get("paths./api/files/uploads/{uid}.delete.responses.204"))
+	assert.Equal(t, "uid", dot.Get("paths./api/files/uploads/{uid}.patch.parameters.0.name"))
+
+	// the websocket upgrade
+	assert.Equal(t, true, dot.Get("paths./api/chat/ws.get.x-websocket"))
+	assert.Equal(t, "Switching Protocols", dot.Get("paths./api/chat/ws.get.responses.101.description"))
+	assert.Equal(t, []interface{}{"chat"}, dot.Get("paths./api/chat/ws.get.x-websocket-protocols"))
+
+	// the header-versioned operations are merged
+	get := "paths./api/orders/{id}.get."
+	assert.Equal(t, "Order v2", dot.Get(get+"summary"))
+	assert.Equal(t, "v2", dot.Get(get+"x-version"))
+	assert.Equal(t, "Order v1", dot.Get(get+"x-versions.v1.summary"))
+	assert.Equal(t, "Order v2", dot.Get(get+"x-versions.v2.summary"))
+	assert.Equal(t, "Accept-Version", dot.Get(get+"parameters.1.name"))
+	assert.Equal(t, []interface{}{"v1", "v2"}, dot.Get(get+"parameters.1.schema.enum"))
+}
@@ -1,10 +1,19 @@
 package api
 
-import "github.com/yaoapp/gou/process"
+import (
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/kun/exception"
+)
 
 func init() {
 	process.RegisterGroup("api", map[string]process.Handler{
-		"list": processList,
+		"list":        processList,
+		"openapi":     processOpenAPI,
+		"purge":       processPurge,
+		"push":        processPush,
+		"pushsession": processPushSession,
+		"sockets":     processSockets,
 	})
 }
 
@@ -18,17 +27,80 @@ func processList(process *process.Process) interface{} {
 	// List all
 	apis := map[string]*API{}
 	if len(ids) == 0 {
-		for id, api := range APIs {
-			apis[id] = api
+		for _, api := range loaded() {
+			apis[api.ID] = api
 		}
 		return apis
 	}
 
 	// List by ids
-	for _, id := range ids {
-		if api, has := APIs[id]; has {
-			apis[id] = api
+	for _, api := range loaded() {
+		for _, id := range ids {
+			if api.ID == id {
+				apis[id] = api
+			}
 		}
 	}
 	return apis
 }
+
+// api.OpenAPI
+// args: [option?] {title, version, description, root, servers, ids}
+func processOpenAPI(process *process.Process) interface{} {
+	option := OpenAPIOption{}
+	if process.NumOfArgs() > 0 {
+		data, err := jsoniter.Marshal(process.Args[0])
+		if err != nil {
+			exception.New("the option is invalid: %s", 400, err.Error()).Throw()
+		}
+
+		err = jsoniter.Unmarshal(data, &option)
+		if err != nil {
+			exception.New("the option is invalid: %s", 400, err.Error()).Throw()
+		}
+	}
+	return OpenAPI(option)
+}
+
+// api.Purge
+// args: [prefix?] the key prefix of the cached responses, all the cached responses if empty
+func processPurge(process *process.Process) interface{} {
+	prefix := ""
+	if process.NumOfArgs() > 0 {
+		prefix = process.ArgsString(0)
+	}
+
+	count, err := Purge(prefix)
+	if err != nil {
+		exception.New(err.Error(), 500).Throw()
+	}
+	return count
+}
+
+// api.Push
+// args: [id, message] send the message to the websocket connection
+func processPush(process *process.Process) interface{} {
+	process.ValidateArgNums(2)
+	err := Push(process.ArgsString(0), process.Args[1])
+	if err != nil {
+		exception.New(err.Error(), 404).Throw()
+	}
+	return nil
+}
+
+// api.PushSession
+// args: [sid, message] send the message to the websocket connections of the session, returns the number of the sent connections
+func processPushSession(process *process.Process) interface{} {
+	process.ValidateArgNums(2)
+	return PushSession(process.ArgsString(0), process.Args[1])
+}
+
+// api.Sockets
+// args: [sid?] the ids of the websocket connections of the session, all the connections if empty
+func processSockets(process *process.Process) interface{} {
+	sid := ""
+	if process.NumOfArgs() > 0 {
+		sid = process.ArgsString(0)
+	}
+	return Sockets(sid)
+}
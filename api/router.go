@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yaoapp/gou/application"
+	"github.com/yaoapp/kun/log"
+)
+
+// routers the dynamic routers, rebuilt when the apis are reloaded or unloaded
+var routers = []*Router{}
+var routersLock sync.Mutex
+
+// routerKeys the context key of the values set by the outer engine
+type routerKeys struct{}
+
+// Router the dynamic router, the routes of the apis are served by a swappable engine behind one catch-all route
+type Router struct {
+	root   string
+	allows []string
+	engine atomic.Value // *gin.Engine
+	lock   sync.Mutex
+}
+
+// SetDynamicRoutes set the api routes with a dynamic router, the routes take effect at runtime when the apis are changed
+func SetDynamicRoutes(router *gin.Engine, path string, allows ...string) (*Router, error) {
+	r := &Router{root: path, allows: allows}
+	err := r.Rebuild()
+	if err != nil {
+		return nil, err
+	}
+
+	routersLock.Lock()
+	routers = append(routers, r)
+	routersLock.Unlock()
+
+	route := strings.TrimSuffix(path, "/") + "/*any"
+	router.Any(route, r.handle)
+	return r, nil
+}
+
+// Rebuild build the routes of the loaded apis and swap them atomically, the routes are not changed if an error occurs
+func (r *Router) Rebuild() (err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	engine := gin.New()
+	engine.Use(recovery(), restoreKeys)
+
+	// gin panics on the conflict routes
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("[API] Rebuild routes Error: %v", recovered)
+			log.Error("%s", err.Error())
+			dropVersionRoutes(engine)
+		}
+	}()
+
+	for _, api := range loaded() {
+		api.HTTP.Routes(engine, r.root, r.allows...)
+	}
+
+	old, _ := r.engine.Load().(*gin.Engine)
+	r.engine.Store(engine)
+	if old != nil {
+		dropVersionRoutes(old)
+	}
+	return nil
+}
+
+// handle serve the request with the current engine, the values set by the outer engine are passed to the handlers
+func (r *Router) handle(c *gin.Context) {
+	engine := r.engine.Load().(*gin.Engine)
+	req := c.Request
+	if len(c.Keys) > 0 {
+		req = req.WithContext(context.WithValue(req.Context(), routerKeys{}, c.Keys))
+	}
+	engine.ServeHTTP(c.Writer, req)
+}
+
+// restoreKeys restore the values set by the outer engine
+func restoreKeys(c *gin.Context) {
+	keys, ok := c.Request.Context().Value(routerKeys{}).(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for key, value := range keys {
+		c.Set(key, value)
+	}
+}
+
+// Watch reload the apis when the api files are changed, and rebuild the dynamic routers. it blocks until interrupted
+func Watch(interrupt chan uint8) error {
+	return application.App.Watch(func(event string, name string) {
+		id, ok := watchID(name)
+		if !ok {
+			return
+		}
+
+		switch event {
+		case "CREATE", "WRITE":
+			_, err := Load(name, id)
+			if err != nil {
+				log.Error("[API] Reload %s Error: %s", id, err.Error())
+				return
+			}
+			rebuild()
+
+		case "REMOVE", "RENAME":
+			Unload(id)
+		}
+	}, interrupt)
+}
+
+// rebuild rebuild all the dynamic routers
+func rebuild() {
+	routersLock.Lock()
+	defer routersLock.Unlock()
+	for _, r := range routers {
+		r.Rebuild()
+	}
+}
+
+// dropVersionRoutes remove the negotiated routes of the engine
+func dropVersionRoutes(engine *gin.Engine) {
+	prefix := fmt.Sprintf("%p|", engine)
+	versionRoutesLock.Lock()
+	defer versionRoutesLock.Unlock()
+	for key := range versionRoutes {
+		if strings.HasPrefix(key, prefix) {
+			delete(versionRoutes, key)
+		}
+	}
+}
+
+// watchID the api id of the file, eg: /apis/foo/bar.http.yao => foo.bar
+func watchID(file string) (string, bool) {
+	file = filepath.ToSlash(file)
+	if !strings.HasPrefix(file, "/apis/") {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(file, "/apis/")
+	for _, ext := range []string{".http.yao", ".http.json", ".http.jsonc"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.ReplaceAll(strings.TrimSuffix(name, ext), "/", "."), true
+		}
+	}
+	return "", false
+}
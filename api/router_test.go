@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/process"
+)
+
+func TestRouter(t *testing.T) {
+	process.Register("unit.api.args", func(process *process.Process) interface{} {
+		return process.Args
+	})
+	defer Unload("unit.router.pets")
+	defer Unload("unit.router.orders")
+
+	load := func(id string, source string) {
+		_, err := LoadSource("<"+id+">.http.json", []byte(source), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	load("unit.router.pets", `{
+		"name": "pets", "version": "1.0.0", "group": "pets", "guard": "-",
+		"paths": [{"path": "/:id", "method": "GET", "process": "unit.api.args", "in": ["v1", "$param.id"], "out": {"status": 200, "type": "application/json"}}]
+	}`)
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("__sid", "unit-sid") })
+	r, err := SetDynamicRoutes(router, "/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		return response
+	}
+
+	res := request("/api/pets/1")
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, `["v1","1"]`, res.Body.String())
+	assert.Equal(t, 404, request("/api/orders/1").Code)
+
+	// change the path and add an api
+	load("unit.router.pets", `{
+		"name": "pets", "version": "2.0.0", "group": "pets", "guard": "-",
+		"paths": [{"path": "/:id", "method": "GET", "process": "unit.api.args", "in": ["v2", "$param.id"], "out": {"status": 200, "type": "application/json"}}]
+	}`)
+	load("unit.router.orders", `{
+		"name": "orders", "version": "1.0.0", "group": "orders", "guard": "-",
+		"paths": [{"path": "/:id", "method": "GET", "process": "unit.api.args", "in": ["$session.id", "$param.id"], "out": {"status": 200, "type": "application/json"}}]
+	}`)
+	assert.Nil(t, r.Rebuild())
+	assert.Equal(t, `["v2","1"]`, request("/api/pets/1").Body.String())
+	assert.Equal(t, 200, request("/api/orders/1").Code)
+
+	// the conflict routes keep the current routes
+	load("unit.router.conflict", `{
+		"name": "conflict", "version": "1.0.0", "group": "pets", "guard": "-",
+		"paths": [{"path": "/:id", "method": "GET", "process": "unit.api.args", "in": ["conflict"], "out": {"status": 200, "type": "application/json"}}]
+	}`)
+	assert.NotNil(t, r.Rebuild())
+	assert.Equal(t, `["v2","1"]`, request("/api/pets/1").Body.String())
+	delete(APIs, "unit.router.conflict")
+
+	// remove the api
+	Unload("unit.router.orders")
+	assert.Equal(t, 404, request("/api/orders/1").Code)
+	assert.Equal(t, 200, request("/api/pets/1").Code)
+}
+
+func TestRouterWatchID(t *testing.T) {
+	id, ok := watchID("/apis/foo/bar.http.yao")
+	assert.True(t, ok)
+	assert.Equal(t, "foo.bar", id)
+
+	id, ok = watchID("/apis/user.http.json")
+	assert.True(t, ok)
+	assert.Equal(t, "user", id)
+
+	_, ok = watchID("/models/user.mod.yao")
+	assert.False(t, ok)
+}
+
+func TestRouterConcurrent(t *testing.T) {
+	process.Register("unit.api.args", func(process *process.Process) interface{} {
+		return process.Args
+	})
+	defer Unload("unit.router.concurrent")
+
+	source := `{
+		"name": "concurrent", "version": "1.0.0", "group": "concurrent", "guard": "-", "allows": ["a.com"],
+		"paths": [
+			{"path": "/:id", "method": "GET", "process": "unit.api.args", "out": {"status": 200, "type": "application/json"}},
+			{"path": "/:id", "method": "POST", "process": "unit.api.args", "out": {"status": 200, "type": "application/json"}}
+		]
+	}`
+
+	gin.SetMode(gin.ReleaseMode)
+	r1, err := SetDynamicRoutes(gin.New(), "/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := SetDynamicRoutes(gin.New(), "/v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the apis are loaded and the routers are rebuilt at the same time
+	done := make(chan error, 30)
+	for i := 0; i < 10; i++ {
+		go func() {
+			_, err := LoadSource("<unit.router.concurrent>.http.json", []byte(source), "unit.router.concurrent")
+			done <- err
+		}()
+		go func() { done <- r1.Rebuild() }()
+		go func() { done <- r2.Rebuild() }()
+	}
+
+	for i := 0; i < 30; i++ {
+		assert.Nil(t, <-done)
+	}
+}
@@ -0,0 +1,307 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/kun/log"
+)
+
+// sockets the websocket connections, the connection id => connection
+var sockets = map[string]*socket{}
+var socketsLock sync.RWMutex
+
+// socket the websocket connection
+type socket struct {
+	id   string
+	sid  string
+	path string
+	conn *websocket.Conn
+	send chan []byte
+	done chan struct{}
+	once sync.Once
+}
+
+// Push send the message to the websocket connection, the message is sent as text, the maps and the arrays are encoded as JSON
+func Push(id string, message interface{}) error {
+	socketsLock.RLock()
+	s, has := sockets[id]
+	socketsLock.RUnlock()
+	if !has {
+		return fmt.Errorf("the connection %s does not exist", id)
+	}
+	return s.push(message)
+}
+
+// PushSession send the message to the websocket connections of the session, returns the number of the sent connections
+func PushSession(sid string, message interface{}) int {
+	count := 0
+	for _, id := range Sockets(sid) {
+		if err := Push(id, message); err != nil {
+			log.Error("[API] push %s: %s", id, err.Error())
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// Sockets the ids of the websocket connections of the session, all the connections if the session id is empty
+func Sockets(sid string) []string {
+	socketsLock.RLock()
+	defer socketsLock.RUnlock()
+	ids := []string{}
+	for id, s := range sockets {
+		if sid == "" || s.sid == sid {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// socketHandler upgrade the connection to the websocket, the in arguments are bound at connect time.
+// the connection is accepted from the same origin and the allowed origins only
+func (path Path) socketHandler(getArgs argsHandler, allows []string) func(c *gin.Context) {
+	option := Socket{}
+	if path.Socket != nil {
+		option = *path.Socket
+	}
+
+	if option.MaxMessage <= 0 {
+		option.MaxMessage = 65536
+	}
+
+	if option.Ping <= 0 {
+		option.Ping = 30
+	}
+
+	allowsMap := map[string]bool{}
+	for _, allow := range allows {
+		allowsMap[allow] = true
+	}
+
+	upgrader := websocket.Upgrader{
+		Subprotocols: option.Protocols,
+		CheckOrigin:  func(r *http.Request) bool { return socketOrigin(r, allowsMap) },
+	}
+
+	return func(c *gin.Context) {
+		if !websocket.IsWebSocketUpgrade(c.Request) {
+			c.JSON(400, gin.H{"code": 400, "message": "the request should upgrade to websocket"})
+			c.Abort()
+			return
+		}
+
+		args := getArgs(c)
+		sid := c.GetString("__sid")
+		global := globalOf(c)
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			log.Error("[Socket] %s %s", path.Path, err.Error())
+			c.Abort()
+			return
+		}
+
+		s := &socket{id: uuid.NewString(), sid: sid, path: path.Path, conn: conn, send: make(chan []byte, 256), done: make(chan struct{})}
+		go s.writePump(time.Duration(option.Ping) * time.Second)
+		defer s.close(websocket.CloseNormalClosure, "")
+
+		// the connect process rejects the connection by the error, the connection is reachable after accepted
+		if option.Connect != "" {
+			_, err := socketCall(option.Connect, sid, global, append([]interface{}{s.id}, args...))
+			if err != nil {
+				log.Error("[Socket] %s connect: %s", path.Path, err.Error())
+				s.close(websocket.ClosePolicyViolation, err.Error())
+				return
+			}
+		}
+
+		socketsLock.Lock()
+		sockets[s.id] = s
+		socketsLock.Unlock()
+
+		if option.Close != "" {
+			defer func() {
+				s.close(websocket.CloseNormalClosure, "")
+				_, err := socketCall(option.Close, sid, global, append([]interface{}{s.id}, args...))
+				if err != nil {
+					log.Error("[Socket] %s close: %s", path.Path, err.Error())
+				}
+			}()
+		}
+
+		pongWait := time.Duration(option.Ping) * time.Second * 2
+		conn.SetReadLimit(option.MaxMessage)
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		conn.SetPongHandler(func(string) error { return conn.SetReadDeadline(time.Now().Add(pongWait)) })
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+					log.Error("[Socket] %s %s", path.Path, err.Error())
+				}
+				return
+			}
+
+			if path.Process == "" {
+				continue
+			}
+
+			res, err := socketCall(path.Process, sid, global, append([]interface{}{s.id, socketMessage(data)}, args...))
+			if err != nil {
+				log.Error("[Socket] %s %s", path.Path, err.Error())
+				res = map[string]interface{}{"code": 500, "message": err.Error()}
+			}
+
+			if res != nil {
+				if err := s.push(res); err != nil {
+					log.Error("[Socket] %s %s", path.Path, err.Error())
+				}
+			}
+		}
+	}
+}
+
+// push queue the message to send
+func (s *socket) push(message interface{}) error {
+	data, err := socketData(message)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-s.done:
+		return fmt.Errorf("the connection %s is closed", s.id)
+	default:
+	}
+
+	select {
+	case s.send <- data:
+		return nil
+	case <-s.done:
+		return fmt.Errorf("the connection %s is closed", s.id)
+	default:
+		return fmt.Errorf("the connection %s is busy", s.id)
+	}
+}
+
+// writePump write the queued messages and the pings, the connection has one writer only
+func (s *socket) writePump(ping time.Duration) {
+	ticker := time.NewTicker(ping)
+	defer ticker.Stop()
+	for {
+		select {
+		case data := <-s.send:
+			s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := s.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				if err == websocket.ErrCloseSent {
+					return
+				}
+				log.Error("[Socket] %s %s", s.path, err.Error())
+				return
+			}
+
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// close remove the connection, send the close message and close the connection
+func (s *socket) close(code int, reason string) {
+	s.once.Do(func() {
+		socketsLock.Lock()
+		delete(sockets, s.id)
+		socketsLock.Unlock()
+
+		close(s.done)
+		s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+		s.conn.Close()
+	})
+}
+
+// socketOrigin check the origin of the upgrade request, the requests without the origin are not from the browsers
+func socketOrigin(r *http.Request, allowsMap map[string]bool) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	port := u.Port()
+	host := u.Hostname()
+	if port != "" && port != "80" && port != "443" {
+		host = fmt.Sprintf("%s:%s", host, port)
+	}
+	return allowsMap[host]
+}
+
+// socketCall run the process with the session and the global data of the connection
+func socketCall(name string, sid string, global map[string]interface{}, args []interface{}) (interface{}, error) {
+	p, err := process.Of(name, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Dispose()
+
+	if sid != "" {
+		p.WithSID(sid)
+	}
+
+	if global != nil {
+		p.WithGlobal(global)
+	}
+
+	err = p.Execute()
+	if err != nil {
+		return nil, err
+	}
+	return p.Value(), nil
+}
+
+// socketMessage the message as the process argument, the JSON message is decoded
+func socketMessage(data []byte) interface{} {
+	var value interface{}
+	if jsoniter.Valid(data) {
+		if err := jsoniter.Unmarshal(data, &value); err == nil {
+			return value
+		}
+	}
+	return string(data)
+}
+
+// socketData the message as the text to send
+func socketData(message interface{}) ([]byte, error) {
+	switch v := message.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	}
+	return jsoniter.Marshal(message)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/kun/exception"
+)
+
+func TestSocket(t *testing.T) {
+	events := prepareSocket(t)
+	defer delete(APIs, "unit.socket")
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("__sid", "unit-socket-sid") })
+	APIs["unit.socket"].HTTP.Routes(router, "/api")
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/unit/socket/chat/general"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the connect process binds the in arguments
+	// the connection is not reachable before the connect process accepts it
+	connected := events.wait(t, "connect")
+	assert.Equal(t, "general", connected[1])
+	assert.Empty(t, connected[2])
+	id := connected[0].(string)
+
+	// the message process responses
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"text": "hello"}`))
+	_, data, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"room":"general","text":"hello"}`, string(data))
+	assert.Equal(t, []string{id}, Sockets("unit-socket-sid"))
+
+	// push from the other process
+	_, err = process.New("api.Push", id, "pushed").Exec()
+	assert.Nil(t, err)
+	_, data, _ = conn.ReadMessage()
+	assert.Equal(t, "pushed", string(data))
+
+	count, err := process.New("api.PushSession", "unit-socket-sid", map[string]interface{}{"n": 1}).Exec()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	_, data, _ = conn.ReadMessage()
+	assert.Equal(t, `{"n":1}`, string(data))
+
+	// the close process
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	conn.Close()
+	closed := events.wait(t, "close")
+	assert.Equal(t, id, closed[0])
+	assert.Empty(t, Sockets("unit-socket-sid"))
+	assert.NotNil(t, Push(id, "closed"))
+
+	// the connect process rejects the connection
+	conn, _, err = websocket.DefaultDialer.Dial(url+"-denied", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+	conn.Close()
+
+	// the cross-site connection is rejected
+	_, res, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": []string{"http://evil.com"}})
+	assert.NotNil(t, err)
+	assert.Equal(t, 403, res.StatusCode)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "yao.run"
+	req.Header.Set("Origin", "http://yao.run")
+	assert.True(t, socketOrigin(req, nil))
+	req.Header.Set("Origin", "https://trusted.com")
+	assert.False(t, socketOrigin(req, nil))
+	assert.True(t, socketOrigin(req, map[string]bool{"trusted.com": true}))
+	req.Header.Set("Origin", "http://trusted.com:8080")
+	assert.False(t, socketOrigin(req, map[string]bool{"trusted.com": true}))
+	assert.True(t, socketOrigin(req, map[string]bool{"trusted.com:8080": true}))
+
+	// the websocket should be GET
+	_, err = LoadSource("<unit.invalid>.http.json", []byte(`{"name": "invalid", "paths": [{"path": "/", "method": "POST", "out": {"type": "websocket"}}]}`), "unit.invalid")
+	assert.NotNil(t, err)
+}
+
+type socketEvents struct {
+	sync.Mutex
+	events map[string]chan []interface{}
+}
+
+func (events *socketEvents) add(name string, args []interface{}) {
+	events.Lock()
+	ch := events.events[name]
+	events.Unlock()
+	ch <- args
+}
+
+func (events *socketEvents) wait(t *testing.T, name string) []interface{} {
+	select {
+	case args := <-events.events[name]:
+		return args
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the %s process is not called", name)
+	}
+	return nil
+}
+
+func prepareSocket(t *testing.T) *socketEvents {
+	events := &socketEvents{events: map[string]chan []interface{}{"connect": make(chan []interface{}, 4), "close": make(chan []interface{}, 4)}}
+	process.RegisterGroup("unit.socket", map[string]process.Handler{
+		"connect": func(process *process.Process) interface{} {
+			if strings.HasSuffix(process.ArgsString(1), "-denied") {
+				exception.New("the room is denied", 403).Throw()
+			}
+			events.add("connect", append(process.Args, Sockets("unit-socket-sid")))
+			return nil
+		},
+		"message": func(process *process.Process) interface{} {
+			message := process.ArgsMap(1)
+			return map[string]interface{}{"room": process.ArgsString(2), "text": message["text"]}
+		},
+		"close": func(process *process.Process) interface{} {
+			events.add("close", process.Args)
+			return nil
+		},
+	})
+
+	source := `{
+		"name": "socket", "version": "1.0.0", "guard": "-",
+		"paths": [{
+			"path": "/chat/:room", "method": "GET", "process": "unit.socket.message", "in": ["$param.room"],
+			"socket": {"connect": "unit.socket.connect", "close": "unit.socket.close", "ping": 5},
+			"out": {"type": "websocket"}
+		}]
+	}`
+
+	_, err := LoadSource("<unit.socket>.http.json", []byte(source), "unit.socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
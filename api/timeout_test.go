@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/process"
+)
+
+func TestPathLimits(t *testing.T) {
+	router := prepareLimits(t)
+	defer delete(APIs, "unit.limits")
+
+	request := func(req *http.Request) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		return response
+	}
+
+	// the timeout of the path
+	req, _ := http.NewRequest("GET", "/api/unit/limits/sleep", nil)
+	res := request(req)
+	assert.Equal(t, 504, res.Code)
+
+	// the timeout of the group
+	req, _ = http.NewRequest("GET", "/api/unit/limits/fast", nil)
+	res = request(req)
+	assert.Equal(t, 200, res.Code)
+
+	// the max body size of the path overrides the group
+	req, _ = http.NewRequest("POST", "/api/unit/limits/large", strings.NewReader(`{"name": "a long name but allowed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	assert.Equal(t, 200, request(req).Code)
+
+	// the body without the content length
+	req, _ = http.NewRequest("POST", "/api/unit/limits/body", io.NopCloser(strings.NewReader(strings.Repeat("x", 64))))
+	req.ContentLength = -1
+	assert.Equal(t, 413, request(req).Code)
+
+	req, _ = http.NewRequest("POST", "/api/unit/limits/large", io.NopCloser(strings.NewReader(`{"name": "`+strings.Repeat("x", 128)+`"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	assert.Equal(t, 413, request(req).Code)
+
+	// the max file size
+	upload := func(sizes ...int) int {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("name", "unit")
+		for i, size := range sizes {
+			name := "file"
+			if i > 0 {
+				name = fmt.Sprintf("file%d", i)
+			}
+			part, _ := writer.CreateFormFile(name, "unit.txt")
+			part.Write(bytes.Repeat([]byte("x"), size))
+		}
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/api/unit/limits/upload", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		res := request(req)
+		if res.Code == 200 {
+			assert.Contains(t, res.Body.String(), "unit.txt")
+		}
+		return res.Code
+	}
+	assert.Equal(t, 200, upload(8))
+	assert.Equal(t, 200, upload(8, 16))
+	assert.Equal(t, 413, upload(32))
+	assert.Equal(t, 413, upload(8, 32))
+
+	// the invalid settings
+	_, err := LoadSource("<unit.invalid>.http.json", []byte(`{"name": "invalid", "paths": [{"path": "/", "method": "GET", "timeout": "-1s"}]}`), "unit.invalid")
+	assert.NotNil(t, err)
+}
+
+func prepareLimits(t *testing.T) *gin.Engine {
+	process.Register("unit.api.sleep", func(process *process.Process) interface{} {
+		time.Sleep(500 * time.Millisecond)
+		return "done"
+	})
+
+	process.Register("unit.api.args", func(process *process.Process) interface{} {
+		return process.Args
+	})
+
+	source := `{
+		"name": "limits", "version": "1.0.0", "guard": "-", "timeout": "5s", "maxBodySize": 16,
+		"paths": [
+			{"path": "/sleep", "method": "GET", "process": "unit.api.sleep", "timeout": "50ms", "out": {"status": 200, "type": "application/json"}},
+			{"path": "/fast", "method": "GET", "process": "unit.api.args", "in": ["fast"], "out": {"status": 200, "type": "application/json"}},
+			{"path": "/large", "method": "POST", "process": "unit.api.args", "in": [":payload"], "maxBodySize": 64, "out": {"status": 200, "type": "application/json"}},
+			{"path": "/body", "method": "POST", "process": "unit.api.args", "in": [":body"], "out": {"status": 200, "type": "application/json"}},
+			{"path": "/upload", "method": "POST", "process": "unit.api.args", "in": ["$file.file"], "maxBodySize": 1024, "maxFileSize": 16, "out": {"status": 200, "type": "application/json"}}
+		]
+	}`
+
+	api, err := LoadSource("<unit.limits>.http.json", []byte(source), "unit.limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(recovery())
+	api.HTTP.Routes(router, "/api")
+	return router
+}
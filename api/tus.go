@@ -0,0 +1,473 @@
+package api
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/fs"
+	"github.com/yaoapp/gou/types"
+	"github.com/yaoapp/kun/log"
+)
+
+// tusVersion the supported version of the tus protocol
+const tusVersion = "1.0.0"
+
+// tusExtensions the supported extensions of the tus protocol
+const tusExtensions = "creation,termination,checksum,expiration"
+
+// tusHeaders the tus headers allowed and exposed to the cross domain requests
+const tusHeaders = "Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Tus-Checksum-Algorithm, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Expires, Upload-Checksum, Location"
+
+// tusLocks the locks of the uploads, the chunks of an upload are checked and written one by one. upload id => *sync.Mutex
+var tusLocks sync.Map
+
+// tusPart the file name of the receiving chunk in the temp directory, it is not a chunk file until verified
+const tusPart = "receiving.part"
+
+// tusInfo the information of the upload, saved beside the chunk files
+type tusInfo struct {
+	UID      string `json:"uid"`
+	Length   int64  `json:"length"`
+	Metadata string `json:"metadata,omitempty"` // the Upload-Metadata header
+	Name     string `json:"name,omitempty"`     // the filename in the metadata
+	Expires  int64  `json:"expires"`
+}
+
+// tusHandler the tus resumable upload, the chunks are saved and merged by the fs upload.
+// POST creates the upload, HEAD responses the offset, PATCH appends the chunk and DELETE terminates the upload.
+// the process runs when the upload is completed, args: [file, ...in]
+func (path Path) tusHandler(getArgs argsHandler) func(c *gin.Context) {
+	option := Upload{}
+	if path.Upload != nil {
+		option = *path.Upload
+	}
+
+	if option.Store == "" {
+		option.Store = "system"
+	}
+
+	expiration := 24 * time.Hour
+	if option.Expiration != "" {
+		expiration, _ = time.ParseDuration(option.Expiration)
+	}
+
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		header.Set("Tus-Resumable", tusVersion)
+		header.Set("Access-Control-Expose-Headers", tusHeaders)
+
+		if c.Request.Method == "OPTIONS" {
+			header.Set("Tus-Version", tusVersion)
+			header.Set("Tus-Extension", tusExtensions)
+			header.Set("Tus-Checksum-Algorithm", "md5,sha1,sha256")
+			if option.MaxSize > 0 {
+				header.Set("Tus-Max-Size", fmt.Sprintf("%d", option.MaxSize))
+			}
+			header.Set("Access-Control-Allow-Headers", allowHeaders+", "+tusHeaders)
+			header.Set("Access-Control-Allow-Methods", "POST, HEAD, PATCH, DELETE, OPTIONS")
+			c.AbortWithStatus(204)
+			return
+		}
+
+		if c.GetHeader("Tus-Resumable") != tusVersion {
+			header.Set("Tus-Version", tusVersion)
+			tusError(c, 412, fmt.Sprintf("the tus version %s is not supported", c.GetHeader("Tus-Resumable")))
+			return
+		}
+
+		stor, err := fs.Get(option.Store)
+		if err != nil {
+			tusError(c, 500, err.Error())
+			return
+		}
+
+		if c.Request.Method == "POST" {
+			path.tusCreate(c, stor, option, expiration, getArgs)
+			return
+		}
+
+		uid := c.Param("uid")
+		info, err := tusLoad(stor, uid)
+		if err != nil {
+			tusError(c, 404, fmt.Sprintf("the upload %s does not exist", uid))
+			return
+		}
+
+		if info.Expires > 0 && time.Now().Unix() > info.Expires {
+			lock := tusLocker(uid)
+			lock.Lock()
+			tusRemove(stor, uid)
+			lock.Unlock()
+			tusError(c, 410, fmt.Sprintf("the upload %s is expired", uid))
+			return
+		}
+
+		switch c.Request.Method {
+		case "HEAD":
+			progress, err := fs.UploadProgress(stor, fs.UploadDir(uid))
+			if err != nil {
+				tusError(c, 500, err.Error())
+				return
+			}
+
+			header.Set("Cache-Control", "no-store")
+			header.Set("Upload-Offset", fmt.Sprintf("%d", progress.Uploaded))
+			header.Set("Upload-Length", fmt.Sprintf("%d", info.Length))
+			header.Set("Upload-Expires", time.Unix(info.Expires, 0).UTC().Format(http.TimeFormat))
+			if info.Metadata != "" {
+				header.Set("Upload-Metadata", info.Metadata)
+			}
+			c.AbortWithStatus(200)
+
+		case "PATCH":
+			path.tusAppend(c, stor, info, expiration, getArgs)
+
+		case "DELETE":
+			lock := tusLocker(uid)
+			lock.Lock()
+			tusRemove(stor, uid)
+			lock.Unlock()
+			c.AbortWithStatus(204)
+
+		default:
+			tusError(c, 405, fmt.Sprintf("the method %s is not allowed", c.Request.Method))
+		}
+	}
+}
+
+// tusCreate create the upload by the Upload-Length header, responses the upload url in the Location header
+func (path Path) tusCreate(c *gin.Context, stor fs.FileSystem, option Upload, expiration time.Duration, getArgs argsHandler) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		tusError(c, 400, "the Upload-Length header is invalid")
+		return
+	}
+
+	if option.MaxSize > 0 && length > option.MaxSize {
+		tusError(c, 413, fmt.Sprintf("the upload is larger than %d bytes", option.MaxSize))
+		return
+	}
+
+	metadata := c.GetHeader("Upload-Metadata")
+	values, err := tusMetadata(metadata)
+	if err != nil {
+		tusError(c, 400, err.Error())
+		return
+	}
+
+	info := tusInfo{
+		UID:      strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Length:   length,
+		Metadata: metadata,
+		Name:     values["filename"],
+		Expires:  time.Now().Add(expiration).Unix(),
+	}
+
+	err = stor.MkdirAll(fs.UploadDir(info.UID), uint32(os.ModePerm))
+	if err != nil {
+		tusError(c, 500, err.Error())
+		return
+	}
+
+	err = tusSave(stor, info)
+	if err != nil {
+		tusError(c, 500, err.Error())
+		return
+	}
+
+	c.Writer.Header().Set("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+info.UID)
+	c.Writer.Header().Set("Upload-Expires", time.Unix(info.Expires, 0).UTC().Format(http.TimeFormat))
+
+	// the empty upload is completed at the creation
+	if length == 0 {
+		path.tusComplete(c, stor, info, getArgs)
+		if c.IsAborted() {
+			return
+		}
+	}
+	c.AbortWithStatus(201)
+}
+
+// tusAppend append the chunk at the Upload-Offset, the chunk is verified by the Upload-Checksum header
+func (path Path) tusAppend(c *gin.Context, stor fs.FileSystem, info tusInfo, expiration time.Duration, getArgs argsHandler) {
+	if c.ContentType() != "application/offset+octet-stream" {
+		tusError(c, 415, "the Content-Type should be application/offset+octet-stream")
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		tusError(c, 400, "the Upload-Offset header is invalid")
+		return
+	}
+
+	if offset > info.Length {
+		tusError(c, 409, fmt.Sprintf("the offset %d is larger than the upload length %d", offset, info.Length))
+		return
+	}
+
+	var h hash.Hash
+	var sum string
+	if checksum := c.GetHeader("Upload-Checksum"); checksum != "" {
+		h, sum, err = tusHash(checksum)
+		if err != nil {
+			tusError(c, 400, err.Error())
+			return
+		}
+	}
+
+	// the concurrent requests of the upload are conflicted
+	lock := tusLocker(info.UID)
+	if !lock.TryLock() {
+		tusError(c, 423, fmt.Sprintf("the upload %s is locked by another request", info.UID))
+		return
+	}
+	defer lock.Unlock()
+
+	dir := fs.UploadDir(info.UID)
+	progress, err := fs.UploadProgress(stor, dir)
+	if err != nil {
+		tusError(c, 404, fmt.Sprintf("the upload %s does not exist", info.UID))
+		return
+	}
+
+	if progress.Uploaded != offset {
+		c.Writer.Header().Set("Upload-Offset", fmt.Sprintf("%d", progress.Uploaded))
+		tusError(c, 409, fmt.Sprintf("the offset %d does not match the upload offset %d", offset, progress.Uploaded))
+		return
+	}
+
+	// stream the body to the part file while hashing, read one more byte to check the chunk is larger than the rest
+	part := filepath.ToSlash(filepath.Join(dir, tusPart))
+	var reader io.Reader = io.LimitReader(c.Request.Body, info.Length-offset+1)
+	if h != nil {
+		reader = io.TeeReader(reader, h)
+	}
+
+	size, err := stor.Write(part, reader, uint32(os.ModePerm))
+	if err != nil {
+		stor.Remove(part)
+		code := 500
+		if tooLarge(err) {
+			code = 413
+		}
+		tusError(c, code, err.Error())
+		return
+	}
+
+	if offset+int64(size) > info.Length {
+		stor.Remove(part)
+		tusError(c, 413, fmt.Sprintf("the chunk is larger than the rest of the upload %d bytes", info.Length-offset))
+		return
+	}
+
+	if h != nil && base64.StdEncoding.EncodeToString(h.Sum(nil)) != sum {
+		stor.Remove(part)
+		tusError(c, 460, "the checksum of the chunk is mismatched")
+		return
+	}
+
+	// the chunk file name of the fs upload, eg: 0-1023_4096.chunk
+	if size > 0 {
+		chunk := types.UploadFile{Range: fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(size)-1, info.Length)}
+		err = stor.Move(part, filepath.ToSlash(filepath.Join(dir, chunk.ChunkFileName())))
+	} else {
+		err = stor.Remove(part)
+	}
+
+	if err != nil {
+		tusError(c, 500, err.Error())
+		return
+	}
+
+	offset = offset + int64(size)
+	info.Expires = time.Now().Add(expiration).Unix()
+	c.Writer.Header().Set("Upload-Offset", fmt.Sprintf("%d", offset))
+	c.Writer.Header().Set("Upload-Expires", time.Unix(info.Expires, 0).UTC().Format(http.TimeFormat))
+
+	if offset == info.Length {
+		path.tusComplete(c, stor, info, getArgs)
+		if c.IsAborted() {
+			return
+		}
+		c.AbortWithStatus(204)
+		return
+	}
+
+	err = tusSave(stor, info)
+	if err != nil {
+		tusError(c, 500, err.Error())
+		return
+	}
+	c.AbortWithStatus(204)
+}
+
+// tusComplete merge the chunks to the file and run the process of the path with the file
+func (path Path) tusComplete(c *gin.Context, stor fs.FileSystem, info tusInfo, getArgs argsHandler) {
+	dir := fs.UploadDir(info.UID)
+	filename := filepath.ToSlash(filepath.Join("/", time.Now().Format("20060102"), info.UID+filepath.Ext(info.Name)))
+
+	// the chunks are kept to complete again by the PATCH request at the end offset
+	err := tusMerge(stor, dir, filename)
+	if err != nil {
+		stor.Remove(filename)
+		tusError(c, 500, err.Error())
+		return
+	}
+	tusRemove(stor, info.UID)
+
+	if path.Process == "" {
+		return
+	}
+
+	metadata, _ := tusMetadata(info.Metadata)
+	file := map[string]interface{}{
+		"uid":      info.UID,
+		"name":     info.Name,
+		"path":     filename,
+		"size":     info.Length,
+		"metadata": metadata,
+	}
+
+	ctx, cancel := path.context(c)
+	defer cancel()
+	path.runProcess(ctx, c, func(c *gin.Context) []interface{} {
+		return append([]interface{}{file}, getArgs(c)...)
+	})
+}
+
+// tusMerge write the chunk files to the file in order, the chunk files are kept
+func tusMerge(stor fs.FileSystem, dir string, dst string) error {
+	files, err := fs.ChunkFiles(stor, dir)
+	if err != nil {
+		return err
+	}
+
+	_, err = stor.WriteFile(dst, []byte{}, uint32(os.ModePerm))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		reader, err := stor.ReadCloser(file)
+		if err != nil {
+			return err
+		}
+
+		_, err = stor.Append(dst, reader, uint32(os.ModePerm))
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tusLoad load the information of the upload
+func tusLoad(stor fs.FileSystem, uid string) (tusInfo, error) {
+	info := tusInfo{}
+	if uid == "" || strings.ContainsAny(uid, "/\\.") {
+		return info, fmt.Errorf("the upload id %s is invalid", uid)
+	}
+
+	data, err := stor.ReadFile(fs.UploadDir(uid) + ".tus")
+	if err != nil {
+		return info, err
+	}
+
+	err = jsoniter.Unmarshal(data, &info)
+	return info, err
+}
+
+// tusSave save the information of the upload
+func tusSave(stor fs.FileSystem, info tusInfo) error {
+	data, err := jsoniter.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = stor.WriteFile(fs.UploadDir(info.UID)+".tus", data, uint32(os.ModePerm))
+	return err
+}
+
+// tusRemove remove the chunks and the information of the upload
+func tusRemove(stor fs.FileSystem, uid string) {
+	dir := fs.UploadDir(uid)
+	if err := stor.RemoveAll(dir); err != nil {
+		log.Error("[API] tus remove %s: %s", dir, err.Error())
+	}
+
+	if err := stor.Remove(dir + ".tus"); err != nil {
+		log.Error("[API] tus remove %s.tus: %s", dir, err.Error())
+	}
+	tusLocks.Delete(uid)
+}
+
+// tusMetadata parse the Upload-Metadata header, eg: filename d29ybGRfZG9taW5hdGlvbl9wbGFuLnBkZg==,is_confidential
+func tusMetadata(header string) (map[string]string, error) {
+	values := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return values, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			values[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("the Upload-Metadata %s is invalid", parts[0])
+			}
+			values[parts[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("the Upload-Metadata header is invalid")
+		}
+	}
+	return values, nil
+}
+
+// tusHash the hash and the expected checksum of the Upload-Checksum header, eg: sha1 Kq5sNclPz7QV2+lfQIuc6R7oRu0=
+func tusHash(header string) (hash.Hash, string, error) {
+	parts := strings.Fields(header)
+	if len(parts) != 2 {
+		return nil, "", fmt.Errorf("the Upload-Checksum header is invalid")
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "md5":
+		return md5.New(), parts[1], nil
+	case "sha1":
+		return sha1.New(), parts[1], nil
+	case "sha256":
+		return sha256.New(), parts[1], nil
+	}
+	return nil, "", fmt.Errorf("the checksum algorithm %s is not supported", parts[0])
+}
+
+// tusLocker the lock of the upload
+func tusLocker(uid string) *sync.Mutex {
+	lock, _ := tusLocks.LoadOrStore(uid, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// tusError response the error of the tus request
+func tusError(c *gin.Context, code int, message string) {
+	c.JSON(code, gin.H{"code": code, "message": message})
+	c.Abort()
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/fs"
+	"github.com/yaoapp/gou/fs/system"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/kun/exception"
+)
+
+func TestTus(t *testing.T) {
+	router, files := prepareTus(t)
+	defer delete(APIs, "unit.tus")
+	defer delete(fs.FileSystems, "unittus")
+
+	request := func(method string, path string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		return response
+	}
+
+	patch := func(location string, offset int, data []byte, checksum string) *httptest.ResponseRecorder {
+		headers := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": fmt.Sprintf("%d", offset)}
+		if checksum != "" {
+			headers["Upload-Checksum"] = checksum
+		}
+		return request("PATCH", location, data, headers)
+	}
+
+	// the discovery
+	res := request("OPTIONS", "/api/unit/tus/files", nil, nil)
+	assert.Equal(t, 204, res.Code)
+	assert.Equal(t, "1.0.0", res.Header().Get("Tus-Version"))
+	assert.Equal(t, "creation,termination,checksum,expiration", res.Header().Get("Tus-Extension"))
+	assert.Equal(t, "64", res.Header().Get("Tus-Max-Size"))
+
+	// the version and the size
+	assert.Equal(t, 412, request("POST", "/api/unit/tus/files", nil, map[string]string{"Tus-Resumable": "0.2.0", "Upload-Length": "10"}).Code)
+	assert.Equal(t, 413, request("POST", "/api/unit/tus/files", nil, map[string]string{"Upload-Length": "100"}).Code)
+
+	// the creation
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("hello.txt")) + ",private"
+	res = request("POST", "/api/unit/tus/files", nil, map[string]string{"Upload-Length": "11", "Upload-Metadata": metadata})
+	assert.Equal(t, 201, res.Code)
+	location := res.Header().Get("Location")
+	assert.Regexp(t, `^/api/unit/tus/files/[0-9a-f]{32}$`, location)
+	assert.NotEmpty(t, res.Header().Get("Upload-Expires"))
+
+	// the offset
+	res = request("HEAD", location, nil, nil)
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "0", res.Header().Get("Upload-Offset"))
+	assert.Equal(t, "11", res.Header().Get("Upload-Length"))
+	assert.Equal(t, metadata, res.Header().Get("Upload-Metadata"))
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+
+	// the chunks with the checksum
+	sum := sha1.Sum([]byte("hello "))
+	res = patch(location, 0, []byte("hello "), "sha1 "+base64.StdEncoding.EncodeToString(sum[:]))
+	assert.Equal(t, 204, res.Code)
+	assert.Equal(t, "6", res.Header().Get("Upload-Offset"))
+
+	assert.Equal(t, 460, patch(location, 6, []byte("world"), "sha1 "+base64.StdEncoding.EncodeToString(sum[:])).Code)
+	assert.Equal(t, 400, patch(location, 6, []byte("world"), "crc32 AAAA").Code)
+	assert.Equal(t, 409, patch(location, 3, []byte("world"), "").Code)
+	assert.Equal(t, 413, patch(location, 6, []byte("world!"), "").Code)
+
+	// the upload is locked by another request
+	lock := tusLocker(location[len(location)-32:])
+	lock.Lock()
+	assert.Equal(t, 423, patch(location, 6, []byte("world"), "").Code)
+	lock.Unlock()
+	assert.Equal(t, "6", request("HEAD", location, nil, nil).Header().Get("Upload-Offset"))
+
+	// the completion runs the process
+	res = patch(location, 6, []byte("world"), "")
+	assert.Equal(t, 204, res.Code)
+	assert.Equal(t, "11", res.Header().Get("Upload-Offset"))
+	assert.Len(t, *files, 1)
+	file := (*files)[0]
+	assert.Equal(t, "hello.txt", file["name"])
+	assert.Equal(t, map[string]string{"filename": "hello.txt", "private": ""}, file["metadata"])
+
+	stor := fs.FileSystems["unittus"]
+	data, err := stor.ReadFile(file["path"].(string))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(data))
+	assert.Equal(t, 404, request("HEAD", location, nil, nil).Code)
+
+	// the termination
+	res = request("POST", "/api/unit/tus/files", nil, map[string]string{"Upload-Length": "5"})
+	location = res.Header().Get("Location")
+	assert.Equal(t, 204, patch(location, 0, []byte("ab"), "").Code)
+	assert.Equal(t, 204, request("DELETE", location, nil, nil).Code)
+	assert.Equal(t, 404, request("HEAD", location, nil, nil).Code)
+
+	// the chunks are kept if the merge fails, the upload completes again at the end offset
+	res = request("POST", "/api/unit/tus/files", nil, map[string]string{"Upload-Length": "3"})
+	location = res.Header().Get("Location")
+	blocked := "/" + time.Now().Format("20060102") + "/" + location[len(location)-32:]
+	assert.Nil(t, stor.MkdirAll(blocked+"/dir", uint32(os.ModePerm)))
+	assert.Equal(t, 500, patch(location, 0, []byte("abc"), "").Code)
+	assert.Equal(t, "3", request("HEAD", location, nil, nil).Header().Get("Upload-Offset"))
+	assert.Nil(t, stor.RemoveAll(blocked))
+	assert.Equal(t, 204, patch(location, 3, nil, "").Code)
+	data, err = stor.ReadFile(blocked)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(data))
+	assert.Equal(t, 404, request("HEAD", location, nil, nil).Code)
+
+	// the cleanup of the expired uploads
+	res = request("POST", "/api/unit/tus/files", nil, map[string]string{"Upload-Length": "5"})
+	location = res.Header().Get("Location")
+	uid := location[len(location)-32:]
+	assert.Nil(t, stor.MkdirAll(fs.UploadDir("partial"), uint32(os.ModePerm)))
+	count, err := process.New("fs.unittus.CleanUploads", 0).Exec()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 200, request("HEAD", location, nil, nil).Code)
+
+	info, err := tusLoad(stor, uid)
+	assert.Nil(t, err)
+	info.Expires = time.Now().Add(-time.Minute).Unix()
+	assert.Nil(t, tusSave(stor, info))
+	count, err = process.New("fs.unittus.CleanUploads").Exec()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 404, request("HEAD", location, nil, nil).Code)
+}
+
+func prepareTus(t *testing.T) (*gin.Engine, *[]map[string]interface{}) {
+	fs.Register("unittus", system.New(t.TempDir()))
+
+	files := []map[string]interface{}{}
+	process.Register("unit.api.uploaded", func(process *process.Process) interface{} {
+		files = append(files, process.ArgsMap(0))
+		return nil
+	})
+
+	source := `{
+		"name": "tus", "version": "1.0.0", "guard": "-",
+		"paths": [{
+			"path": "/files", "method": "POST", "process": "unit.api.uploaded",
+			"upload": {"store": "unittus", "maxSize": 64, "expiration": "1h"},
+			"out": {"type": "tus"}
+		}]
+	}`
+
+	api, err := LoadSource("<unit.tus>.http.json", []byte(source), "unit.tus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(recovery())
+	api.HTTP.Routes(router, "/api")
+	return router, &files
+}
+
+func TestTusOptions(t *testing.T) {
+	fs.Register("unittus", system.New(t.TempDir()))
+	defer delete(fs.FileSystems, "unittus")
+	process.Register("unit.api.deny", func(process *process.Process) interface{} {
+		exception.New("denied", 403).Throw()
+		return nil
+	})
+
+	source := `{
+		"name": "tus", "version": "1.0.0", "guard": "unit.api.deny",
+		"paths": [{
+			"path": "/files", "method": "POST", "process": "unit.api.uploaded",
+			"upload": {"store": "unittus"}, "out": {"type": "tus"}
+		}]
+	}`
+
+	api, err := LoadSource("<unit.tus.guarded>.http.json", []byte(source), "unit.tus.guarded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer delete(APIs, "unit.tus.guarded")
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(recovery())
+	api.HTTP.Routes(router, "/api")
+
+	for _, path := range []string{"/api/unit/tus/guarded/files", "/api/unit/tus/guarded/files/0123456789abcdef0123456789abcdef"} {
+		req, _ := http.NewRequest("OPTIONS", path, nil)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		assert.Equal(t, 204, res.Code)
+		assert.Equal(t, "1.0.0", res.Header().Get("Tus-Version"))
+	}
+
+	req, _ := http.NewRequest("POST", "/api/unit/tus/guarded/files", nil)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Length", "5")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, 403, res.Code)
+}
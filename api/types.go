@@ -16,12 +16,28 @@ type API struct {
 
 // HTTP http 协议服务
 type HTTP struct {
-	Name        string `json:"name"`
-	Version     string `json:"version"`
-	Description string `json:"description,omitempty"`
-	Group       string `json:"group,omitempty"`
-	Guard       string `json:"guard,omitempty"`
-	Paths       []Path `json:"paths,omitempty"`
+	Name        string       `json:"name"`
+	Version     string       `json:"version"`
+	Description string       `json:"description,omitempty"`
+	Group       string       `json:"group,omitempty"`
+	Guard       string       `json:"guard,omitempty"`
+	Limit       *Limit       `json:"limit,omitempty"`
+	Versioning  string       `json:"versioning,omitempty"`  // path: mount at /v1/<group>, header: negotiate with the Accept-Version header
+	Deprecated  *Deprecation `json:"deprecated,omitempty"`  // the version is deprecated
+	Allows      []string     `json:"allows,omitempty"`      // the CORS allows shared by the paths
+	Timeout     string       `json:"timeout,omitempty"`     // the timeout shared by the paths, eg: 30s
+	MaxBodySize int64        `json:"maxBodySize,omitempty"` // the max request body size in bytes shared by the paths
+	Paths       []Path       `json:"paths,omitempty"`
+	id          string       // the api id, the scope of the rate limits
+	engine      *gin.Engine
+	options     map[string]bool // the paths of the registered cors options of the routes
+}
+
+// Deprecation the deprecation of the API version
+type Deprecation struct {
+	Date   string `json:"date,omitempty"`   // the deprecation date, eg: 2024-01-01
+	Sunset string `json:"sunset,omitempty"` // the date the version will be removed, eg: 2024-06-30
+	Link   string `json:"link,omitempty"`   // the link of the successor version or the migration guide
 }
 
 // Path HTTP Path
@@ -34,16 +50,75 @@ type Path struct {
 	Guard          string        `json:"guard,omitempty"`
 	In             []interface{} `json:"in,omitempty"`
 	Out            Out           `json:"out,omitempty"`
+	Request        *Request      `json:"request,omitempty"`
+	Limit          *Limit        `json:"limit,omitempty"`
+	Socket         *Socket       `json:"socket,omitempty"`      // the websocket settings, out.type should be websocket
+	Timeout        string        `json:"timeout,omitempty"`     // the timeout of the process, overrides the timeout of the group, eg: 10s
+	MaxBodySize    int64         `json:"maxBodySize,omitempty"` // the max request body size in bytes, overrides the maxBodySize of the group
+	MaxFileSize    int64         `json:"maxFileSize,omitempty"` // the max size in bytes of each uploaded file
+	Upload         *Upload       `json:"upload,omitempty"`      // the resumable upload settings, out.type should be tus
 	ProcessHandler bool          `json:"processHandler,omitempty"`
 }
 
+// Socket the websocket settings of the path, the messages are handled by the process of the path, args: [id, message, ...in]
+type Socket struct {
+	Connect    string   `json:"connect,omitempty"`    // the process called when the connection is opened, args: [id, ...in]. the connection can be pushed after it returns
+	Close      string   `json:"close,omitempty"`      // the process called when the connection is closed, args: [id, ...in]
+	Protocols  []string `json:"protocols,omitempty"`  // the subprotocols
+	MaxMessage int64    `json:"maxMessage,omitempty"` // the max size of the message in bytes, the default is 65536
+	Ping       int      `json:"ping,omitempty"`       // the ping interval in seconds, the default is 30
+}
+
+// Upload the tus resumable upload settings of the path, the process runs when the upload is completed, args: [file, ...in]
+type Upload struct {
+	Store      string `json:"store,omitempty"`      // the file system name, the default is system
+	MaxSize    int64  `json:"maxSize,omitempty"`    // the max size of the upload in bytes
+	Expiration string `json:"expiration,omitempty"` // the partial upload expires after the last chunk, the default is 24h
+}
+
+// Request the request schema of the path
+type Request struct {
+	Params  map[string]Param       `json:"params,omitempty"`  // the path parameters, $param.name
+	Query   map[string]Param       `json:"query,omitempty"`   // the query string, $query.name
+	Headers map[string]Param       `json:"headers,omitempty"` // the request headers, $header.name
+	Form    map[string]Param       `json:"form,omitempty"`    // the form fields, $form.name
+	Payload map[string]interface{} `json:"payload,omitempty"` // the JSON schema of the request body
+}
+
+// Param the rule of the request parameter
+type Param struct {
+	Description string                 `json:"description,omitempty"`
+	Type        string                 `json:"type,omitempty"` // string, integer, number, boolean, array, object
+	Required    bool                   `json:"required,omitempty"`
+	Schema      map[string]interface{} `json:"schema,omitempty"` // the JSON schema of the parameter, the type is merged
+}
+
+// Limit the rate limit, a token bucket refilled with the requests per window, the burst is the size of the bucket
+type Limit struct {
+	Requests int    `json:"requests"`        // the requests allowed per window
+	Window   string `json:"window"`          // the window, eg: 1s, 1m, 1h
+	Burst    int    `json:"burst,omitempty"` // the requests allowed at once, the default is the requests
+	Key      string `json:"key,omitempty"`   // ip (default), header.<name>, session.<name>, global.<name>, user
+	Store    string `json:"store,omitempty"` // the store of the counters, an in-memory store (per process) or a redis store (shared by the nodes). the default is the in-memory store
+}
+
 // Out http 输出
 type Out struct {
-	Status   int               `json:"status"`
-	Type     string            `json:"type,omitempty"`
-	Body     interface{}       `json:"body,omitempty"`
-	Headers  map[string]string `json:"headers,omitempty"`
-	Redirect *Redirect         `json:"redirect,omitempty"`
+	Status   int                    `json:"status"`
+	Type     string                 `json:"type,omitempty"`
+	Body     interface{}            `json:"body,omitempty"`
+	Headers  map[string]string      `json:"headers,omitempty"`
+	Redirect *Redirect              `json:"redirect,omitempty"`
+	Schema   map[string]interface{} `json:"schema,omitempty"` // the JSON schema of the response body
+	Cache    *Cache                 `json:"cache,omitempty"`
+}
+
+// Cache the response cache of the GET path
+type Cache struct {
+	TTL   int      `json:"ttl,omitempty"`   // the seconds to cache, 0 is never expired
+	Key   string   `json:"key,omitempty"`   // the key template over the bound inputs, eg: pets:{{ $param.id }}, the default is the path, the inputs and the session
+	Vary  []string `json:"vary,omitempty"`  // the request headers vary the response
+	Store string   `json:"store,omitempty"` // the store of the cache, the default is the in-memory store
 }
 
 // Redirect out redirect
@@ -58,3 +133,13 @@ type ssEventData struct {
 }
 
 type argsHandler func(c *gin.Context) []interface{}
+
+// OpenAPIOption the option of the OpenAPI document
+type OpenAPIOption struct {
+	Title       string   `json:"title,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Root        string   `json:"root,omitempty"`    // the root path of the routes, eg: /api
+	Servers     []string `json:"servers,omitempty"` // the server urls
+	IDs         []string `json:"ids,omitempty"`     // the api ids, all the loaded apis if empty
+}
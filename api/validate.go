@@ -0,0 +1,192 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/helper"
+)
+
+// Violation the violation of the request schema
+type Violation struct {
+	In      string `json:"in"`             // params, query, headers, form, payload
+	Name    string `json:"name,omitempty"` // the parameter name
+	Message string `json:"message"`
+}
+
+// validateHandler validate the request with the request schema of the path before the process runs.
+// responses 400 if the payload is not a valid JSON, 422 with the violations if the request breaks the rules
+func (path Path) validateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		violations := []Violation{}
+		req := path.Request
+
+		for _, name := range sortedKeys(req.Params) {
+			value, has := c.Params.Get(name)
+			violations = append(violations, req.Params[name].validate("params", name, []string{value}, has && value != "")...)
+		}
+
+		query := c.Request.URL.Query()
+		for _, name := range sortedKeys(req.Query) {
+			values, has := query[name]
+			violations = append(violations, req.Query[name].validate("query", name, values, has)...)
+		}
+
+		for _, name := range sortedKeys(req.Headers) {
+			values := c.Request.Header.Values(name)
+			violations = append(violations, req.Headers[name].validate("headers", name, values, len(values) > 0)...)
+		}
+
+		if len(req.Form) > 0 {
+			for _, name := range sortedKeys(req.Form) {
+				values, has := c.GetPostFormArray(name)
+				violations = append(violations, req.Form[name].validate("form", name, values, has)...)
+			}
+		}
+
+		if req.Payload != nil {
+			payload, err := path.payload(c)
+			if err != nil && tooLarge(err) {
+				c.JSON(413, gin.H{"code": 413, "message": err.Error()})
+				c.Abort()
+				return
+			}
+
+			if err != nil {
+				c.JSON(400, gin.H{"code": 400, "message": fmt.Sprintf("the payload is invalid: %s", err.Error())})
+				c.Abort()
+				return
+			}
+
+			for _, message := range helper.ValidateSchema(req.Payload, payload, "payload") {
+				violations = append(violations, Violation{In: "payload", Message: message})
+			}
+		}
+
+		if len(violations) > 0 {
+			c.JSON(422, gin.H{"code": 422, "message": "the request is invalid", "errors": violations})
+			c.Abort()
+			return
+		}
+	}
+}
+
+// payload read the JSON payload, the body is restored for the handler
+func (path Path) payload(c *gin.Context) (interface{}, error) {
+	if c.Request.Body == nil {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	var payload interface{}
+	err = jsoniter.Unmarshal(data, &payload)
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// validate the values of the parameter, the values are cast to the type of the parameter
+func (param Param) validate(in string, name string, values []string, has bool) []Violation {
+	if !has {
+		if param.Required {
+			return []Violation{{In: in, Name: name, Message: fmt.Sprintf("%s.%s is required", in, name)}}
+		}
+		return nil
+	}
+
+	schema := param.schema("string")
+	value, err := param.cast(schema, values)
+	if err != nil {
+		return []Violation{{In: in, Name: name, Message: fmt.Sprintf("%s.%s %s", in, name, err.Error())}}
+	}
+
+	violations := []Violation{}
+	for _, message := range helper.ValidateSchema(schema, value, fmt.Sprintf("%s.%s", in, name)) {
+		violations = append(violations, Violation{In: in, Name: name, Message: message})
+	}
+	return violations
+}
+
+// cast the string values to the type of the schema
+func (param Param) cast(schema map[string]interface{}, values []string) (interface{}, error) {
+	typ, _ := schema["type"].(string)
+	if typ == "array" {
+		itemType := "string"
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			if t, ok := items["type"].(string); ok {
+				itemType = t
+			}
+		}
+
+		// the comma separated values, eg: ?ids=1,2,3
+		if len(values) == 1 && strings.Contains(values[0], ",") {
+			values = strings.Split(values[0], ",")
+		}
+
+		res := []interface{}{}
+		for _, value := range values {
+			v, err := castString(itemType, value)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		}
+		return res, nil
+	}
+
+	value := ""
+	if len(values) > 0 {
+		value = values[0]
+	}
+	return castString(typ, value)
+}
+
+// castString cast the string value to the type
+func castString(typ string, value string) (interface{}, error) {
+	switch typ {
+	case "integer":
+		v, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("should be integer")
+		}
+		return v, nil
+
+	case "number":
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("should be number")
+		}
+		return v, nil
+
+	case "boolean":
+		v, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("should be boolean")
+		}
+		return v, nil
+
+	case "object":
+		v := map[string]interface{}{}
+		err := jsoniter.UnmarshalFromString(value, &v)
+		if err != nil {
+			return nil, fmt.Errorf("should be object")
+		}
+		return v, nil
+	}
+	return value, nil
+}
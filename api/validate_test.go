@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/process"
+)
+
+func TestValidate(t *testing.T) {
+	router := prepareValidate(t)
+	defer delete(APIs, "unit.validate")
+
+	// the valid request
+	body := `{"name": "Max", "tags": ["cat"]}`
+	req, _ := http.NewRequest("POST", "/api/unit/validate/pets/12?limit=10&ids=1,2", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+	res := validateResponse(router, req)
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, `["12","10","Max"]`, res.Body.String())
+
+	// the violations
+	body = `{"tags": "cat", "color": "red"}`
+	req, _ = http.NewRequest("POST", "/api/unit/validate/pets/abc?limit=500&ids=1,x", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	res = validateResponse(router, req)
+	assert.Equal(t, 422, res.Code)
+
+	data := struct {
+		Code   int         `json:"code"`
+		Errors []Violation `json:"errors"`
+	}{}
+	err := jsoniter.Unmarshal(res.Body.Bytes(), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 422, data.Code)
+	messages := []string{}
+	for _, violation := range data.Errors {
+		messages = append(messages, violation.Message)
+	}
+	assert.Equal(t, []string{
+		"params.id should be integer",
+		"query.ids should be integer",
+		"query.limit should be <= 100",
+		"headers.X-Tenant is required",
+		"payload.name is required",
+		"payload.color is not allowed",
+		"payload.tags should be array",
+	}, messages)
+	assert.Equal(t, "params", data.Errors[0].In)
+	assert.Equal(t, "id", data.Errors[0].Name)
+
+	// the invalid payload
+	req, _ = http.NewRequest("POST", "/api/unit/validate/pets/12", bytes.NewBufferString(`{"name":`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+	res = validateResponse(router, req)
+	assert.Equal(t, 400, res.Code)
+
+	// the form
+	form := url.Values{"age": []string{"3"}}
+	req, _ = http.NewRequest("POST", "/api/unit/validate/form", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res = validateResponse(router, req)
+	assert.Equal(t, 422, res.Code)
+	assert.Contains(t, res.Body.String(), "form.name is required")
+
+	form.Set("name", "Max")
+	req, _ = http.NewRequest("POST", "/api/unit/validate/form", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res = validateResponse(router, req)
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, `["Max","3"]`, res.Body.String())
+}
+
+func validateResponse(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, req)
+	return response
+}
+
+func prepareValidate(t *testing.T) *gin.Engine {
+	process.Register("unit.api.args", func(process *process.Process) interface{} {
+		return process.Args
+	})
+
+	source := `{
+		"name": "validate", "version": "1.0.0", "guard": "-",
+		"paths": [
+			{
+				"path": "/pets/:id", "method": "POST", "process": "unit.api.args",
+				"in": ["$param.id", "$query.limit", "$payload.name"],
+				"request": {
+					"params": {"id": {"type": "integer"}},
+					"query": {
+						"limit": {"type": "integer", "schema": {"minimum": 1, "maximum": 100}},
+						"ids": {"type": "array", "schema": {"items": {"type": "integer"}}}
+					},
+					"headers": {"X-Tenant": {"required": true}},
+					"payload": {
+						"type": "object", "required": ["name"], "additionalProperties": false,
+						"properties": {"name": {"type": "string"}, "tags": {"type": "array", "items": {"type": "string"}}}
+					}
+				},
+				"out": {"status": 200, "type": "application/json"}
+			},
+			{
+				"path": "/form", "method": "POST", "process": "unit.api.args", "in": ["$form.name", "$form.age"],
+				"request": {"form": {"name": {"required": true}, "age": {"type": "integer", "schema": {"minimum": 0}}}},
+				"out": {"status": 200, "type": "application/json"}
+			}
+		]
+	}`
+
+	api, err := LoadSource("<unit.validate>.http.json", []byte(source), "unit.validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	api.HTTP.Routes(router, "/api")
+	return router
+}
@@ -2,41 +2,575 @@ package flow
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/yaoapp/gou/helper"
 	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/kun/exception"
+	"github.com/yaoapp/kun/log"
 	"github.com/yaoapp/kun/maps"
 )
 
+// the node list control signals
+const (
+	signalNext = iota
+	signalBreak
+	signalReturn
+	signalGoto // the output is the name of the fallback node
+)
+
+// maxSteps the max steps of a node list, avoid the infinite goto loop
+const maxSteps = 10000
+
 // Exec execute flow
 func (flow *Flow) Exec(args ...interface{}) (interface{}, error) {
+	return flow.ExecContext(context.Background(), args...)
+}
+
+// ExecContext execute flow with the given context, the nodes will not be started after the context is done
+func (flow *Flow) ExecContext(parent context.Context, args ...interface{}) (interface{}, error) {
+	return flow.ExecWith(parent, flow.Sid, flow.Global, args...)
+}
+
+// ExecWith execute flow with the session id and the global variables of the call
+// the shared flow is not changed, safe for the concurrent calls
+// the nodes are traced if the flow sets trace or the flow is called by a traced node
+func (flow *Flow) ExecWith(parent context.Context, sid string, global map[string]interface{}, args ...interface{}) (interface{}, error) {
+
+	_, sub := parent.Value(traceKey).(*traceRef)
+	if flow.Trace == nil && !sub {
+		return flow.exec(parent, sid, global, nil, args...)
+	}
+
+	res, tracer, err := flow.ExecTrace(parent, sid, global, args...)
+	flow.saveTrace(tracer)
+	if err != nil {
+		return nil, err
+	}
+
+	if flow.Trace != nil && flow.Trace.Output && !sub {
+		return map[string]interface{}{"result": res, "trace": tracer}, nil
+	}
+	return res, nil
+}
+
+// exec execute flow, the tracer is nil if the execution is not traced
+func (flow *Flow) exec(parent context.Context, sid string, global map[string]interface{}, tracer *Tracer, args ...interface{}) (interface{}, error) {
+
+	// the flow could call itself or the other flows as the sub-flows
+	depth := 1
+	if v, ok := parent.Value(depthKey).(int); ok {
+		depth = v + 1
+	}
+
+	if depth > maxDepth {
+		return nil, fmt.Errorf("flows.%s: the sub-flows are nested more than %d levels", flow.Name, maxDepth)
+	}
 
 	res := map[string]interface{}{} // 结果集
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.WithValue(parent, depthKey, depth))
+	defer cancel()
 
 	flowCtx := &Context{
 		Context: &ctx,
 		Cancel:  cancel,
 		Res:     res,
+		Vars:    map[string]interface{}{},
 		In:      args,
+		Sid:     sid,
+		Global:  global,
+		tracer:  tracer,
+	}
+
+	signal, output, err := flow.ExecNodes(flow.Nodes, flowCtx)
+	if err != nil {
+		return nil, err
 	}
 
-	flowProcess := "flows." + flow.Name
-	for i, node := range flow.Nodes {
+	if signal == signalReturn {
+		return output, nil
+	}
+
+	return flow.FormatResult(flowCtx)
+}
+
+// ExecNodes execute the node list, return the control signal and the output of the return node
+// the nodes are scheduled by the dependency graph if one of them declares depends
+func (flow *Flow) ExecNodes(nodes []Node, ctx *Context) (int, interface{}, error) {
+
+	if hasDepends(nodes) {
+		return flow.ExecGraph(nodes, ctx)
+	}
 
-		if strings.HasPrefix(node.Process, flowProcess) {
-			return nil, fmt.Errorf("cannot call self flow(%s)", node.Process)
+	steps := 0
+	for i := 0; i < len(nodes); i++ {
+		steps++
+		if steps > maxSteps {
+			return signalNext, nil, fmt.Errorf("the nodes run more than %d steps", maxSteps)
 		}
 
-		_, err := flow.ExecNode(&node, flowCtx, i-1)
+		err := ctx.Err()
 		if err != nil {
-			return nil, err
+			return signalNext, nil, err
+		}
+
+		node := nodes[i]
+		signal, output, err := flow.execNode(&node, ctx, i)
+		if signal == signalGoto && err == nil {
+			next := indexOf(nodes, fmt.Sprintf("%v", output))
+			if next < 0 {
+				return signalNext, nil, fmt.Errorf("node %s: fallback %v not found", node.Name, output)
+			}
+			i = next - 1
+			continue
+		}
+
+		if err != nil || signal != signalNext {
+			return signal, output, err
+		}
+
+		if node.Goto != "" {
+			next := indexOf(nodes, node.Goto)
+			if next < 0 {
+				return signalNext, nil, fmt.Errorf("node %s: goto %s not found", node.Name, node.Goto)
+			}
+			i = next - 1
 		}
 	}
 
-	return flow.FormatResult(flowCtx)
+	return signalNext, nil, nil
+}
+
+// ExecGraph execute the node list concurrently by the dependency graph
+// the node runs after all of its depends done, the max concurrent nodes is the flow concurrency
+func (flow *Flow) ExecGraph(nodes []Node, ctx *Context) (int, interface{}, error) {
+
+	index := map[string]int{}
+	for i, node := range nodes {
+		if node.Name != "" {
+			index[node.Name] = i
+		}
+	}
+
+	for _, node := range nodes {
+		if node.Goto != "" {
+			return signalNext, nil, fmt.Errorf("node %s: goto does not support with depends", node.Name)
+		}
+
+		if node.OnError != nil && strings.ToLower(node.OnError.Action) == "goto" {
+			return signalNext, nil, fmt.Errorf("node %s: onError goto does not support with depends", node.Name)
+		}
+
+		for _, name := range node.Depends {
+			if _, has := index[name]; !has {
+				return signalNext, nil, fmt.Errorf("node %s: depends %s not found", node.Name, name)
+			}
+		}
+	}
+
+	limit := flow.Concurrency
+	if limit <= 0 {
+		limit = 10
+	}
+
+	type result struct {
+		index  int
+		signal int
+		output interface{}
+		err    error
+	}
+
+	results := make(chan result, len(nodes))
+	started := make([]bool, len(nodes))
+	done := make([]bool, len(nodes))
+	running := 0
+
+	ready := func(i int) bool {
+		for _, name := range nodes[i].Depends {
+			if !done[index[name]] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for finished := 0; finished < len(nodes); {
+		err := ctx.Err()
+		if err != nil {
+			return signalNext, nil, err
+		}
+
+		for i := range nodes {
+			if running >= limit {
+				break
+			}
+
+			if started[i] || !ready(i) {
+				continue
+			}
+
+			started[i] = true
+			running++
+			go func(i int) {
+				node := nodes[i]
+				signal, output, err := flow.execNode(&node, ctx, i)
+				results <- result{index: i, signal: signal, output: output, err: err}
+			}(i)
+		}
+
+		if running == 0 {
+			return signalNext, nil, fmt.Errorf("the depends of the nodes are circular")
+		}
+
+		res := <-results
+		running--
+		finished++
+		done[res.index] = true
+
+		if res.err != nil || res.signal != signalNext {
+
+			// break stops the list only, the error and return stop the flow
+			if (res.err != nil || res.signal == signalReturn) && ctx.Cancel != nil {
+				ctx.Cancel()
+			}
+
+			// wait for the running nodes
+			for ; running > 0; running-- {
+				<-results
+			}
+			return res.signal, res.output, res.err
+		}
+	}
+
+	return signalNext, nil, nil
+}
+
+// execNode execute a node of the list, return the control signal
+func (flow *Flow) execNode(node *Node, ctx *Context, i int) (int, interface{}, error) {
+	if node.Wait != nil {
+		return signalNext, nil, fmt.Errorf("node %s: wait is only supported by the top nodes of the durable workflow", node.Name)
+	}
+
+	ok, err := When(node.When, ctx.Data(flow))
+	if err != nil {
+		return signalNext, nil, fmt.Errorf("node %s: %s", node.Name, err.Error())
+	}
+
+	if !ok {
+		return signalNext, nil, nil
+	}
+
+	signal := signalNext
+	var output interface{}
+	switch {
+	case node.Each != nil:
+		signal, output, err = flow.ExecEach(node, ctx)
+
+	case len(node.Nodes) > 0:
+		signal, output, err = flow.ExecNodes(node.Nodes, ctx)
+
+	case node.DSL != nil || node.Process != "":
+		_, err = flow.ExecNode(node, ctx, i-1)
+	}
+
+	if err != nil {
+		signal, output, err = flow.onError(node, ctx, err)
+		if err != nil || signal == signalGoto {
+			return signal, output, err
+		}
+	}
+
+	if signal == signalReturn {
+		return signal, output, nil
+	}
+
+	if node.Return != nil {
+		return signalReturn, helper.Bind(node.Return, ctx.Data(flow)), nil
+	}
+
+	if node.Break || signal == signalBreak {
+		return signalBreak, nil, nil
+	}
+
+	return signalNext, nil, nil
+}
+
+// ExecEach execute the node per element of the bound array, the results are collected into $res.<name>
+func (flow *Flow) ExecEach(node *Node, ctx *Context) (int, interface{}, error) {
+
+	items := []interface{}{}
+	value := reflect.ValueOf(helper.Bind(node.Each, ctx.Data(flow)))
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			items = append(items, value.Index(i).Interface())
+		}
+	case reflect.Invalid:
+	default:
+		return signalNext, nil, fmt.Errorf("node %s: each should be an array, %s given", node.Name, value.Kind())
+	}
+
+	results := []interface{}{}
+	signal := signalNext
+	var output interface{}
+	for i, item := range items {
+		child := ctx.child(map[string]interface{}{"$item": item, "$index": i})
+
+		var res interface{}
+		var err error
+		if len(node.Nodes) > 0 {
+			signal, output, err = flow.ExecNodes(node.Nodes, child)
+			values := map[string]interface{}{}
+			for _, sub := range node.Nodes {
+				if v, has := child.get(sub.Name); has && sub.Name != "" {
+					values[sub.Name] = v
+				}
+			}
+			res = values
+
+		} else if node.DSL != nil || node.Process != "" {
+			var resp interface{}
+			var outs []interface{}
+			resp, outs, err = flow.runNode(node, child, child.Data(flow))
+			res = nodeResult(node, resp, outs)
+		}
+
+		if err != nil {
+			return signalNext, nil, err
+		}
+
+		results = append(results, res)
+		if signal != signalNext {
+			break
+		}
+	}
+
+	if node.Name != "" {
+		ctx.set(node.Name, results)
+	}
+
+	if signal == signalReturn {
+		return signal, output, nil
+	}
+
+	// break stops the loop only
+	return signalNext, nil, nil
+}
+
+// runNode run the process or the query of the node, retry on error by the node retry policy
+func (flow *Flow) runNode(node *Node, ctx *Context, data maps.Map) (interface{}, []interface{}, error) {
+	trace := ctx.tracer.start(node)
+	resp, outs, attempts, err := flow.retry(node, ctx, data, trace)
+	ctx.tracer.finish(trace, resp, err, attempts)
+	return resp, outs, err
+}
+
+// retry run the process or the query of the node until success or the retries exhausted, return the attempts
+func (flow *Flow) retry(node *Node, ctx *Context, data maps.Map, trace *Trace) (interface{}, []interface{}, int, error) {
+
+	count := 0
+	backoff := time.Duration(0)
+	if node.Retry != nil {
+		count = node.Retry.Count
+		if node.Retry.Backoff != "" {
+			var err error
+			backoff, err = time.ParseDuration(node.Retry.Backoff)
+			if err != nil {
+				return nil, nil, 0, fmt.Errorf("node %s: retry backoff %s", node.Name, err.Error())
+			}
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		var resp interface{}
+		var outs []interface{}
+		var err error
+		if node.DSL != nil {
+			resp, outs, err = flow.runQuery(node, ctx, data)
+		} else {
+			resp, outs, err = flow.runProcess(node, ctx, data, trace)
+		}
+
+		if err == nil {
+			return resp, outs, attempt + 1, nil
+		}
+
+		// the flow is canceled, stop retrying
+		if ctx.Err() != nil {
+			return nil, nil, attempt + 1, ctx.Err()
+		}
+
+		if attempt >= count {
+			return nil, nil, attempt + 1, fmt.Errorf("node %s: %s", node.Name, err.Error())
+		}
+
+		log.Warn("[Flow] %s node %s: %s, retry %d/%d", flow.Name, node.Name, err.Error(), attempt+1, count)
+		select {
+		case <-ctx.parent().Done():
+			return nil, nil, attempt + 1, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = backoff * 2
+	}
+}
+
+// onError handle the error of the node by the onError setting
+// continue: set the bound default value as the result, goto: jump to the fallback node, fail: return the error
+func (flow *Flow) onError(node *Node, ctx *Context, err error) (int, interface{}, error) {
+	if node.OnError == nil || ctx.Err() != nil {
+		return signalNext, nil, err
+	}
+
+	switch strings.ToLower(node.OnError.Action) {
+	case "", "fail":
+		return signalNext, nil, err
+
+	case "continue":
+		log.Warn("[Flow] %s %s, continue", flow.Name, err.Error())
+		if node.Name != "" {
+			data := ctx.Data(flow)
+			data["$error"] = err.Error()
+			ctx.set(node.Name, helper.Bind(node.OnError.Default, data))
+		}
+		return signalNext, nil, nil
+
+	case "goto":
+		if node.OnError.Goto == "" {
+			return signalNext, nil, fmt.Errorf("node %s: the fallback node is required", node.Name)
+		}
+		log.Warn("[Flow] %s %s, goto %s", flow.Name, err.Error(), node.OnError.Goto)
+		return signalGoto, node.OnError.Goto, nil
+	}
+
+	return signalNext, nil, fmt.Errorf("node %s: onError action %s does not support", node.Name, node.OnError.Action)
+}
+
+// Data the binding data of the context
+func (ctx *Context) Data(flow *Flow) maps.Map {
+	data := maps.Map{"$in": ctx.In, "$res": ctx.results(), "$global": ctx.Global}
+	for key, value := range ctx.Vars {
+		data[key] = value
+	}
+	return ctx.ExtendIn(data).Dot()
+}
+
+// Err the error of the context, nil if the context is not done
+func (ctx *Context) Err() error {
+	if ctx.Context == nil {
+		return nil
+	}
+	return (*ctx.Context).Err()
+}
+
+// parent the context of the flow, never nil
+func (ctx *Context) parent() context.Context {
+	if ctx.Context == nil {
+		return context.Background()
+	}
+	return *ctx.Context
+}
+
+// sid the session id of the execution, safe for the concurrent nodes
+func (ctx *Context) sid() string {
+	root := ctx.top()
+	root.lock.RLock()
+	defer root.lock.RUnlock()
+	return root.Sid
+}
+
+// setSid set the session id of the execution, safe for the concurrent nodes
+func (ctx *Context) setSid(sid string) {
+	root := ctx.top()
+	root.lock.Lock()
+	defer root.lock.Unlock()
+	root.Sid = sid
+}
+
+// top the context of the flow
+func (ctx *Context) top() *Context {
+	if ctx.root != nil {
+		return ctx.root
+	}
+	return ctx
+}
+
+// set the result of the node, safe for the concurrent nodes
+func (ctx *Context) set(name string, value interface{}) {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+	ctx.Res[name] = value
+}
+
+// get the result of the node, safe for the concurrent nodes
+func (ctx *Context) get(name string) (interface{}, bool) {
+	ctx.lock.RLock()
+	defer ctx.lock.RUnlock()
+	value, has := ctx.Res[name]
+	return value, has
+}
+
+// results copy the results, safe for the concurrent nodes
+func (ctx *Context) results() map[string]interface{} {
+	ctx.lock.RLock()
+	defer ctx.lock.RUnlock()
+	res := map[string]interface{}{}
+	for key, value := range ctx.Res {
+		res[key] = value
+	}
+	return res
+}
+
+// child create a child context for the each loop, the results of the parent are visible
+func (ctx *Context) child(vars map[string]interface{}) *Context {
+	res := ctx.results()
+
+	values := map[string]interface{}{}
+	for key, value := range ctx.Vars {
+		values[key] = value
+	}
+	for key, value := range vars {
+		values[key] = value
+	}
+
+	return &Context{
+		In:      ctx.In,
+		Res:     res,
+		Vars:    values,
+		Global:  ctx.Global,
+		Context: ctx.Context,
+		Cancel:  ctx.Cancel,
+		root:    ctx.top(),
+		tracer:  ctx.tracer,
+	}
+}
+
+func nodeResult(node *Node, resp interface{}, outs []interface{}) interface{} {
+	if node.Outs == nil || len(node.Outs) == 0 {
+		return resp
+	}
+	return outs
+}
+
+func hasDepends(nodes []Node) bool {
+	for _, node := range nodes {
+		if len(node.Depends) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func indexOf(nodes []Node, name string) int {
+	for i, node := range nodes {
+		if node.Name == name {
+			return i
+		}
+	}
+	return -1
 }
 
 // ExtendIn Extend params
@@ -60,33 +594,32 @@ func (flow *Flow) FormatResult(ctx *Context) (interface{}, error) {
 	if flow.Output == nil {
 		return ctx.Res, nil
 	}
-	data := maps.Map{"$in": ctx.In, "$res": ctx.Res, "$global": flow.Global}
-	data = ctx.ExtendIn(data).Dot()
-	return helper.Bind(flow.Output, data), nil
+	return helper.Bind(flow.Output, ctx.Data(flow)), nil
 }
 
 // ExecNode Execute node
 func (flow *Flow) ExecNode(node *Node, ctx *Context, prev int) ([]interface{}, error) {
-	data := maps.Map{"$in": ctx.In, "$res": ctx.Res, "$global": flow.Global}
-	data = ctx.ExtendIn(data).Dot()
+	data := ctx.Data(flow)
 	var outs = []interface{}{}
 	var err error
 
-	if node.DSL != nil {
-		_, outs, err = flow.RunQuery(node, ctx, data)
-		return outs, err
-	}
-
-	_, outs, err = flow.RunProcess(node, ctx, data)
+	_, outs, err = flow.runNode(node, ctx, data)
 	return outs, err
 }
 
 // RunQuery execute Query DSL
 func (flow *Flow) RunQuery(node *Node, ctx *Context, data maps.Map) (interface{}, []interface{}, error) {
+	return flow.runQuery(node, ctx, data)
+}
+
+func (flow *Flow) runQuery(node *Node, ctx *Context, data maps.Map) (interface{}, []interface{}, error) {
 
 	var res interface{}
 	outs := []interface{}{}
-	resp := node.DSL.Run(data)
+	resp, err := node.runQuery(ctx, data)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	if node.Outs == nil || len(node.Outs) == 0 {
 		res = resp
@@ -100,13 +633,18 @@ func (flow *Flow) RunQuery(node *Node, ctx *Context, data maps.Map) (interface{}
 	}
 
 	if node.Name != "" {
-		ctx.Res[node.Name] = res
+		ctx.set(node.Name, res)
 	}
 	return resp, outs, nil
 }
 
 // RunProcess exec process
 func (flow *Flow) RunProcess(node *Node, ctx *Context, data maps.Map) (interface{}, []interface{}, error) {
+	return flow.runProcess(node, ctx, data, nil)
+}
+
+// runProcess exec process, the sub-flow called by the process is traced into the trace of the node
+func (flow *Flow) runProcess(node *Node, ctx *Context, data maps.Map, trace *Trace) (interface{}, []interface{}, error) {
 
 	args := []interface{}{}
 	outs := []interface{}{}
@@ -117,13 +655,46 @@ func (flow *Flow) RunProcess(node *Node, ctx *Context, data maps.Map) (interface
 	}
 
 	if node.Process != "" {
-		process := process.New(node.Process, args...).WithGlobal(flow.Global).WithSID(flow.Sid)
-		resp = process.Run()
+		process, err := process.Of(node.Process, args...)
+		if err != nil {
+			return nil, nil, err
+		}
 
-		// 当使用 Session start 设置SID时
-		// 设置SID (这个逻辑需要优化)
-		if flow.Sid == "" && process.Sid != "" {
-			flow.WithSID(process.Sid)
+		timeout, err := node.timeout()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		parent := ctx.parent()
+		if trace != nil {
+			ctx.tracer.args(trace, args)
+			parent = context.WithValue(parent, traceKey, &traceRef{tracer: ctx.tracer, trace: trace})
+		}
+
+		var c context.Context
+		var cancel context.CancelFunc
+		if timeout > 0 {
+			c, cancel = context.WithTimeout(parent, timeout)
+		} else {
+			c, cancel = context.WithCancel(parent)
+		}
+		defer cancel()
+
+		sid := ctx.sid()
+		process.WithGlobal(ctx.Global).WithSID(sid).WithContext(c)
+		err = process.Execute()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return nil, nil, fmt.Errorf("%s timeout after %s", node.Process, timeout)
+			}
+			return nil, nil, err
+		}
+		resp = process.Value()
+		process.Release()
+
+		// 当使用 Session start 设置SID时, the next nodes of the execution use the new session id
+		if sid == "" && process.Sid != "" {
+			ctx.setSid(process.Sid)
 		}
 	}
 
@@ -139,7 +710,62 @@ func (flow *Flow) RunProcess(node *Node, ctx *Context, data maps.Map) (interface
 	}
 
 	if node.Name != "" {
-		ctx.Res[node.Name] = res
+		ctx.set(node.Name, res)
 	}
 	return resp, outs, nil
 }
+
+// runQuery run the query DSL, return the error if the query panics or timeout
+func (node *Node) runQuery(ctx *Context, data maps.Map) (interface{}, error) {
+	timeout, err := node.timeout()
+	if err != nil {
+		return nil, err
+	}
+
+	var c context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		c, cancel = context.WithTimeout(ctx.parent(), timeout)
+	} else {
+		c, cancel = context.WithCancel(ctx.parent())
+	}
+	defer cancel()
+
+	type result struct {
+		resp interface{}
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		var res result
+		defer func() {
+			res.err = exception.Catch(recover())
+			done <- res
+		}()
+		res.resp = node.DSL.Run(data)
+	}()
+
+	select {
+	case <-c.Done():
+		if errors.Is(c.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return nil, fmt.Errorf("query timeout after %s", timeout)
+		}
+		return nil, c.Err()
+	case res := <-done:
+		return res.resp, res.err
+	}
+}
+
+// timeout parse the timeout of the node, 0 means no timeout
+func (node *Node) timeout() (time.Duration, error) {
+	if node.Timeout == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(node.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("timeout %s", err.Error())
+	}
+	return timeout, nil
+}
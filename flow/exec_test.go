@@ -1,11 +1,19 @@
 package flow
 
 import (
+	"context"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/gou/query"
+	"github.com/yaoapp/gou/query/share"
 	"github.com/yaoapp/kun/any"
+	"github.com/yaoapp/kun/exception"
+	"github.com/yaoapp/kun/maps"
 )
 
 func TestExec(t *testing.T) {
@@ -31,6 +39,262 @@ func TestExec(t *testing.T) {
 	assert.Equal(t, "U3", r.Get("data.users[1].name"))
 }
 
+func TestExecWhen(t *testing.T) {
+	prepareUnitProcesses()
+	flow := &Flow{Name: "unit.when", Nodes: []Node{
+		{Name: "user", Process: "unit.flow.echo", Args: []interface{}{"{{$in.0}}"}},
+		{Name: "update", Process: "unit.flow.echo", Args: []interface{}{"update"}, When: "{{$res.user}}"},
+		{Name: "create", Process: "unit.flow.echo", Args: []interface{}{"create"}, When: map[string]interface{}{"left": "{{$res.user}}", "op": "null"}},
+	}}
+
+	res, err := flow.Exec(map[string]interface{}{"id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := any.Of(res).MapStr()
+	assert.Equal(t, "update", r.Get("update"))
+	assert.False(t, r.Has("create"))
+
+	res, err = flow.Exec(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = any.Of(res).MapStr()
+	assert.Equal(t, "create", r.Get("create"))
+	assert.False(t, r.Has("update"))
+}
+
+func TestExecEach(t *testing.T) {
+	prepareUnitProcesses()
+	flow := &Flow{Name: "unit.each", Nodes: []Node{
+		{Name: "names", Process: "unit.flow.echo", Each: "{{$in.0}}", Args: []interface{}{"{{$item.name}}"}},
+		{Name: "pets", Each: "{{$in.0}}", Nodes: []Node{
+			{Name: "index", Process: "unit.flow.echo", Args: []interface{}{"{{$index}}"}},
+			{Name: "stop", Break: true, When: map[string]interface{}{"left": "{{$item.name}}", "op": "=", "right": "U2"}},
+			{Name: "name", Process: "unit.flow.echo", Args: []interface{}{"{{$item.name}}"}},
+		}},
+	}}
+
+	users := []interface{}{
+		map[string]interface{}{"name": "U1"},
+		map[string]interface{}{"name": "U2"},
+		map[string]interface{}{"name": "U3"},
+	}
+	res, err := flow.Exec(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := any.Of(res).MapStr()
+	assert.Equal(t, []interface{}{"U1", "U2", "U3"}, r.Get("names"))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"index": 0, "name": "U1"},
+		map[string]interface{}{"index": 1},
+	}, r.Get("pets"))
+	assert.False(t, r.Has("index"))
+}
+
+func TestExecReturnGoto(t *testing.T) {
+	prepareUnitProcesses()
+	flow := &Flow{Name: "unit.return", Nodes: []Node{
+		{Name: "first", Process: "unit.flow.echo", Args: []interface{}{"first"}, Goto: "third"},
+		{Name: "second", Process: "unit.flow.echo", Args: []interface{}{"second"}},
+		{Name: "third", Process: "unit.flow.echo", Args: []interface{}{"third"}},
+		{Name: "exit", When: "{{$in.0}}", Return: map[string]interface{}{"early": "{{$res.third}}"}},
+		{Name: "fourth", Process: "unit.flow.echo", Args: []interface{}{"fourth"}},
+	}}
+
+	res, err := flow.Exec(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]interface{}{"early": "third"}, res)
+
+	res, err = flow.Exec(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := any.Of(res).MapStr()
+	assert.False(t, r.Has("second"))
+	assert.Equal(t, "fourth", r.Get("fourth"))
+
+	flow.Nodes[0].Goto = "missing"
+	_, err = flow.Exec(false)
+	assert.NotNil(t, err)
+}
+
+func TestExecGraph(t *testing.T) {
+	prepareUnitProcesses()
+	flow := &Flow{Name: "unit.graph", Nodes: []Node{
+		{Name: "a", Process: "unit.flow.sleep", Args: []interface{}{100, "A"}},
+		{Name: "b", Process: "unit.flow.sleep", Args: []interface{}{100, "B"}},
+		{Name: "c", Process: "unit.flow.echo", Args: []interface{}{[]interface{}{"{{$res.a}}", "{{$res.b}}"}}, Depends: []string{"a", "b"}},
+	}}
+
+	start := time.Now()
+	res, err := flow.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Less(t, time.Since(start), 190*time.Millisecond)
+	assert.Equal(t, []interface{}{"A", "B"}, any.Of(res).MapStr().Get("c"))
+
+	// concurrency limit
+	flow.Concurrency = 1
+	start = time.Now()
+	_, err = flow.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	// context canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = flow.ExecContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	// circular depends
+	flow.Nodes[0].Depends = []string{"c"}
+	_, err = flow.Exec()
+	assert.NotNil(t, err)
+
+	// missing depends
+	flow.Nodes[0].Depends = []string{"missing"}
+	_, err = flow.Exec()
+	assert.NotNil(t, err)
+}
+
+func TestExecRetryTimeout(t *testing.T) {
+	prepareUnitProcesses()
+	flow := &Flow{Name: "unit.retry", Nodes: []Node{
+		{Name: "retry", Process: "unit.flow.fail", Args: []interface{}{"retry", 2}, Retry: &Retry{Count: 2, Backoff: "10ms"}},
+	}}
+
+	res, err := flow.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "retry", any.Of(res).MapStr().Get("retry"))
+
+	// retries exhausted
+	flow.Nodes[0].Args = []interface{}{"exhausted", 3}
+	flow.Nodes[0].Retry = &Retry{Count: 1}
+	_, err = flow.Exec()
+	assert.Contains(t, err.Error(), "node retry:")
+	assert.Contains(t, err.Error(), "unit.flow.fail exhausted 2")
+
+	// timeout
+	flow = &Flow{Name: "unit.timeout", Nodes: []Node{
+		{Name: "slow", Process: "unit.flow.sleep", Args: []interface{}{200, "slow"}, Timeout: "50ms"},
+	}}
+	start := time.Now()
+	_, err = flow.Exec()
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+	assert.Contains(t, err.Error(), "timeout after 50ms")
+}
+
+func TestExecOnError(t *testing.T) {
+	prepareUnitProcesses()
+	flow := &Flow{Name: "unit.onerror", Nodes: []Node{
+		{Name: "user", Process: "unit.flow.fail", Args: []interface{}{"continue", 1},
+			OnError: &OnError{Action: "continue", Default: map[string]interface{}{"error": "{{$error}}"}}},
+		{Name: "pet", Process: "unit.flow.fail", Args: []interface{}{"goto", 1}, OnError: &OnError{Action: "goto", Goto: "fallback"}},
+		{Name: "skipped", Process: "unit.flow.echo", Args: []interface{}{"skipped"}},
+		{Name: "fallback", Process: "unit.flow.echo", Args: []interface{}{"fallback"}},
+	}}
+
+	res, err := flow.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := any.Of(res).MapStr().Dot()
+	assert.True(t, strings.Contains(r.Get("user.error").(string), "unit.flow.fail continue 1"))
+	assert.False(t, r.Has("pet"))
+	assert.False(t, r.Has("skipped"))
+	assert.Equal(t, "fallback", r.Get("fallback"))
+
+	// fail
+	flow.Nodes[0].Args = []interface{}{"fail", 1}
+	flow.Nodes[0].OnError = &OnError{Action: "fail"}
+	_, err = flow.Exec()
+	assert.Contains(t, err.Error(), "node user:")
+	assert.Contains(t, err.Error(), "unit.flow.fail fail 1")
+
+	// the fallback node is missing
+	flow.Nodes[0].OnError = nil
+	flow.Nodes[0].Args = []interface{}{"fail", 0}
+	flow.Nodes[1].Args = []interface{}{"missing", 1}
+	flow.Nodes[1].OnError.Goto = "missing"
+	_, err = flow.Exec()
+	assert.Contains(t, err.Error(), "fallback missing not found")
+}
+
+var unitFailTimes = map[string]int{}
+var unitFailLock sync.Mutex
+
+func TestExecNestedQuery(t *testing.T) {
+	prepareUnitProcesses()
+	query.Register("unit-query", &unitDSL{})
+	defer query.Unregister("unit-query")
+
+	flow := &Flow{Name: "unit.query", Nodes: []Node{
+		{Name: "pets", Each: "{{$in.0}}", Nodes: []Node{
+			{Name: "query", Engine: "unit-query", Query: map[string]interface{}{"select": []interface{}{"name"}}},
+		}},
+	}}
+	flow.prepare()
+	assert.NotNil(t, flow.Nodes[0].Nodes[0].DSL)
+
+	res, err := flow.Exec([]interface{}{"U1", "U2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := map[string]interface{}{"select": []interface{}{"name"}}
+	assert.Equal(t, []interface{}{map[string]interface{}{"query": source}, map[string]interface{}{"query": source}}, any.Of(res).MapStr().Get("pets"))
+}
+
+// unitDSL the query engine returns the query source
+type unitDSL struct{ source interface{} }
+
+func (dsl *unitDSL) Load(source interface{}) (share.DSL, error) {
+	return &unitDSL{source: source}, nil
+}
+func (dsl *unitDSL) Run(data maps.Map) interface{}         { return dsl.source }
+func (dsl *unitDSL) Get(data maps.Map) []share.Record      { return nil }
+func (dsl *unitDSL) Paginate(data maps.Map) share.Paginate { return share.Paginate{} }
+func (dsl *unitDSL) First(data maps.Map) share.Record      { return nil }
+
+func prepareUnitProcesses() {
+	process.Register("unit.flow.echo", func(process *process.Process) interface{} {
+		if len(process.Args) == 0 {
+			return nil
+		}
+		return process.Args[0]
+	})
+
+	process.Register("unit.flow.sleep", func(process *process.Process) interface{} {
+		time.Sleep(time.Duration(process.ArgsInt(0)) * time.Millisecond)
+		return process.Args[1]
+	})
+
+	// fail the first n calls of the key
+	process.Register("unit.flow.fail", func(process *process.Process) interface{} {
+		key := process.ArgsString(0)
+		unitFailLock.Lock()
+		unitFailTimes[key]++
+		times := unitFailTimes[key]
+		unitFailLock.Unlock()
+
+		if times <= process.ArgsInt(1) {
+			exception.New("unit.flow.fail %s %d", 500, key, times).Throw()
+		}
+		return key
+	})
+}
+
 // func TestExecQuery(t *testing.T) {
 // 	flow, _ := Select("stat")
 // 	res := maps.Of(flow.Exec("2000-01-02", "2050-12-31", 1, 2).(map[string]interface{}))
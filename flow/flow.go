@@ -2,6 +2,7 @@ package flow
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/yaoapp/kun/log"
 
@@ -13,6 +14,8 @@ import (
 var Flows = map[string]*Flow{}
 
 // Load the flow
+// the versioned flow could be loaded with the id name@version (eg: user.info@v2), it coexists with the other versions.
+// the flow declares the version is also selectable by name@version.
 func Load(file string, id string) (*Flow, error) {
 
 	data, err := application.App.Read(file)
@@ -26,15 +29,33 @@ func Load(file string, id string) (*Flow, error) {
 		return nil, err
 	}
 
+	// user.info@v2
+	_, version, versioned := strings.Cut(id, "@")
+	if versioned {
+		if flow.Version != "" && flow.Version != version {
+			return nil, fmt.Errorf("flows.%s: the version %s does not match the version of the id", id, flow.Version)
+		}
+		flow.Version = version
+	}
+
 	flow.prepare()
 	Flows[id] = &flow
+	if !versioned && flow.Version != "" {
+		Flows[fmt.Sprintf("%s@%s", id, flow.Version)] = &flow
+	}
 	return Flows[id], nil
 }
 
 // Prepare 预加载 Query DSL
 func (flow *Flow) prepare() {
+	prepareNodes(flow.Nodes)
+}
 
-	for i, node := range flow.Nodes {
+// prepareNodes load the query DSL of the nodes and the sub nodes
+func prepareNodes(nodes []Node) {
+
+	for i, node := range nodes {
+		prepareNodes(node.Nodes)
 		if node.Query == nil {
 			continue
 		}
@@ -46,7 +67,7 @@ func (flow *Flow) prepare() {
 
 		if engine, has := query.Engines[node.Engine]; has {
 			var err error
-			flow.Nodes[i].DSL, err = engine.Load(node.Query)
+			nodes[i].DSL, err = engine.Load(node.Query)
 			if err != nil {
 				log.With(log.F{"query": node.Query}).Error("Node %s: %s 数据分析查询解析错误", node.Name, node.Engine)
 			}
@@ -58,13 +79,12 @@ func (flow *Flow) prepare() {
 
 // Reload 重新载入API
 func (flow *Flow) Reload() (*Flow, error) {
-	new, err := Load(flow.File, flow.Name)
+	new, err := Load(flow.File, flow.ID)
 	if err != nil {
 		return nil, err
 	}
 
 	flow = new
-	Flows[flow.Name] = new
 	return flow, nil
 }
 
@@ -80,6 +100,14 @@ func (flow *Flow) WithGlobal(global map[string]interface{}) *Flow {
 	return flow
 }
 
+// id the id of the flow, the name if the flow is not loaded from a file
+func (flow *Flow) id() string {
+	if flow.ID != "" {
+		return flow.ID
+	}
+	return flow.Name
+}
+
 // Select 读取已加载Flow
 func Select(name string) (*Flow, error) {
 	flow, has := Flows[name]
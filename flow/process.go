@@ -1,12 +1,25 @@
 package flow
 
 import (
+	"context"
+
 	"github.com/yaoapp/gou/process"
 	"github.com/yaoapp/kun/exception"
+	"github.com/yaoapp/kun/log"
 )
 
+// WorkflowHandlers the durable workflow processes
+var WorkflowHandlers = map[string]process.Handler{
+	"start":  processWorkflowStart,
+	"signal": processWorkflowSignal,
+	"query":  processWorkflowQuery,
+	"cancel": processWorkflowCancel,
+	"resume": processWorkflowResume,
+}
+
 func init() {
 	process.Register("flows", processFlows)
+	process.RegisterGroup("workflows", WorkflowHandlers)
 }
 
 // processScripts
@@ -18,12 +31,88 @@ func processFlows(process *process.Process) interface{} {
 		return nil
 	}
 
-	flow.WithGlobal(process.Global).WithSID(process.Sid)
-
-	res, err := flow.Exec(process.Args...)
+	res, err := flow.ExecWith(processContext(process), process.Sid, process.Global, process.Args...)
 	if err != nil {
 		exception.New(err.Error(), 500).Throw()
 	}
 
 	return res
 }
+
+// processWorkflowStart workflows.Start
+// args: [flow, ...args]
+// start a durable workflow instance, run until the workflow waits or finishes
+func processWorkflowStart(process *process.Process) interface{} {
+	process.ValidateArgNums(1)
+	name := process.ArgsString(0)
+	flow, err := Select(name)
+	if err != nil {
+		exception.New("flows.%s not loaded", 404, name).Throw()
+		return nil
+	}
+
+	inst, err := flow.Start(processContext(process), process.Sid, process.Global, process.Args[1:]...)
+	return workflowResult(process, inst, err)
+}
+
+// processWorkflowSignal workflows.Signal
+// args: [id, signal, data]
+// signal the waiting workflow instance, the data is the result of the waiting node
+func processWorkflowSignal(process *process.Process) interface{} {
+	process.ValidateArgNums(2)
+	var data interface{}
+	if len(process.Args) > 2 {
+		data = process.Args[2]
+	}
+
+	inst, err := Signal(processContext(process), process.ArgsString(0), process.ArgsString(1), data)
+	return workflowResult(process, inst, err)
+}
+
+// processWorkflowQuery workflows.Query
+// args: [id]
+func processWorkflowQuery(process *process.Process) interface{} {
+	process.ValidateArgNums(1)
+	_, inst, err := Query(process.ArgsString(0))
+	if err != nil {
+		exception.New(err.Error(), 404).Throw()
+	}
+	return inst.Map()
+}
+
+// processWorkflowCancel workflows.Cancel
+// args: [id]
+func processWorkflowCancel(process *process.Process) interface{} {
+	process.ValidateArgNums(1)
+	inst, err := Cancel(process.ArgsString(0))
+	return workflowResult(process, inst, err)
+}
+
+// processWorkflowResume workflows.Resume
+// args: [id]
+// resume the running workflow instance from the last checkpoint
+func processWorkflowResume(process *process.Process) interface{} {
+	process.ValidateArgNums(1)
+	inst, err := Resume(processContext(process), process.ArgsString(0))
+	return workflowResult(process, inst, err)
+}
+
+// workflowResult the instance map, the failed instance is returned without throwing
+func workflowResult(process *process.Process, inst *Instance, err error) interface{} {
+	if inst != nil {
+		return inst.Map()
+	}
+
+	if err != nil {
+		log.Error("%s: %s", process.Name, err.Error())
+		exception.New(err.Error(), 400).Throw()
+	}
+	return nil
+}
+
+func processContext(process *process.Process) context.Context {
+	if process.Context == nil {
+		return context.Background()
+	}
+	return process.Context
+}
@@ -1,6 +1,8 @@
 package flow
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -28,3 +30,49 @@ func TestProcess(t *testing.T) {
 	assert.Equal(t, "Duck", r.Get("data.categories[2].name"))
 	assert.Equal(t, "U3", r.Get("data.users[1].name"))
 }
+
+func TestProcessConcurrent(t *testing.T) {
+	process.Register("unit.flow.session", func(process *process.Process) interface{} {
+		time.Sleep(time.Millisecond)
+		return map[string]interface{}{"sid": process.Sid, "id": process.Global["id"]}
+	})
+
+	Flows["unit.concurrent"] = &Flow{Name: "unit.concurrent", Nodes: []Node{
+		{Name: "first", Process: "unit.flow.session"},
+		{Name: "second", Process: "unit.flow.session"},
+	}, Output: map[string]interface{}{"first": "{{$res.first}}", "second": "{{$res.second}}", "global": "{{$global.id}}"}}
+	defer delete(Flows, "unit.concurrent")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sid := fmt.Sprintf("sid-%d", i)
+			p, err := process.Of("flows.unit.concurrent")
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			res, err := p.WithSID(sid).WithGlobal(map[string]interface{}{"id": i}).Exec()
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			r := any.Of(res).MapStr().Dot()
+			if r.Get("first.sid") != sid || r.Get("second.sid") != sid || r.Get("second.id") != i || r.Get("global") != i {
+				errs <- fmt.Errorf("call %d got %v", i, res)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	assert.Empty(t, Flows["unit.concurrent"].Sid)
+}
@@ -0,0 +1,138 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/store"
+	"github.com/yaoapp/kun/log"
+)
+
+// maxDepth the max nested levels of the sub-flows, avoid the infinite recursion
+const maxDepth = 32
+
+type contextKey int
+
+const (
+	depthKey contextKey = iota // the nested level of the flow
+	traceKey                   // the trace of the node calling the sub-flow
+)
+
+// traceRef the trace of the node calling the sub-flow
+type traceRef struct {
+	tracer *Tracer
+	trace  *Trace
+}
+
+// newTracer create a tracer of the flow execution
+func newTracer(flow string) *Tracer {
+	return &Tracer{ID: uuid.NewString(), Flow: flow, Start: time.Now(), Nodes: []*Trace{}}
+}
+
+// MarshalJSON the trace is safe to marshal while the concurrent nodes are running
+func (tracer *Tracer) MarshalJSON() ([]byte, error) {
+	type alias Tracer
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	return jsoniter.Marshal((*alias)(tracer))
+}
+
+// start trace the node, nil if the tracer is nil
+func (tracer *Tracer) start(node *Node) *Trace {
+	if tracer == nil {
+		return nil
+	}
+
+	trace := &Trace{Node: node.Name, Process: node.Process, Start: time.Now()}
+	if node.DSL != nil {
+		trace.Process = fmt.Sprintf("query.%s", node.Engine)
+	}
+
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	tracer.Nodes = append(tracer.Nodes, trace)
+	return trace
+}
+
+// args trace the bound args of the node
+func (tracer *Tracer) args(trace *Trace, args []interface{}) {
+	if tracer == nil || trace == nil {
+		return
+	}
+
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	trace.Args = args
+}
+
+// finish trace the output, the error and the duration of the node
+func (tracer *Tracer) finish(trace *Trace, output interface{}, err error, attempts int) {
+	if tracer == nil || trace == nil {
+		return
+	}
+
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	trace.Output = output
+	trace.Attempts = attempts
+	trace.Duration = milliseconds(time.Since(trace.Start))
+	if err != nil {
+		trace.Error = err.Error()
+	}
+}
+
+// attach the trace of the sub-flow to the node calling it
+func (tracer *Tracer) attach(trace *Trace, sub *Tracer) {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	trace.Flow = sub
+}
+
+// done trace the duration and the error of the flow
+func (tracer *Tracer) done(err error) {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	tracer.Duration = milliseconds(time.Since(tracer.Start))
+	if err != nil {
+		tracer.Error = err.Error()
+	}
+}
+
+// ExecTrace execute flow and trace the nodes, the sub-flows called by the nodes are traced too
+func (flow *Flow) ExecTrace(parent context.Context, sid string, global map[string]interface{}, args ...interface{}) (interface{}, *Tracer, error) {
+	tracer := newTracer(flow.id())
+	res, err := flow.exec(parent, sid, global, tracer, args...)
+	tracer.done(err)
+
+	if ref, ok := parent.Value(traceKey).(*traceRef); ok {
+		ref.tracer.attach(ref.trace, tracer)
+	}
+
+	return res, tracer, err
+}
+
+// save the trace to the store of the trace setting
+func (flow *Flow) saveTrace(tracer *Tracer) {
+	if flow.Trace == nil || flow.Trace.Store == "" {
+		return
+	}
+
+	stor, has := store.Pools[flow.Trace.Store]
+	if !has {
+		log.Error("[Flow] %s trace: the store %s does not load", flow.Name, flow.Trace.Store)
+		return
+	}
+
+	key := fmt.Sprintf("flows.%s:%s", flow.id(), tracer.ID)
+	err := stor.Set(key, tracer, time.Duration(flow.Trace.TTL)*time.Second)
+	if err != nil {
+		log.Error("[Flow] %s trace: %s", flow.Name, err.Error())
+	}
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
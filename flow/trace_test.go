@@ -0,0 +1,142 @@
+package flow
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/application"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/gou/store"
+	"github.com/yaoapp/kun/any"
+)
+
+func TestExecTrace(t *testing.T) {
+	prepareUnitProcesses()
+	stor, err := store.New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Pools["flow-tests"] = stor
+	defer delete(store.Pools, "flow-tests")
+
+	Flows["unit.trace.sub"] = &Flow{Name: "unit.trace.sub", Nodes: []Node{
+		{Name: "echo", Process: "unit.flow.echo", Args: []interface{}{"{{$in.0}}"}},
+	}, Output: "{{$res.echo}}"}
+	defer delete(Flows, "unit.trace.sub")
+
+	flow := &Flow{Name: "unit.trace", Trace: &TraceOption{Output: true, Store: "flow-tests"}, Nodes: []Node{
+		{Name: "sub", Process: "flows.unit.trace.sub", Args: []interface{}{"{{$in.0}}"}},
+		{Name: "fail", Process: "unit.flow.fail", Args: []interface{}{"trace", 1}, Retry: &Retry{Count: 1}},
+	}}
+
+	res, err := flow.Exec("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := any.Of(res).MapStr()
+	assert.Equal(t, "hello", any.Of(r.Get("result")).MapStr().Get("sub"))
+
+	tracer := r.Get("trace").(*Tracer)
+	assert.Equal(t, 2, len(tracer.Nodes))
+	assert.Equal(t, "flows.unit.trace.sub", tracer.Nodes[0].Process)
+	assert.Equal(t, []interface{}{"hello"}, tracer.Nodes[0].Args)
+	assert.Equal(t, "hello", tracer.Nodes[0].Output)
+	assert.Equal(t, "unit.trace.sub", tracer.Nodes[0].Flow.Flow)
+	assert.Equal(t, []interface{}{"hello"}, tracer.Nodes[0].Flow.Nodes[0].Args)
+	assert.Equal(t, 2, tracer.Nodes[1].Attempts)
+	assert.Equal(t, "trace", tracer.Nodes[1].Output)
+
+	saved, has := stor.Get("flows.unit.trace:" + tracer.ID)
+	assert.True(t, has)
+	assert.Equal(t, tracer, saved)
+
+	// the sub-flow returns the result only
+	p, err := process.Of("flows.unit.trace.sub", "world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = p.Exec()
+	assert.Nil(t, err)
+	assert.Equal(t, "world", res)
+}
+
+func TestExecRecursive(t *testing.T) {
+	process.Register("unit.flow.dec", func(process *process.Process) interface{} {
+		return process.ArgsInt(0) - 1
+	})
+
+	Flows["unit.recursive"] = &Flow{Name: "unit.recursive", Nodes: []Node{
+		{Name: "dec", Process: "unit.flow.dec", Args: []interface{}{"{{$in.0}}"}},
+		{Name: "next", Process: "flows.unit.recursive", Args: []interface{}{"{{$res.dec}}"},
+			When: map[string]interface{}{"left": "{{$res.dec}}", "op": ">", "right": 0}},
+	}, Output: "{{$res.dec}}"}
+	defer delete(Flows, "unit.recursive")
+
+	res, err := Flows["unit.recursive"].Exec(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 4, res)
+
+	_, err = Flows["unit.recursive"].Exec(100)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "nested more than"))
+}
+
+func TestLoadVersion(t *testing.T) {
+	root := t.TempDir()
+	err := os.MkdirAll(filepath.Join(root, "flows"), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"version.flow.json":    `{"name": "v1", "version": "v1", "nodes": []}`,
+		"version@v2.flow.json": `{"name": "v2", "nodes": []}`,
+		"mismatch.flow.json":   `{"name": "mismatch", "version": "v1", "nodes": []}`,
+	}
+	for name, source := range files {
+		err := os.WriteFile(filepath.Join(root, "flows", name), []byte(source), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app, err := application.OpenFromDisk(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origin := application.App
+	application.Load(app)
+	defer func() { application.App = origin }()
+	defer delete(Flows, "unit.version")
+	defer delete(Flows, "unit.version@v1")
+	defer delete(Flows, "unit.version@v2")
+
+	_, err = Load("flows/version.flow.json", "unit.version")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Load("flows/version@v2.flow.json", "unit.version@v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Load("flows/mismatch.flow.json", "unit.mismatch@v2")
+	assert.NotNil(t, err)
+
+	for id, name := range map[string]string{"unit.version": "v1", "unit.version@v1": "v1", "unit.version@v2": "v2"} {
+		flow, err := Select(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, name, flow.Name)
+	}
+	assert.Equal(t, "v2", Flows["unit.version@v2"].Version)
+}
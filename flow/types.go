@@ -2,6 +2,8 @@ package flow
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/yaoapp/gou/query/share"
 )
@@ -15,8 +17,11 @@ type Flow struct {
 	Description string                 `json:"description,omitempty"`
 	Nodes       []Node                 `json:"nodes,omitempty"`
 	Output      interface{}            `json:"output,omitempty"`
-	Global      map[string]interface{} // 全局变量
-	Sid         string                 // 会话ID
+	Concurrency int                    `json:"concurrency,omitempty"` // the max concurrent nodes when the nodes declare depends, default 10
+	Trace       *TraceOption           `json:"trace,omitempty"`       // trace the nodes of the executions
+	Durable     *DurableOption         `json:"durable,omitempty"`     // run as a durable workflow by the workflows processes
+	Global      map[string]interface{} // 全局变量, the default of Exec, use ExecWith for the per-call global
+	Sid         string                 // 会话ID, the default of Exec, use ExecWith for the per-call session id
 }
 
 // Node 工作流节点
@@ -28,12 +33,109 @@ type Node struct {
 	DSL     share.DSL     `json:"-"`                // 数据分析语言 Query DSL
 	Args    []interface{} `json:"args,omitempty"`
 	Outs    []interface{} `json:"outs,omitempty"`
+	When    interface{}   `json:"when,omitempty"`    // the node runs only if the condition is true, eg: "{{$res.user}}", {"left": "{{$res.user.id}}", "op": ">", "right": 0}
+	Each    interface{}   `json:"each,omitempty"`    // run the node per element of the bound array, the element is $item, the index is $index
+	Nodes   []Node        `json:"nodes,omitempty"`   // the sub nodes, run per element when each is set
+	Break   bool          `json:"break,omitempty"`   // stop the each loop (or the flow) after the node
+	Goto    string        `json:"goto,omitempty"`    // jump to the named node of the same list after the node
+	Return  interface{}   `json:"return,omitempty"`  // stop the flow and return the bound output after the node
+	Depends []string      `json:"depends,omitempty"` // the names of the nodes must be done before, the independent nodes of the list run concurrently
+	Timeout string        `json:"timeout,omitempty"` // the timeout of the process or the query per attempt, eg: "5s", "500ms"
+	Retry   *Retry        `json:"retry,omitempty"`   // retry the process or the query on error
+	OnError *OnError      `json:"onError,omitempty"` // the error handling after the retries
+	Wait    *Wait         `json:"wait,omitempty"`    // suspend the durable workflow until the signal, the signal data is the result of the node
+}
+
+// Wait the wait node of the durable workflow
+type Wait struct {
+	Signal string `json:"signal"`
+}
+
+// Retry the retry policy of the node
+type Retry struct {
+	Count   int    `json:"count"`             // the max retry times
+	Backoff string `json:"backoff,omitempty"` // the delay before the first retry, doubled for each next retry, eg: "200ms"
+}
+
+// OnError the error handling of the node
+type OnError struct {
+	Action  string      `json:"action,omitempty"`  // fail (default), continue, goto
+	Default interface{} `json:"default,omitempty"` // the result of the node when continue, the error message is $error
+	Goto    string      `json:"goto,omitempty"`    // the fallback node of the same list when goto
+}
+
+// TraceOption the execution trace setting of the flow
+type TraceOption struct {
+	Output bool   `json:"output,omitempty"` // return {"result": <the result>, "trace": <the trace>}, ignored when the flow is called as a sub-flow
+	Store  string `json:"store,omitempty"`  // save the trace to the store, the key is flows.<id>:<trace id>
+	TTL    int    `json:"ttl,omitempty"`    // the ttl of the saved trace in seconds, 0 means no expiration
+}
+
+// DurableOption the durable workflow setting of the flow
+type DurableOption struct {
+	Store string `json:"store"`         // the store of the workflow instances, the key is workflows:<instance id>
+	TTL   int    `json:"ttl,omitempty"` // the ttl of the instances in seconds, 0 means no expiration
+}
+
+// Instance the durable workflow instance, checkpointed to the store after each node
+type Instance struct {
+	ID      string                 `json:"id"` // <flow id>:<uuid>
+	Flow    string                 `json:"flow"`
+	Status  string                 `json:"status"`            // running, waiting, completed, failed, canceled
+	Version int                    `json:"version"`           // increased on each save, the instance is saved only if the stored version is not changed
+	Step    int                    `json:"step"`              // the index of the next node
+	Waiting string                 `json:"waiting,omitempty"` // the signal of the waiting node
+	In      []interface{}          `json:"in"`
+	Res     map[string]interface{} `json:"res"`
+	Sid     string                 `json:"sid,omitempty"`
+	Global  map[string]interface{} `json:"global,omitempty"`
+	Output  interface{}            `json:"output,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+	Created time.Time              `json:"created"`
+	Updated time.Time              `json:"updated"`
+}
+
+// Tracer the execution trace of a flow
+type Tracer struct {
+	ID       string    `json:"id"`
+	Flow     string    `json:"flow"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"` // milliseconds
+	Error    string    `json:"error,omitempty"`
+	Nodes    []*Trace  `json:"nodes"`
+	lock     sync.Mutex
+}
+
+// Trace the execution trace of a node, an each node has a trace per element
+type Trace struct {
+	Node     string        `json:"node"`
+	Process  string        `json:"process,omitempty"`
+	Args     []interface{} `json:"args,omitempty"` // the args after binding
+	Output   interface{}   `json:"output,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Attempts int           `json:"attempts"`
+	Start    time.Time     `json:"start"`
+	Duration float64       `json:"duration"`       // milliseconds
+	Flow     *Tracer       `json:"flow,omitempty"` // the trace of the sub-flow called by the node
+}
+
+// Condition the node condition
+type Condition struct {
+	Left  interface{} `json:"left"`
+	OP    string      `json:"op,omitempty"` // =, !=, >, >=, <, <=, in, notin, null, notnull, match
+	Right interface{} `json:"right,omitempty"`
 }
 
 // Context 工作流上下文
 type Context struct {
 	In      []interface{}
 	Res     map[string]interface{}
+	Vars    map[string]interface{} // the loop variables ($item, $index)
+	Sid     string                 // the session id of the execution, changed by the session start process
+	Global  map[string]interface{} // the global variables of the execution
 	Context *context.Context
 	Cancel  context.CancelFunc
+	root    *Context // the context of the flow when the context is a child of the each loop
+	tracer  *Tracer  // nil if the execution is not traced
+	lock    sync.RWMutex
 }
@@ -0,0 +1,178 @@
+package flow
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yaoapp/gou/helper"
+	"github.com/yaoapp/kun/maps"
+)
+
+// When check if the node condition is true
+// the condition could be a bound value, a Condition map or a list of them (AND)
+func When(when interface{}, data maps.Map) (bool, error) {
+	switch cond := when.(type) {
+	case nil:
+		return true, nil
+
+	case []interface{}:
+		for _, item := range cond {
+			ok, err := When(item, data)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case map[string]interface{}:
+		condition := Condition{Left: cond["left"], Right: cond["right"]}
+		if op, ok := cond["op"].(string); ok {
+			condition.OP = op
+		}
+		return condition.Check(data)
+
+	case Condition:
+		return cond.Check(data)
+	}
+
+	return truthy(helper.Bind(when, data)), nil
+}
+
+// Check the condition
+func (cond Condition) Check(data maps.Map) (bool, error) {
+	left := helper.Bind(cond.Left, data)
+	right := helper.Bind(cond.Right, data)
+
+	switch strings.ToLower(strings.TrimSpace(cond.OP)) {
+	case "":
+		return truthy(left), nil
+	case "=", "==":
+		return equal(left, right), nil
+	case "!=", "<>":
+		return !equal(left, right), nil
+	case ">":
+		res, err := compare(left, right)
+		return res > 0, err
+	case ">=":
+		res, err := compare(left, right)
+		return res >= 0, err
+	case "<":
+		res, err := compare(left, right)
+		return res < 0, err
+	case "<=":
+		res, err := compare(left, right)
+		return res <= 0, err
+	case "in":
+		return contains(right, left), nil
+	case "notin":
+		return !contains(right, left), nil
+	case "null":
+		return left == nil, nil
+	case "notnull":
+		return left != nil, nil
+	case "match":
+		re, err := regexp.Compile(fmt.Sprintf("%v", right))
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(fmt.Sprintf("%v", left)), nil
+	}
+
+	return false, fmt.Errorf("the condition op %s does not support", cond.OP)
+}
+
+func truthy(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v != "" && v != "false" && v != "0"
+	}
+
+	if number, ok := toFloat(value); ok {
+		return number != 0
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len() > 0
+	case reflect.Ptr, reflect.Interface:
+		return !rv.IsNil()
+	}
+	return true
+}
+
+func equal(left, right interface{}) bool {
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			return l == r
+		}
+	}
+
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+	return fmt.Sprintf("%v", left) == fmt.Sprintf("%v", right)
+}
+
+func compare(left, right interface{}) (int, error) {
+	l, lok := toFloat(left)
+	r, rok := toFloat(right)
+	if lok && rok {
+		switch {
+		case l > r:
+			return 1, nil
+		case l < r:
+			return -1, nil
+		}
+		return 0, nil
+	}
+
+	if left == nil || right == nil {
+		return 0, fmt.Errorf("can't compare %v with %v", left, right)
+	}
+	return strings.Compare(fmt.Sprintf("%v", left), fmt.Sprintf("%v", right)), nil
+}
+
+func contains(list interface{}, value interface{}) bool {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return false
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		if equal(rv.Index(i).Interface(), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	case bool, nil:
+		return 0, false
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,49 @@
+package flow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/kun/maps"
+)
+
+func TestWhen(t *testing.T) {
+	data := maps.Map{
+		"$res": map[string]interface{}{
+			"user":  map[string]interface{}{"id": 1, "name": "U1"},
+			"empty": []interface{}{},
+		},
+	}.Dot()
+
+	cases := []struct {
+		when interface{}
+		ok   bool
+	}{
+		{nil, true},
+		{true, true},
+		{"{{$res.user}}", true},
+		{"{{$res.empty}}", false},
+		{"{{$res.missing}}", false},
+		{map[string]interface{}{"left": "{{$res.user.id}}", "op": "=", "right": 1}, true},
+		{map[string]interface{}{"left": "{{$res.user.id}}", "op": ">", "right": "0"}, true},
+		{map[string]interface{}{"left": "{{$res.user.id}}", "op": "<=", "right": 0}, false},
+		{map[string]interface{}{"left": "{{$res.user.name}}", "op": "in", "right": []interface{}{"U1", "U2"}}, true},
+		{map[string]interface{}{"left": "{{$res.user.name}}", "op": "match", "right": "^U[0-9]$"}, true},
+		{map[string]interface{}{"left": "{{$res.missing}}", "op": "null"}, true},
+		{[]interface{}{
+			map[string]interface{}{"left": "{{$res.user.id}}", "op": "!=", "right": 2},
+			"{{$res.empty}}",
+		}, false},
+	}
+
+	for i, c := range cases {
+		ok, err := When(c.when, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, c.ok, ok, "case %d", i)
+	}
+
+	_, err := When(map[string]interface{}{"left": 1, "op": "~", "right": 1}, data)
+	assert.NotNil(t, err)
+}
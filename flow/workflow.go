@@ -0,0 +1,562 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/store"
+	"github.com/yaoapp/kun/log"
+)
+
+// the status of the workflow instance
+const (
+	StatusRunning   = "running"
+	StatusWaiting   = "waiting"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// instances the running instances of this server, the instance id => cancel function
+var instances = map[string]context.CancelFunc{}
+var instancesLock sync.Mutex
+
+// saveLock the versions of the instances are compared and saved one by one
+var saveLock sync.Mutex
+
+// Owner the id of this server, the owner of the leases of the running instances
+var Owner = uuid.NewString()
+
+// leaseTTL the lease of the running instance is renewed by the owner, the instance is orphaned after the lease expired
+var leaseTTL = 30 * time.Second
+
+// Start a durable workflow instance of the flow, run the nodes until the workflow waits or finishes
+func (flow *Flow) Start(parent context.Context, sid string, global map[string]interface{}, args ...interface{}) (*Instance, error) {
+	if flow.Durable == nil {
+		return nil, fmt.Errorf("flows.%s is not a durable workflow", flow.id())
+	}
+
+	if hasDepends(flow.Nodes) {
+		return nil, fmt.Errorf("flows.%s: the durable workflow does not support depends", flow.id())
+	}
+
+	now := time.Now()
+	inst := &Instance{
+		ID:      fmt.Sprintf("%s:%s", flow.id(), uuid.NewString()),
+		Flow:    flow.id(),
+		Status:  StatusRunning,
+		In:      args,
+		Res:     map[string]interface{}{},
+		Sid:     sid,
+		Global:  global,
+		Created: now,
+		Updated: now,
+	}
+
+	err := flow.save(inst)
+	if err != nil {
+		return nil, err
+	}
+
+	return flow.run(parent, inst)
+}
+
+// Signal the waiting workflow instance, the data is the result of the waiting node.
+// the instance is signaled once, the concurrent signals are rejected by the version of the instance
+func Signal(parent context.Context, id string, signal string, data interface{}) (*Instance, error) {
+	flow, inst, err := Query(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if inst.Status != StatusWaiting {
+		return nil, fmt.Errorf("workflow %s is %s, not waiting", id, inst.Status)
+	}
+
+	if inst.Waiting != signal {
+		return nil, fmt.Errorf("workflow %s is waiting for %s, %s given", id, inst.Waiting, signal)
+	}
+
+	node := flow.Nodes[inst.Step]
+	if node.Name != "" {
+		inst.Res[node.Name] = data
+	}
+	inst.Step++
+	inst.Waiting = ""
+	inst.Status = StatusRunning
+	err = flow.save(inst)
+	if err != nil {
+		return nil, err
+	}
+
+	return flow.run(parent, inst)
+}
+
+// Resume the running workflow instance from the last checkpoint, eg: the server restarted while running.
+// the instance is rejected if it is running on another server with the lease.
+// the nodes run at least once: the nodes after the last checkpoint may run again, they should be idempotent
+func Resume(parent context.Context, id string) (*Instance, error) {
+	flow, inst, err := Query(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if inst.Status != StatusRunning {
+		return nil, fmt.Errorf("workflow %s is %s, not running", id, inst.Status)
+	}
+
+	instancesLock.Lock()
+	_, running := instances[id]
+	instancesLock.Unlock()
+	if running {
+		return nil, fmt.Errorf("workflow %s is running", id)
+	}
+
+	return flow.run(parent, inst)
+}
+
+// Recover resume the orphaned running instances of the loaded durable workflows, call it after the server started.
+// the instances are listed by the index of the flow, the instances with the unexpired lease of the other servers are skipped.
+// the nodes after the last checkpoint run again, see Resume
+func Recover(parent context.Context) []error {
+	errs := []error{}
+	for _, flow := range Flows {
+		if flow.Durable == nil {
+			continue
+		}
+
+		stor, err := flow.store()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, id := range flow.index(stor) {
+			_, inst, err := Query(id)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			if inst.Status != StatusRunning {
+				continue
+			}
+
+			if owner, leased := flow.leased(stor, id); leased {
+				log.Info("[Workflow] %s is running on %s", id, owner)
+				continue
+			}
+
+			log.Info("[Workflow] %s resume from the step %d", id, inst.Step)
+			_, err = Resume(parent, id)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// Cancel the workflow instance, the running node of this server is canceled too
+func Cancel(id string) (*Instance, error) {
+
+	// the running instance checkpoints with the lock, no checkpoint after canceled
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+
+	flow, inst, err := Query(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch inst.Status {
+	case StatusCompleted, StatusFailed, StatusCanceled:
+		return nil, fmt.Errorf("workflow %s is %s", id, inst.Status)
+	}
+
+	if cancel, running := instances[id]; running {
+		cancel()
+	}
+
+	inst.Status = StatusCanceled
+	inst.Waiting = ""
+	err = flow.save(inst)
+	if err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
+
+// Query the workflow instance by the id
+func Query(id string) (*Flow, *Instance, error) {
+	pos := strings.LastIndex(id, ":")
+	if pos < 0 {
+		return nil, nil, fmt.Errorf("workflow %s: the id is invalid", id)
+	}
+
+	flow, err := Select(id[:pos])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stor, err := flow.store()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value, has := stor.Get(fmt.Sprintf("workflows:%s", id))
+	if !has {
+		return nil, nil, fmt.Errorf("workflow %s not found", id)
+	}
+
+	data, ok := value.(string)
+	if !ok {
+		return nil, nil, fmt.Errorf("workflow %s: the instance is invalid", id)
+	}
+
+	inst := &Instance{}
+	err = jsoniter.UnmarshalFromString(data, inst)
+	if err != nil {
+		return nil, nil, fmt.Errorf("workflow %s: %s", id, err.Error())
+	}
+
+	if inst.Res == nil {
+		inst.Res = map[string]interface{}{}
+	}
+	return flow, inst, nil
+}
+
+// Map the instance as a map
+func (inst *Instance) Map() map[string]interface{} {
+	res := map[string]interface{}{}
+	data, err := jsoniter.Marshal(inst)
+	if err != nil {
+		return res
+	}
+	jsoniter.Unmarshal(data, &res)
+	return res
+}
+
+// run the nodes of the instance from the step, checkpoint the instance after each node
+func (flow *Flow) run(parent context.Context, inst *Instance) (*Instance, error) {
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	instancesLock.Lock()
+	if _, running := instances[inst.ID]; running {
+		instancesLock.Unlock()
+		return nil, fmt.Errorf("workflow %s is running", inst.ID)
+	}
+	instances[inst.ID] = cancel
+	instancesLock.Unlock()
+
+	defer func() {
+		instancesLock.Lock()
+		delete(instances, inst.ID)
+		instancesLock.Unlock()
+	}()
+
+	// the lease is renewed until the run finished
+	err := flow.lease(inst.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer flow.release(inst.ID)
+
+	go func() {
+		ticker := time.NewTicker(leaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := flow.lease(inst.ID); err != nil {
+					log.Error("[Workflow] %s lease: %s", inst.ID, err.Error())
+				}
+			}
+		}
+	}()
+
+	flowCtx := &Context{
+		Context: &ctx,
+		Cancel:  cancel,
+		Res:     inst.Res,
+		Vars:    map[string]interface{}{},
+		In:      inst.In,
+		Sid:     inst.Sid,
+		Global:  inst.Global,
+	}
+
+	for steps := 0; inst.Step < len(flow.Nodes); steps++ {
+		if steps > maxSteps {
+			return flow.fail(inst, fmt.Errorf("the nodes run more than %d steps", maxSteps))
+		}
+
+		if err := ctx.Err(); err != nil {
+			return flow.fail(inst, err)
+		}
+
+		node := flow.Nodes[inst.Step]
+		if node.Wait != nil {
+			ok, err := When(node.When, flowCtx.Data(flow))
+			if err != nil {
+				return flow.fail(inst, fmt.Errorf("node %s: %s", node.Name, err.Error()))
+			}
+
+			if ok {
+				inst.Status = StatusWaiting
+				inst.Waiting = node.Wait.Signal
+				inst.Sid = flowCtx.sid()
+				err := flow.checkpoint(ctx, inst)
+				if err != nil {
+					return flow.fail(inst, err)
+				}
+				return inst, nil
+			}
+
+			inst.Step++
+			continue
+		}
+
+		signal, output, err := flow.execNode(&node, flowCtx, inst.Step)
+		if err != nil {
+			return flow.fail(inst, err)
+		}
+
+		switch {
+		case signal == signalReturn:
+			inst.Output = output
+			inst.Step = len(flow.Nodes)
+			return flow.complete(ctx, inst, flowCtx, false)
+
+		case signal == signalBreak:
+			return flow.complete(ctx, inst, flowCtx, true)
+
+		case signal == signalGoto || node.Goto != "":
+			name := node.Goto
+			if signal == signalGoto {
+				name = fmt.Sprintf("%v", output)
+			}
+
+			next := indexOf(flow.Nodes, name)
+			if next < 0 {
+				return flow.fail(inst, fmt.Errorf("node %s: goto %s not found", node.Name, name))
+			}
+			inst.Step = next
+
+		default:
+			inst.Step++
+		}
+
+		inst.Res = flowCtx.results()
+		inst.Sid = flowCtx.sid()
+		err = flow.checkpoint(ctx, inst)
+		if err != nil {
+			return flow.fail(inst, err)
+		}
+	}
+
+	return flow.complete(ctx, inst, flowCtx, true)
+}
+
+// complete the instance, the output is the flow output if format is true
+func (flow *Flow) complete(ctx context.Context, inst *Instance, flowCtx *Context, format bool) (*Instance, error) {
+	inst.Res = flowCtx.results()
+	inst.Sid = flowCtx.sid()
+	if format {
+		output, err := flow.FormatResult(flowCtx)
+		if err != nil {
+			return flow.fail(inst, err)
+		}
+		inst.Output = output
+	}
+
+	inst.Status = StatusCompleted
+	inst.Step = len(flow.Nodes)
+	err := flow.checkpoint(ctx, inst)
+	if err != nil {
+		return flow.fail(inst, err)
+	}
+	return inst, nil
+}
+
+// fail the instance, the canceled instance keeps the status canceled.
+// the instance keeps running from the last checkpoint if the caller is canceled, it could be resumed later
+func (flow *Flow) fail(inst *Instance, err error) (*Instance, error) {
+	if _, current, qerr := Query(inst.ID); qerr == nil && current.Status == StatusCanceled {
+		return current, err
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return inst, err
+	}
+
+	inst.Status = StatusFailed
+	inst.Error = err.Error()
+	serr := flow.save(inst)
+	if serr != nil {
+		log.Error("[Workflow] %s save: %s", inst.ID, serr.Error())
+	}
+	return inst, err
+}
+
+// checkpoint save the instance if the run is not canceled
+func (flow *Flow) checkpoint(ctx context.Context, inst *Instance) error {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+	return flow.save(inst)
+}
+
+// save the instance if the stored version is not changed, the version of the instance is increased.
+// the store has no atomic operations, the versions are compared and saved under the lock of the process
+func (flow *Flow) save(inst *Instance) error {
+	stor, err := flow.store()
+	if err != nil {
+		return err
+	}
+
+	saveLock.Lock()
+	defer saveLock.Unlock()
+
+	key := fmt.Sprintf("workflows:%s", inst.ID)
+	if value, has := stor.Get(key); has {
+		current := struct {
+			Version int `json:"version"`
+		}{}
+		if data, ok := value.(string); ok && jsoniter.UnmarshalFromString(data, &current) == nil && current.Version != inst.Version {
+			return fmt.Errorf("workflow %s is changed, the version %d is not the current version %d", inst.ID, inst.Version, current.Version)
+		}
+	}
+
+	inst.Version++
+	inst.Updated = time.Now()
+	data, err := jsoniter.MarshalToString(inst)
+	if err != nil {
+		inst.Version--
+		return fmt.Errorf("workflow %s: %s", inst.ID, err.Error())
+	}
+
+	err = stor.Set(key, data, time.Duration(flow.Durable.TTL)*time.Second)
+	if err != nil {
+		inst.Version--
+		return err
+	}
+	return flow.indexed(stor, inst)
+}
+
+// index the ids of the running and the waiting instances of the flow
+func (flow *Flow) index(stor store.Store) []string {
+	ids := []string{}
+	if value, has := stor.Get(fmt.Sprintf("workflows.index:%s", flow.id())); has {
+		if data, ok := value.(string); ok {
+			jsoniter.UnmarshalFromString(data, &ids)
+		}
+	}
+	return ids
+}
+
+// indexed add the running or the waiting instance to the index of the flow, remove the finished instance. it runs under the save lock
+func (flow *Flow) indexed(stor store.Store, inst *Instance) error {
+	active := inst.Status == StatusRunning || inst.Status == StatusWaiting
+	ids := flow.index(stor)
+	res := []string{}
+	has := false
+	for _, id := range ids {
+		if id == inst.ID {
+			has = true
+			if !active {
+				continue
+			}
+		}
+		res = append(res, id)
+	}
+
+	if has == active {
+		return nil
+	}
+
+	if active {
+		res = append(res, inst.ID)
+	}
+
+	data, err := jsoniter.MarshalToString(res)
+	if err != nil {
+		return err
+	}
+	return stor.Set(fmt.Sprintf("workflows.index:%s", flow.id()), data, 0)
+}
+
+// lease take or renew the lease of the running instance, the lease of the other server is rejected until expired
+func (flow *Flow) lease(id string) error {
+	stor, err := flow.store()
+	if err != nil {
+		return err
+	}
+
+	saveLock.Lock()
+	defer saveLock.Unlock()
+	if owner, leased := flow.leased(stor, id); leased && owner != Owner {
+		return fmt.Errorf("workflow %s is running on %s", id, owner)
+	}
+	return stor.Set(fmt.Sprintf("workflows.lease:%s", id), fmt.Sprintf("%s|%d", Owner, time.Now().Add(leaseTTL).UnixNano()), leaseTTL)
+}
+
+// release the lease of the instance
+func (flow *Flow) release(id string) {
+	stor, err := flow.store()
+	if err != nil {
+		return
+	}
+
+	saveLock.Lock()
+	defer saveLock.Unlock()
+	if owner, leased := flow.leased(stor, id); leased && owner == Owner {
+		stor.Del(fmt.Sprintf("workflows.lease:%s", id))
+	}
+}
+
+// leased the owner of the unexpired lease of the instance
+func (flow *Flow) leased(stor store.Store, id string) (string, bool) {
+	value, has := stor.Get(fmt.Sprintf("workflows.lease:%s", id))
+	if !has {
+		return "", false
+	}
+
+	data, _ := value.(string)
+	owner, expires, ok := strings.Cut(data, "|")
+	if !ok {
+		return "", false
+	}
+
+	nano, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().UnixNano() > nano {
+		return "", false
+	}
+	return owner, true
+}
+
+// store the store of the durable workflow
+func (flow *Flow) store() (store.Store, error) {
+	if flow.Durable == nil {
+		return nil, fmt.Errorf("flows.%s is not a durable workflow", flow.id())
+	}
+
+	stor, has := store.Pools[flow.Durable.Store]
+	if !has {
+		return nil, fmt.Errorf("flows.%s: the store %s does not load", flow.id(), flow.Durable.Store)
+	}
+	return stor, nil
+}
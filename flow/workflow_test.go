@@ -0,0 +1,213 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/gou/store"
+	"github.com/yaoapp/kun/any"
+)
+
+func TestWorkflow(t *testing.T) {
+	prepareWorkflow(t)
+	defer cleanWorkflow()
+
+	flow := Flows["unit.approval"]
+	inst, err := flow.Start(context.Background(), "", nil, "doc-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StatusWaiting, inst.Status)
+	assert.Equal(t, "approval", inst.Waiting)
+	assert.Equal(t, "doc-1", inst.Res["submit"])
+
+	// the wrong signal
+	_, err = Signal(context.Background(), inst.ID, "reject", nil)
+	assert.NotNil(t, err)
+
+	// the instance is loaded from the store, eg: the server restarted
+	inst, err = Signal(context.Background(), inst.ID, "approval", map[string]interface{}{"by": "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StatusCompleted, inst.Status)
+	assert.Equal(t, map[string]interface{}{"doc": "doc-1", "by": "admin"}, inst.Output)
+
+	_, saved, err := Query(inst.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StatusCompleted, saved.Status)
+	assert.Equal(t, 3, saved.Step)
+
+	_, err = Signal(context.Background(), inst.ID, "approval", nil)
+	assert.NotNil(t, err)
+}
+
+func TestWorkflowSignalOnce(t *testing.T) {
+	prepareWorkflow(t)
+	defer cleanWorkflow()
+
+	flow := Flows["unit.approval"]
+	inst, err := flow.Start(context.Background(), "", nil, "doc-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stale instance is not saved
+	_, stale, err := Query(inst.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the concurrent signals, the instance is signaled once
+	var succeeded int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Signal(context.Background(), inst.ID, "approval", map[string]interface{}{"by": "admin"}); err == nil {
+				atomic.AddInt32(&succeeded, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), succeeded)
+
+	stale.Status = StatusCanceled
+	assert.NotNil(t, flow.save(stale))
+
+	_, saved, err := Query(inst.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StatusCompleted, saved.Status)
+}
+
+func TestWorkflowResumeCancel(t *testing.T) {
+	prepareWorkflow(t)
+	defer cleanWorkflow()
+
+	flow := Flows["unit.approval"]
+
+	// the server stopped after the first node checkpointed
+	inst := &Instance{ID: "unit.approval:crashed", Flow: "unit.approval", Status: StatusRunning, Step: 1,
+		In: []interface{}{"doc-2"}, Res: map[string]interface{}{"submit": "doc-2"}}
+	err := flow.save(inst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stor, err := flow.store()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, flow.index(stor), "unit.approval:crashed")
+
+	// the instance is running on another server
+	lease := fmt.Sprintf("other|%d", time.Now().Add(time.Minute).UnixNano())
+	stor.Set("workflows.lease:unit.approval:crashed", lease, time.Minute)
+	errs := Recover(context.Background())
+	assert.Empty(t, errs)
+	_, err = Resume(context.Background(), "unit.approval:crashed")
+	assert.NotNil(t, err)
+	_, inst, err = Query("unit.approval:crashed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StatusRunning, inst.Status)
+
+	// the lease expired
+	lease = fmt.Sprintf("other|%d", time.Now().Add(-time.Second).UnixNano())
+	stor.Set("workflows.lease:unit.approval:crashed", lease, time.Minute)
+	errs = Recover(context.Background())
+	assert.Empty(t, errs)
+
+	_, inst, err = Query("unit.approval:crashed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StatusWaiting, inst.Status)
+
+	_, err = Resume(context.Background(), inst.ID)
+	assert.NotNil(t, err)
+
+	inst, err = Cancel(inst.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StatusCanceled, inst.Status)
+	assert.NotContains(t, flow.index(stor), "unit.approval:crashed")
+	_, has := stor.Get("workflows.lease:unit.approval:crashed")
+	assert.False(t, has)
+
+	_, err = Signal(context.Background(), inst.ID, "approval", nil)
+	assert.NotNil(t, err)
+
+	// the failed node
+	Flows["unit.failed"] = &Flow{Name: "unit.failed", Durable: flow.Durable, Nodes: []Node{
+		{Name: "fail", Process: "unit.flow.fail", Args: []interface{}{"workflow", 1}},
+	}}
+	defer delete(Flows, "unit.failed")
+
+	inst, err = Flows["unit.failed"].Start(context.Background(), "", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, StatusFailed, inst.Status)
+	assert.Contains(t, inst.Error, "unit.flow.fail workflow 1")
+}
+
+func TestWorkflowProcess(t *testing.T) {
+	prepareWorkflow(t)
+	defer cleanWorkflow()
+
+	res, err := process.New("workflows.Start", "unit.approval", "doc-3").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := any.Of(res).MapStr().Get("id").(string)
+	res, err = process.New("workflows.Query", id).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StatusWaiting, any.Of(res).MapStr().Get("status"))
+
+	res, err = process.New("workflows.Signal", id, "approval", map[string]interface{}{"by": "admin"}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StatusCompleted, any.Of(res).MapStr().Get("status"))
+
+	_, err = process.New("workflows.Cancel", id).Exec()
+	assert.NotNil(t, err)
+
+	_, err = process.New("workflows.Query", "unit.approval:missing").Exec()
+	assert.NotNil(t, err)
+}
+
+func prepareWorkflow(t *testing.T) {
+	prepareUnitProcesses()
+	stor, err := store.New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Pools["workflow-tests"] = stor
+
+	Flows["unit.approval"] = &Flow{Name: "unit.approval", Durable: &DurableOption{Store: "workflow-tests"}, Nodes: []Node{
+		{Name: "submit", Process: "unit.flow.echo", Args: []interface{}{"{{$in.0}}"}},
+		{Name: "approve", Wait: &Wait{Signal: "approval"}},
+		{Name: "notify", Process: "unit.flow.echo", Args: []interface{}{"{{$res.approve.by}}"}},
+	}, Output: map[string]interface{}{"doc": "{{$res.submit}}", "by": "{{$res.notify}}"}}
+}
+
+func cleanWorkflow() {
+	delete(Flows, "unit.approval")
+	delete(store.Pools, "workflow-tests")
+}
@@ -9,8 +9,10 @@ import (
 	"strings"
 	"time"
 
+	jsoniter "github.com/json-iterator/go"
 	"github.com/yaoapp/gou/connector"
 	"github.com/yaoapp/gou/fs/system"
+	"github.com/yaoapp/gou/types"
 	"github.com/yaoapp/kun/exception"
 )
 
@@ -514,3 +516,117 @@ func DirName(name string) string {
 func ExtName(name string) string {
 	return strings.TrimPrefix(filepath.Ext(name), ".")
 }
+
+// UploadDir the temp directory of the chunk files of the upload
+func UploadDir(uid string) string {
+	return filepath.ToSlash(filepath.Join("upload", "tmp", uid))
+}
+
+// UploadProgress the progress of the chunk files in the temp directory
+func UploadProgress(xfs FileSystem, dir string) (types.UploadProgress, error) {
+	return uploadProgress(xfs, dir)
+}
+
+// ChunkFiles the chunk files in the temp directory in order
+func ChunkFiles(xfs FileSystem, dir string) ([]string, error) {
+	return getChunkFiles(xfs, dir, true)
+}
+
+// MergeChunks merge the chunk files in the temp directory to the file in order, the chunk files are removed
+func MergeChunks(xfs FileSystem, dir string, dst string) error {
+	files, err := getChunkFiles(xfs, dir, true)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		err := MoveAppend(xfs, file, dst)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanUploads remove the partial uploads which are not modified in the duration, returns the number of the removed uploads.
+// the resumable uploads with the information file, eg: upload/tmp/<uid>.tus, are removed when the expires of the file is passed
+func CleanUploads(xfs FileSystem, expiration time.Duration) (int, error) {
+	root := filepath.ToSlash(filepath.Join("upload", "tmp"))
+	if has, _ := xfs.Exists(root); !has {
+		return 0, nil
+	}
+
+	files, err := xfs.ReadDir(root, false)
+	if err != nil {
+		return 0, err
+	}
+
+	// the upload => the information file
+	uploads := map[string]string{}
+	names := []string{}
+	for _, file := range files {
+		name := strings.TrimSuffix(file, ".tus")
+		if _, has := uploads[name]; !has {
+			names = append(names, name)
+			uploads[name] = ""
+		}
+		if name != file {
+			uploads[name] = file
+		}
+	}
+
+	count := 0
+	now := time.Now()
+	for _, name := range names {
+		expires, err := uploadExpires(xfs, name, uploads[name], expiration)
+		if err != nil {
+			return count, err
+		}
+
+		if now.Before(expires) {
+			continue
+		}
+
+		for _, file := range []string{name, uploads[name]} {
+			if file == "" {
+				continue
+			}
+
+			if has, _ := xfs.Exists(file); !has {
+				continue
+			}
+			err = xfs.RemoveAll(file)
+			if err != nil {
+				return count, err
+			}
+		}
+		count++
+	}
+	return count, nil
+}
+
+// uploadExpires the expires of the partial upload, by the information file or the modified time
+func uploadExpires(xfs FileSystem, name string, info string, expiration time.Duration) (time.Time, error) {
+	if info != "" {
+		data, err := xfs.ReadFile(info)
+		if err == nil {
+			var value struct {
+				Expires int64 `json:"expires"`
+			}
+			if err := jsoniter.Unmarshal(data, &value); err == nil && value.Expires > 0 {
+				return time.Unix(value.Expires, 0), nil
+			}
+		}
+	}
+
+	file := name
+	if has, _ := xfs.Exists(file); !has {
+		file = info
+	}
+
+	modtime, err := xfs.ModTime(file)
+	if err != nil {
+		return modtime, err
+	}
+	return modtime.Add(expiration), nil
+}
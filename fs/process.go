@@ -3,7 +3,6 @@ package fs
 import (
 	"fmt"
 	"os"
-	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -50,6 +49,7 @@ var FileSystemHandlers = map[string]process.Handler{
 	"moveinsert":       processMoveInsert,
 	"copy":             processCopy,
 	"upload":           processUpload,
+	"cleanuploads":     processCleanUploads,
 	"download":         processDownload,
 	"zip":              processZip,
 	"unzip":            processUnzip,
@@ -528,7 +528,7 @@ func processUpload(process *process.Process) interface{} {
 		}
 
 		// Async upload, the chunk file will be saved to the temp directory.
-		tmpDir := path.Join("upload", "tmp", uid)
+		tmpDir := UploadDir(uid)
 		err := stor.MkdirAll(tmpDir, uint32(os.ModePerm))
 		if err != nil {
 			exception.New(err.Error(), 500).Throw()
@@ -560,19 +560,11 @@ func processUpload(process *process.Process) interface{} {
 				validateAcceptType(stor, filename, props.Get("accept"), true)
 			}
 
-			// Get Files
-			files, err := getChunkFiles(stor, tmpDir, true)
+			// Merge the chunk files.
+			err := MergeChunks(stor, tmpDir, filename)
 			if err != nil {
 				exception.New(err.Error(), 500).Throw()
 			}
-
-			// Merge the chunk files.
-			for _, file := range files {
-				err := MoveAppend(stor, file, filename)
-				if err != nil {
-					exception.New(err.Error(), 500).Throw()
-				}
-			}
 			return filename
 		}
 
@@ -601,6 +593,18 @@ func processUpload(process *process.Process) interface{} {
 	return filename
 }
 
+// fs.<name>.CleanUploads
+// args: [seconds?] remove the partial uploads which are not modified in the seconds, the default is 86400. the tus uploads are removed by the expires
+func processCleanUploads(process *process.Process) interface{} {
+	stor := stor(process)
+	seconds := process.ArgsInt(0, 86400)
+	count, err := CleanUploads(stor, time.Duration(seconds)*time.Second)
+	if err != nil {
+		exception.New(err.Error(), 500).Throw()
+	}
+	return count
+}
+
 func processDownload(process *process.Process) interface{} {
 
 	process.ValidateArgNums(1)
@@ -0,0 +1,275 @@
+package helper
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var patterns = sync.Map{}
+
+// ValidateSchema validate the value with the JSON schema, the path is the name of the value in the error messages.
+// the subset of the JSON schema is supported:
+// type, enum, const, properties, required, additionalProperties (bool), items, minItems, maxItems,
+// minLength, maxLength, pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum, oneOf, anyOf
+func ValidateSchema(schema map[string]interface{}, value interface{}, path string) []string {
+	if schema == nil {
+		return nil
+	}
+
+	errs := []string{}
+	if typ, has := schema["type"]; has {
+		types := []string{}
+		switch t := typ.(type) {
+		case string:
+			types = append(types, t)
+		case []interface{}:
+			for _, item := range t {
+				types = append(types, fmt.Sprintf("%v", item))
+			}
+		case []string:
+			types = t
+		}
+
+		matched := false
+		for _, name := range types {
+			if schemaType(name, value) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return append(errs, fmt.Sprintf("%s should be %s", path, strings.Join(types, " or ")))
+		}
+	}
+
+	if value == nil {
+		return errs
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		matched := false
+		for _, item := range enum {
+			if schemaEqual(item, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			errs = append(errs, fmt.Sprintf("%s should be one of %v", path, enum))
+		}
+	}
+
+	if constant, has := schema["const"]; has && !schemaEqual(constant, value) {
+		errs = append(errs, fmt.Sprintf("%s should be %v", path, constant))
+	}
+
+	if options, ok := schema["oneOf"].([]interface{}); ok {
+		if n := schemaMatches(options, value, path); n != 1 {
+			errs = append(errs, fmt.Sprintf("%s should match exactly one schema of oneOf, %d matched", path, n))
+		}
+	}
+
+	if options, ok := schema["anyOf"].([]interface{}); ok {
+		if n := schemaMatches(options, value, path); n == 0 {
+			errs = append(errs, fmt.Sprintf("%s should match at least one schema of anyOf", path))
+		}
+	}
+
+	if str, ok := value.(string); ok {
+		length := utf8.RuneCountInString(str)
+		if min, ok := schemaNumber(schema["minLength"]); ok && float64(length) < min {
+			errs = append(errs, fmt.Sprintf("%s should be at least %v characters", path, min))
+		}
+
+		if max, ok := schemaNumber(schema["maxLength"]); ok && float64(length) > max {
+			errs = append(errs, fmt.Sprintf("%s should be at most %v characters", path, max))
+		}
+
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := schemaPattern(pattern)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s the pattern %s is invalid", path, pattern))
+			} else if !re.MatchString(str) {
+				errs = append(errs, fmt.Sprintf("%s should match the pattern %s", path, pattern))
+			}
+		}
+	}
+
+	if num, ok := schemaNumber(value); ok {
+		if min, ok := schemaNumber(schema["minimum"]); ok && num < min {
+			errs = append(errs, fmt.Sprintf("%s should be >= %v", path, min))
+		}
+
+		if max, ok := schemaNumber(schema["maximum"]); ok && num > max {
+			errs = append(errs, fmt.Sprintf("%s should be <= %v", path, max))
+		}
+
+		if min, ok := schemaNumber(schema["exclusiveMinimum"]); ok && num <= min {
+			errs = append(errs, fmt.Sprintf("%s should be > %v", path, min))
+		}
+
+		if max, ok := schemaNumber(schema["exclusiveMaximum"]); ok && num >= max {
+			errs = append(errs, fmt.Sprintf("%s should be < %v", path, max))
+		}
+	}
+
+	reflectValue := reflect.ValueOf(value)
+	switch reflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		length := reflectValue.Len()
+		if min, ok := schemaNumber(schema["minItems"]); ok && float64(length) < min {
+			errs = append(errs, fmt.Sprintf("%s should have at least %v items", path, min))
+		}
+
+		if max, ok := schemaNumber(schema["maxItems"]); ok && float64(length) > max {
+			errs = append(errs, fmt.Sprintf("%s should have at most %v items", path, max))
+		}
+
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i := 0; i < length; i++ {
+				errs = append(errs, ValidateSchema(items, reflectValue.Index(i).Interface(), fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+
+	case reflect.Map:
+		if reflectValue.Type().Key().Kind() != reflect.String {
+			break
+		}
+
+		fields := map[string]interface{}{}
+		for _, key := range reflectValue.MapKeys() {
+			fields[key.String()] = reflectValue.MapIndex(key).Interface()
+		}
+
+		required := []string{}
+		switch r := schema["required"].(type) {
+		case []interface{}:
+			for _, name := range r {
+				required = append(required, fmt.Sprintf("%v", name))
+			}
+		case []string:
+			required = r
+		}
+
+		for _, name := range required {
+			if _, has := fields[name]; !has {
+				errs = append(errs, fmt.Sprintf("%s.%s is required", path, name))
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := []string{}
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			prop, has := properties[name]
+			if !has {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					errs = append(errs, fmt.Sprintf("%s.%s is not allowed", path, name))
+				}
+				continue
+			}
+
+			if propSchema, ok := prop.(map[string]interface{}); ok {
+				errs = append(errs, ValidateSchema(propSchema, fields[name], fmt.Sprintf("%s.%s", path, name))...)
+			}
+		}
+	}
+
+	return errs
+}
+
+// schemaType check the type of the value
+func schemaType(name string, value interface{}) bool {
+	switch name {
+	case "null":
+		return value == nil
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := schemaNumber(value)
+		return ok
+	case "integer":
+		num, ok := schemaNumber(value)
+		return ok && num == float64(int64(num))
+	case "array":
+		if value == nil {
+			return false
+		}
+		kind := reflect.TypeOf(value).Kind()
+		return kind == reflect.Slice || kind == reflect.Array
+	case "object":
+		if value == nil {
+			return false
+		}
+		typ := reflect.TypeOf(value)
+		return typ.Kind() == reflect.Map && typ.Key().Kind() == reflect.String
+	}
+	return false
+}
+
+// schemaNumber cast the value as float64 if the value is a number
+func schemaNumber(value interface{}) (float64, bool) {
+	if value == nil {
+		return 0, false
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// schemaEqual compare the values, the numbers are compared by the value
+func schemaEqual(a, b interface{}) bool {
+	na, oka := schemaNumber(a)
+	nb, okb := schemaNumber(b)
+	if oka && okb {
+		return na == nb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// schemaMatches count the schemas matched the value
+func schemaMatches(options []interface{}, value interface{}, path string) int {
+	n := 0
+	for _, option := range options {
+		if schema, ok := option.(map[string]interface{}); ok && len(ValidateSchema(schema, value, path)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// schemaPattern compile the pattern with cache
+func schemaPattern(pattern string) (*regexp.Regexp, error) {
+	if re, has := patterns.Load(pattern); has {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
@@ -0,0 +1,82 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSchema(t *testing.T) {
+	object := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"name"},
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string", "minLength": 2},
+			"address": map[string]interface{}{
+				"type":                 "object",
+				"required":             []string{"city"},
+				"additionalProperties": false,
+				"properties": map[string]interface{}{
+					"city": map[string]interface{}{"type": "string"},
+					"zip":  map[string]interface{}{"type": "string", "pattern": "^[0-9]{5}$"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		schema map[string]interface{}
+		value  interface{}
+		errs   []string
+	}{
+		{"nil schema", nil, "any", nil},
+		{"string", map[string]interface{}{"type": "string"}, "a", []string{}},
+		{"string mismatch", map[string]interface{}{"type": "string"}, 1, []string{"v should be string"}},
+		{"integer", map[string]interface{}{"type": "integer"}, 3.0, []string{}},
+		{"integer mismatch", map[string]interface{}{"type": "integer"}, 3.5, []string{"v should be integer"}},
+		{"type union", map[string]interface{}{"type": []interface{}{"string", "null"}}, nil, []string{}},
+		{"type union string", map[string]interface{}{"type": []string{"string", "array"}}, []interface{}{"a"}, []string{}},
+		{"type union mismatch", map[string]interface{}{"type": []interface{}{"string", "null"}}, true, []string{"v should be string or null"}},
+
+		{"enum", map[string]interface{}{"enum": []interface{}{"a", 1}}, 1.0, []string{}},
+		{"enum mismatch", map[string]interface{}{"enum": []interface{}{"a", "b"}}, "c", []string{"v should be one of [a b]"}},
+		{"const", map[string]interface{}{"const": "a"}, "b", []string{"v should be a"}},
+
+		{"minimum", map[string]interface{}{"minimum": 1}, 1, []string{}},
+		{"minimum mismatch", map[string]interface{}{"minimum": 1}, 0.5, []string{"v should be >= 1"}},
+		{"maximum mismatch", map[string]interface{}{"maximum": 10}, int64(11), []string{"v should be <= 10"}},
+		{"exclusive minimum", map[string]interface{}{"exclusiveMinimum": 0}, 0, []string{"v should be > 0"}},
+		{"exclusive maximum", map[string]interface{}{"exclusiveMaximum": 10}, 10, []string{"v should be < 10"}},
+		{"exclusive bounds", map[string]interface{}{"exclusiveMinimum": 0, "exclusiveMaximum": 10}, 5, []string{}},
+
+		{"min length", map[string]interface{}{"minLength": 2}, "你", []string{"v should be at least 2 characters"}},
+		{"max length", map[string]interface{}{"maxLength": 2}, "你好", []string{}},
+		{"pattern", map[string]interface{}{"pattern": "^[a-z]+$"}, "abc", []string{}},
+		{"pattern mismatch", map[string]interface{}{"pattern": "^[a-z]+$"}, "ABC", []string{"v should match the pattern ^[a-z]+$"}},
+		{"pattern invalid", map[string]interface{}{"pattern": "("}, "a", []string{"v the pattern ( is invalid"}},
+
+		{"items", map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "integer"}}, []interface{}{1, "2", 3.5},
+			[]string{"v[1] should be integer", "v[2] should be integer"}},
+		{"min items", map[string]interface{}{"minItems": 2}, []string{"a"}, []string{"v should have at least 2 items"}},
+		{"max items", map[string]interface{}{"maxItems": 1}, []int{1, 2}, []string{"v should have at most 1 items"}},
+
+		{"required", object, map[string]interface{}{}, []string{"v.name is required"}},
+		{"properties", object, map[string]interface{}{"name": "a", "other": 1}, []string{"v.name should be at least 2 characters"}},
+		{"nested properties", object, map[string]interface{}{"name": "ab", "address": map[string]interface{}{"zip": "1234", "street": "x"}},
+			[]string{"v.address.city is required", "v.address.street is not allowed", "v.address.zip should match the pattern ^[0-9]{5}$"}},
+		{"nested valid", object, map[string]interface{}{"name": "ab", "address": map[string]interface{}{"city": "x", "zip": "12345"}}, []string{}},
+
+		{"one of", map[string]interface{}{"oneOf": []interface{}{map[string]interface{}{"type": "string"}, map[string]interface{}{"type": "number"}}}, 1, []string{}},
+		{"one of mismatch", map[string]interface{}{"oneOf": []interface{}{map[string]interface{}{"type": "number"}, map[string]interface{}{"minimum": 0}}}, 1,
+			[]string{"v should match exactly one schema of oneOf, 2 matched"}},
+		{"any of mismatch", map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "string"}}}, 1,
+			[]string{"v should match at least one schema of anyOf"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.errs, ValidateSchema(test.schema, test.value, "v"))
+		})
+	}
+}
@@ -0,0 +1,543 @@
+package migration
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/application"
+	"github.com/yaoapp/gou/connector"
+	"github.com/yaoapp/gou/connector/database"
+	"github.com/yaoapp/gou/model"
+	"github.com/yaoapp/gou/schema"
+	"github.com/yaoapp/gou/schema/types"
+	"github.com/yaoapp/kun/any"
+	"github.com/yaoapp/xun"
+	"github.com/yaoapp/xun/capsule"
+	"github.com/yaoapp/xun/dbal/query"
+)
+
+// Dir the directory of the migration files in the application
+var Dir = "migrations"
+
+// Table the table of the applied migrations
+var Table = "__yao_migrations"
+
+var lock sync.Mutex
+var lastVersion time.Time
+
+// versionLayout the layout of the timestamp versions
+const versionLayout = "20060102150405"
+
+// Make compare the model with the live table and write the migration file.
+// the pending migrations of the table are applied to the live table before comparing, the changes are not made twice.
+// return nil if the table is up to date
+func Make(mod *model.Model) (*Migration, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if mod.MetaData.Option.Readonly {
+		return nil, nil
+	}
+
+	connector := mod.MetaData.Connector
+	if connector == "" {
+		connector = "default"
+	}
+
+	table := mod.MetaData.Table.Name
+	if table == "" {
+		return nil, fmt.Errorf("%s missing table name", mod.ID)
+	}
+
+	blueprint, err := mod.Blueprint()
+	if err != nil {
+		return nil, err
+	}
+
+	sch, err := schema.Select(connector)
+	if err != nil {
+		return nil, err
+	}
+
+	has, err := sch.TableExists(table)
+	if err != nil {
+		return nil, err
+	}
+
+	current := types.Blueprint{}
+	if has {
+		current, err = sch.TableGet(table)
+		if err != nil {
+			return nil, err
+		}
+		current.Foreigns = current.ManagedForeigns(blueprint)
+	}
+
+	pending, err := pendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mig := range pending {
+		if mig.Table != table || (mig.Connector != connector && !(mig.Connector == "" && connector == "default")) {
+			continue
+		}
+
+		switch {
+		case mig.Up.Drop:
+			has = false
+			current = types.Blueprint{}
+		case mig.Up.Create != nil:
+			has = true
+			current = *mig.Up.Create
+		default:
+			current = mig.Up.Diff().Patch(current)
+		}
+	}
+
+	mig := &Migration{Name: mod.ID, Connector: connector, Table: table}
+	if !has {
+		mig.Up = Step{Create: &blueprint}
+		mig.Down = Step{Drop: true}
+
+	} else {
+		up, err := types.Compare(current, blueprint)
+		if err != nil {
+			return nil, err
+		}
+
+		down, err := types.Compare(blueprint, current)
+		if err != nil {
+			return nil, err
+		}
+
+		mig.Up = NewStep(up)
+		mig.Down = NewStep(down)
+		if mig.Up.IsEmpty() {
+			return nil, nil
+		}
+	}
+
+	mig.Version, err = version()
+	if err != nil {
+		return nil, err
+	}
+	err = mig.Save()
+	if err != nil {
+		return nil, err
+	}
+	return mig, nil
+}
+
+// Save write the migration file to the application
+func (mig *Migration) Save() error {
+	if mig.File == "" {
+		name := strings.ReplaceAll(mig.Name, ".", "_")
+		mig.File = filepath.Join(Dir, fmt.Sprintf("%s_%s.mig.yao", mig.Version, name))
+	}
+
+	data, err := jsoniter.MarshalIndent(mig, "", "  ")
+	if err != nil {
+		return err
+	}
+	return application.App.Write(mig.File, data)
+}
+
+// Load read the migration files of the application, sorted by version
+func Load() ([]*Migration, error) {
+	migrations := []*Migration{}
+	exists, err := application.App.Exists(Dir)
+	if err != nil || !exists {
+		return migrations, err
+	}
+
+	err = application.App.Walk(Dir, func(root, file string, isdir bool) error {
+		if isdir {
+			return nil
+		}
+
+		data, err := application.App.Read(file)
+		if err != nil {
+			return err
+		}
+
+		mig := Migration{}
+		err = application.Parse(file, data, &mig)
+		if err != nil {
+			return err
+		}
+
+		mig.File = file
+		migrations = append(migrations, &mig)
+		return nil
+	}, "*.mig.yao")
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up apply the pending migrations, when dryRun is true, return the SQL only (MySQL only)
+func Up(dryRun bool) ([]Result, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(connectorsOf(migrations), !dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, mig := range migrations {
+		if _, has := applied[mig.Version]; has {
+			continue
+		}
+
+		driver, err := dryRunDriver(mig, dryRun)
+		if err != nil {
+			return results, fmt.Errorf("migration %s up: %s", mig.Version, err.Error())
+		}
+
+		if !dryRun {
+			sch, err := schema.Select(mig.Connector)
+			if err != nil {
+				return results, fmt.Errorf("migration %s up: %s", mig.Version, err.Error())
+			}
+
+			err = mig.Up.Apply(sch, mig.Table)
+			if err != nil {
+				return results, fmt.Errorf("migration %s up: %s", mig.Version, err.Error())
+			}
+
+			qb, err := queryOf(mig.Connector)
+			if err != nil {
+				return results, err
+			}
+
+			err = qb.Table(Table).Insert(map[string]interface{}{
+				"version":    mig.Version,
+				"name":       mig.Name,
+				"table_name": mig.Table,
+				"applied_at": time.Now(),
+			})
+			if err != nil {
+				return results, err
+			}
+		}
+
+		results = append(results, mig.result(mig.Up, driver))
+	}
+
+	return results, nil
+}
+
+// Down roll back the latest applied migrations, when dryRun is true, return the SQL only (MySQL only)
+func Down(steps int, dryRun bool) ([]Result, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if steps < 1 {
+		steps = 1
+	}
+
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := map[string]*Migration{}
+	for _, mig := range migrations {
+		mapping[mig.Version] = mig
+	}
+
+	applied, err := appliedVersions(connectorsOf(migrations), !dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(versions)))
+	if len(versions) > steps {
+		versions = versions[:steps]
+	}
+
+	results := []Result{}
+	for _, version := range versions {
+		mig, has := mapping[version]
+		if !has {
+			return results, fmt.Errorf("migration %s file not found", version)
+		}
+
+		driver, err := dryRunDriver(mig, dryRun)
+		if err != nil {
+			return results, fmt.Errorf("migration %s down: %s", mig.Version, err.Error())
+		}
+
+		if !dryRun {
+			sch, err := schema.Select(mig.Connector)
+			if err != nil {
+				return results, fmt.Errorf("migration %s down: %s", mig.Version, err.Error())
+			}
+
+			err = mig.Down.Apply(sch, mig.Table)
+			if err != nil {
+				return results, fmt.Errorf("migration %s down: %s", mig.Version, err.Error())
+			}
+
+			qb, err := queryOf(applied[version].connector)
+			if err != nil {
+				return results, err
+			}
+
+			_, err = qb.Table(Table).Where("version", version).Delete()
+			if err != nil {
+				return results, err
+			}
+		}
+
+		results = append(results, mig.result(mig.Down, driver))
+	}
+
+	return results, nil
+}
+
+// Status get the status of the migrations
+func Status() ([]State, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(connectorsOf(migrations), false)
+	if err != nil {
+		return nil, err
+	}
+
+	status := []State{}
+	for _, mig := range migrations {
+		row, has := applied[mig.Version]
+		stat := State{Version: mig.Version, Name: mig.Name, Table: mig.Table, File: mig.File, Applied: has}
+		if has {
+			stat.AppliedAt = row.row["applied_at"]
+		}
+		status = append(status, stat)
+		delete(applied, mig.Version)
+	}
+
+	// the applied migrations without file
+	for version, row := range applied {
+		status = append(status, State{
+			Version:   version,
+			Name:      any.Of(row.row["name"]).CString(),
+			Table:     any.Of(row.row["table_name"]).CString(),
+			Applied:   true,
+			AppliedAt: row.row["applied_at"],
+		})
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+	return status, nil
+}
+
+// result the result of the step, the SQL is made for MySQL only
+func (mig *Migration) result(step Step, driver string) Result {
+	res := Result{Version: mig.Version, Name: mig.Name, Table: mig.Table}
+	if driver == "mysql" {
+		res.SQL = step.SQL(mig.Table)
+	}
+	return res
+}
+
+// dryRunDriver get the driver of the connector of the migration, the dry-run SQL is made for MySQL only
+func dryRunDriver(mig *Migration, dryRun bool) (string, error) {
+	manager, err := managerOf(mig.Connector)
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := manager.Primary()
+	if err != nil {
+		return "", err
+	}
+
+	if dryRun && conn.Config.Driver != "mysql" {
+		return "", fmt.Errorf("the dry-run is supported on MySQL only, the driver is %s", conn.Config.Driver)
+	}
+	return conn.Config.Driver, nil
+}
+
+// appliedRecord the applied migration recorded in the database of the connector
+type appliedRecord struct {
+	row       xun.R
+	connector string
+}
+
+// appliedVersions get the applied migrations recorded in the databases of the connectors, create the migrations tables if create is true
+func appliedVersions(connectors []string, create bool) (map[string]appliedRecord, error) {
+	versions := map[string]appliedRecord{}
+	for _, name := range connectors {
+		sch, err := schema.Select(name)
+		if err != nil {
+			return nil, err
+		}
+
+		has, err := sch.TableExists(Table)
+		if err != nil {
+			return nil, err
+		}
+
+		if !has {
+			if !create {
+				continue
+			}
+
+			err = sch.TableCreate(Table, types.Blueprint{
+				Columns: []types.Column{
+					{Name: "id", Type: "ID"},
+					{Name: "version", Type: "string", Length: 32, Unique: true},
+					{Name: "name", Type: "string", Length: 200},
+					{Name: "table_name", Type: "string", Length: 200},
+					{Name: "applied_at", Type: "timestamp", Nullable: true},
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		qb, err := queryOf(name)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := qb.Table(Table).OrderBy("version").Get()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			version := any.Of(row["version"]).CString()
+			if _, has := versions[version]; !has {
+				versions[version] = appliedRecord{row: row, connector: name}
+			}
+		}
+	}
+	return versions, nil
+}
+
+// pendingMigrations the migrations not applied yet, sorted by version
+func pendingMigrations() ([]*Migration, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := appliedVersions(connectorsOf(migrations), false)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []*Migration{}
+	for _, mig := range migrations {
+		if _, has := versions[mig.Version]; !has {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+// connectorsOf the connectors of the migrations, the default connector is always included (the migrations applied before were recorded in it)
+func connectorsOf(migrations []*Migration) []string {
+	names := []string{}
+	has := map[string]bool{"default": true}
+	for _, mig := range migrations {
+		name := mig.Connector
+		if name == "" {
+			name = "default"
+		}
+		if !has[name] {
+			has[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{"default"}, names...)
+}
+
+// queryOf the query builder of the connector
+func queryOf(name string) (query.Query, error) {
+	manager, err := managerOf(name)
+	if err != nil {
+		return nil, err
+	}
+	return manager.Query(), nil
+}
+
+// managerOf get the database manager of the connector, the global one if the name is empty or default
+func managerOf(name string) (*capsule.Manager, error) {
+	if name == "" || name == "default" {
+		if capsule.Global == nil {
+			return nil, fmt.Errorf("the default database is not connected")
+		}
+		return capsule.Global, nil
+	}
+
+	c, err := connector.Select(name)
+	if err != nil {
+		return nil, err
+	}
+
+	db, ok := c.(*database.Xun)
+	if !ok || db.Manager == nil {
+		return nil, fmt.Errorf("connector %s is not a connected database", name)
+	}
+	return db.Manager, nil
+}
+
+// version make an unique timestamp version, eg: 20240102150405.
+// the version is later than the last made one and the ones of the migration files
+func version() (string, error) {
+	migrations, err := Load()
+	if err != nil {
+		return "", err
+	}
+
+	last := lastVersion
+	for _, mig := range migrations {
+		v, err := time.ParseInLocation(versionLayout, mig.Version, time.Local)
+		if err == nil && v.After(last) {
+			last = v
+		}
+	}
+
+	v := time.Now().Truncate(time.Second)
+	if !v.After(last) {
+		v = last.Add(time.Second)
+	}
+	lastVersion = v
+	return v.Format(versionLayout), nil
+}
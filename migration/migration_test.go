@@ -0,0 +1,336 @@
+package migration
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/application"
+	"github.com/yaoapp/gou/model"
+	"github.com/yaoapp/gou/schema"
+	"github.com/yaoapp/xun/capsule"
+)
+
+const userSource = `{
+	"name": "Migration User",
+	"table": { "name": "migration_tests_user" },
+	"columns": [
+		{ "name": "id", "type": "ID" },
+		{ "name": "name", "type": "string", "length": 80, "nullable": true }
+	]
+}`
+
+const userSourceV2 = `{
+	"name": "Migration User",
+	"table": { "name": "migration_tests_user" },
+	"columns": [
+		{ "name": "id", "type": "ID" },
+		{ "name": "name", "type": "string", "length": 80, "nullable": true },
+		{ "name": "mobile", "type": "string", "length": 20, "nullable": true }
+	]
+}`
+
+const petSource = `{
+	"name": "Migration Pet",
+	"table": { "name": "migration_tests_pet" },
+	"columns": [
+		{ "name": "id", "type": "ID" },
+		{ "name": "user_id", "type": "unsignedBigInteger", "nullable": true, "index": true }
+	],
+	"relations": {
+		"user": { "type": "hasOne", "model": "migration.tests.user", "key": "id", "foreign": "user_id", "on_delete": "cascade" }
+	},
+	"option": { "constraints": true }
+}`
+
+func TestMigrationForeigns(t *testing.T) {
+	prepare(t)
+	defer clean()
+
+	sch := schema.Use("default")
+	user, err := model.LoadSource([]byte(userSource), "migration.tests.user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pet, err := model.LoadSource([]byte(petSource), "migration.tests.pet", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Make(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mig, err := Make(pet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(mig.Up.Create.Foreigns))
+	assert.Equal(t, "migration_tests_user", mig.Up.Create.Foreigns[0].Table)
+
+	results, err := Up(true)
+	if !mysql() {
+		assert.NotNil(t, err)
+	} else if assert.Nil(t, err) {
+		assert.Contains(t, results[1].SQL[0], "FOREIGN KEY (`user_id`) REFERENCES `migration_tests_user` (`id`) ON DELETE CASCADE")
+	}
+
+	_, err = Up(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := sch.TableGet("migration_tests_pet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(table.Foreigns))
+	assert.Equal(t, "CASCADE", table.Foreigns[0].OnDelete)
+
+	// the foreign keys are not changed (sqlite reads the unsigned columns back as signed)
+	mig, err = Make(pet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mig != nil {
+		assert.Empty(t, mig.Up.AddForeigns)
+		assert.Empty(t, mig.Up.DelForeigns)
+	}
+}
+
+func TestMigration(t *testing.T) {
+	prepare(t)
+	defer clean()
+
+	sch := schema.Use("default")
+	mod, err := model.LoadSource([]byte(userSource), "migration.tests.user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make (create)
+	mig, err := Make(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, mig.Up.Create)
+	assert.True(t, mig.Down.Drop)
+
+	// Up (dry run, MySQL only)
+	results, err := Up(true)
+	if !mysql() {
+		assert.NotNil(t, err)
+	} else if assert.Nil(t, err) {
+		assert.Equal(t, 1, len(results))
+		assert.Contains(t, results[0].SQL[0], "CREATE TABLE `migration_tests_user`")
+	}
+	has, _ := sch.TableExists("migration_tests_user")
+	assert.False(t, has)
+
+	// Up
+	results, err = Up(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(results))
+	has, _ = sch.TableExists("migration_tests_user")
+	assert.True(t, has)
+
+	// Make (nothing changed)
+	mig, err = Make(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, mig)
+
+	// Make (alter)
+	mod, err = model.LoadSource([]byte(userSourceV2), "migration.tests.user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mig, err = Make(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "mobile", mig.Up.AddColumns[0].Name)
+	assert.Equal(t, "mobile", mig.Down.DelColumns[0].Name)
+
+	results, err = Up(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(results))
+
+	// Status
+	status, err := Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(status))
+	assert.True(t, status[0].Applied)
+	assert.True(t, status[1].Applied)
+
+	// Down
+	results, err = Down(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, mig.Version, results[0].Version)
+	table, err := sch.TableGet("migration_tests_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(table.Columns))
+
+	results, err = Down(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	has, _ = sch.TableExists("migration_tests_user")
+	assert.False(t, has)
+
+	status, err = Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, status[0].Applied)
+	assert.False(t, status[1].Applied)
+}
+
+func TestMigrationPending(t *testing.T) {
+	prepare(t)
+	defer clean()
+
+	mod, err := model.LoadSource([]byte(userSource), "migration.tests.user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mig, err := Make(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, mig.Up.Create)
+
+	// the pending migration creates the table
+	mig, err = Make(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, mig)
+
+	mod, err = model.LoadSource([]byte(userSourceV2), "migration.tests.user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mig, err = Make(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "mobile", mig.Up.AddColumns[0].Name)
+
+	mig, err = Make(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, mig)
+
+	results, err := Up(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(results))
+
+	// the rolled back column is renamed
+	results, err = Down(1, true)
+	if !mysql() {
+		assert.NotNil(t, err)
+	} else if assert.Nil(t, err) {
+		assert.Equal(t, "ALTER TABLE `migration_tests_user` CHANGE COLUMN `mobile` `__DEL__mobile` VARCHAR(20) NULL", results[0].SQL[0])
+	}
+}
+
+func TestMigrationVersion(t *testing.T) {
+	prepare(t)
+	defer clean()
+	defer func() { lastVersion = time.Time{} }()
+
+	// the existing migration files are scanned
+	mig := &Migration{Version: "20991231235959", Name: "migration.tests.user", Table: "migration_tests_user"}
+	err := mig.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "21000101000000", v)
+
+	v, err = version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "21000101000001", v)
+}
+
+func prepare(t *testing.T) {
+	app, err := application.OpenFromDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	application.Load(app)
+	dbconnect(t)
+
+	sch := schema.Use("default")
+	sch.TableDrop("migration_tests_pet")
+	sch.TableDrop("migration_tests_user")
+	sch.TableDrop(Table)
+}
+
+func clean() {
+	sch := schema.Use("default")
+	sch.TableDrop("migration_tests_pet")
+	sch.TableDrop("migration_tests_user")
+	sch.TableDrop(Table)
+	dbclose()
+}
+
+func dbclose() {
+	if capsule.Global != nil {
+		capsule.Global.Connections.Range(func(key, value any) bool {
+			if conn, ok := value.(*capsule.Connection); ok {
+				conn.Close()
+			}
+			return true
+		})
+	}
+}
+
+// mysql the tests connect to MySQL unless the driver is sqlite3
+func mysql() bool {
+	return os.Getenv("GOU_TEST_DB_DRIVER") != "sqlite3"
+}
+
+func dbconnect(t *testing.T) {
+
+	TestDriver := os.Getenv("GOU_TEST_DB_DRIVER")
+	TestDSN := os.Getenv("GOU_TEST_DSN")
+
+	// connect db
+	switch TestDriver {
+	case "sqlite3":
+		capsule.AddConn("primary", "sqlite3", TestDSN).SetAsGlobal()
+		break
+	default:
+		capsule.AddConn("primary", "mysql", TestDSN).SetAsGlobal()
+		break
+	}
+
+}
@@ -0,0 +1,96 @@
+package migration
+
+import (
+	"github.com/yaoapp/gou/model"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/kun/exception"
+	"github.com/yaoapp/kun/log"
+	"github.com/yaoapp/kun/maps"
+)
+
+// MigrationHandlers the migration process handlers
+var MigrationHandlers = map[string]process.Handler{
+	"make":   processMake,
+	"up":     processUp,
+	"down":   processDown,
+	"status": processStatus,
+}
+
+func init() {
+	process.RegisterGroup("migrations", MigrationHandlers)
+}
+
+// migrations.Make
+// args: [model:String...]
+// Make the migration files of the given models, all the loaded models if not given
+func processMake(process *process.Process) interface{} {
+	ids := []string{}
+	for i := range process.Args {
+		ids = append(ids, process.ArgsString(i))
+	}
+
+	if len(ids) == 0 {
+		for id := range model.Models {
+			ids = append(ids, id)
+		}
+	}
+
+	files := []string{}
+	for _, id := range ids {
+		mig, err := Make(model.Select(id))
+		if err != nil {
+			log.Error("migrations.Make: %s %s", id, err.Error())
+			exception.New(err.Error(), 500).Throw()
+			return nil
+		}
+
+		if mig != nil {
+			files = append(files, mig.File)
+		}
+	}
+	return files
+}
+
+// migrations.Up
+// args: [option:Map<optional>]
+// Up apply the pending migrations, option: {"dry_run": true}, the dry-run is supported on MySQL only
+func processUp(process *process.Process) interface{} {
+	option := process.ArgsMap(0, maps.MapStrAny{})
+	dryRun, _ := option["dry_run"].(bool)
+	results, err := Up(dryRun)
+	if err != nil {
+		log.Error("migrations.Up: %s", err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+	return results
+}
+
+// migrations.Down
+// args: [steps:Int<optional>, option:Map<optional>]
+// Down roll back the latest applied migrations, option: {"dry_run": true}, the dry-run is supported on MySQL only
+func processDown(process *process.Process) interface{} {
+	steps := process.ArgsInt(0, 1)
+	option := process.ArgsMap(1, maps.MapStrAny{})
+	dryRun, _ := option["dry_run"].(bool)
+	results, err := Down(steps, dryRun)
+	if err != nil {
+		log.Error("migrations.Down: %s", err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+	return results
+}
+
+// migrations.Status
+// args: []
+// Status get the status of the migrations
+func processStatus(process *process.Process) interface{} {
+	status, err := Status()
+	if err != nil {
+		log.Error("migrations.Status: %s", err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+	return status
+}
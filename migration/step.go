@@ -0,0 +1,263 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yaoapp/gou/schema/types"
+)
+
+// sqlTypes the column types mapping for the dry-run SQL (MySQL dialect)
+var sqlTypes = map[string]string{
+	"string":       "VARCHAR",
+	"char":         "CHAR",
+	"text":         "TEXT",
+	"mediumtext":   "MEDIUMTEXT",
+	"longtext":     "LONGTEXT",
+	"binary":       "VARBINARY",
+	"date":         "DATE",
+	"datetime":     "DATETIME",
+	"datetimetz":   "DATETIME",
+	"time":         "TIME",
+	"timetz":       "TIME",
+	"timestamp":    "TIMESTAMP",
+	"timestamptz":  "TIMESTAMP",
+	"tinyinteger":  "TINYINT",
+	"smallinteger": "SMALLINT",
+	"integer":      "INT",
+	"biginteger":   "BIGINT",
+	"id":           "BIGINT UNSIGNED AUTO_INCREMENT",
+	"decimal":      "DECIMAL",
+	"float":        "FLOAT",
+	"double":       "DOUBLE",
+	"boolean":      "BOOLEAN",
+	"enum":         "ENUM",
+	"json":         "JSON",
+	"jsonb":        "JSON",
+	"uuid":         "CHAR(36)",
+	"ipaddress":    "VARCHAR(45)",
+	"macaddress":   "VARCHAR(17)",
+	"year":         "YEAR",
+}
+
+// NewStep create a step from the schema diff
+func NewStep(diff types.Diff) Step {
+	return Step{
+		AddColumns:  diff.Columns.Add,
+		AltColumns:  diff.Columns.Alt,
+		DelColumns:  diff.Columns.Del,
+		AddIndexes:  diff.Indexes.Add,
+		DelIndexes:  diff.Indexes.Del,
+		AddForeigns: diff.Foreigns.Add,
+		DelForeigns: diff.Foreigns.Del,
+	}
+}
+
+// IsEmpty check if the step has nothing to do
+func (step Step) IsEmpty() bool {
+	return step.Create == nil && !step.Drop &&
+		len(step.AddColumns) == 0 && len(step.AltColumns) == 0 && len(step.DelColumns) == 0 &&
+		len(step.AddIndexes) == 0 && len(step.DelIndexes) == 0 &&
+		len(step.AddForeigns) == 0 && len(step.DelForeigns) == 0
+}
+
+// Diff cast the step to the schema diff
+func (step Step) Diff() types.Diff {
+	diff := types.NewDiff()
+	diff.Columns.Add = append(diff.Columns.Add, step.AddColumns...)
+	diff.Columns.Alt = append(diff.Columns.Alt, step.AltColumns...)
+	diff.Columns.Del = append(diff.Columns.Del, step.DelColumns...)
+	diff.Indexes.Add = append(diff.Indexes.Add, step.AddIndexes...)
+	diff.Indexes.Del = append(diff.Indexes.Del, step.DelIndexes...)
+	diff.Foreigns.Add = append(diff.Foreigns.Add, step.AddForeigns...)
+	diff.Foreigns.Del = append(diff.Foreigns.Del, step.DelForeigns...)
+	return diff
+}
+
+// Apply apply the step to the given table
+func (step Step) Apply(sch types.Schema, table string) error {
+
+	if step.Drop {
+		return sch.TableDrop(table)
+	}
+
+	if step.Create != nil {
+		return sch.TableCreate(table, *step.Create)
+	}
+
+	// The remove index flags are not persisted, recompute them from the live table
+	if len(step.AltColumns) > 0 {
+		current, err := sch.TableGet(table)
+		if err != nil {
+			return err
+		}
+
+		mapping := current.ColumnsMapping()
+		step.AltColumns = append([]types.Column{}, step.AltColumns...)
+		for i, column := range step.AltColumns {
+			origin, has := mapping[column.Name]
+			if !has {
+				continue
+			}
+			step.AltColumns[i].RemoveIndex = origin.Index != column.Index
+			step.AltColumns[i].RemoveUnique = origin.Unique != column.Unique
+			step.AltColumns[i].RemovePrimary = origin.Primary != column.Primary
+		}
+	}
+
+	return step.Diff().Apply(sch, table)
+}
+
+// SQL the statements of the step in the MySQL dialect for the dry-run output, the dry-run is supported on MySQL only
+func (step Step) SQL(table string) []string {
+	stmts := []string{}
+	name := quote(table)
+
+	if step.Drop {
+		return append(stmts, fmt.Sprintf("DROP TABLE IF EXISTS %s", name))
+	}
+
+	if step.Create != nil {
+		defines := []string{}
+		for _, column := range step.Create.Columns {
+			defines = append(defines, columnSQL(column))
+		}
+		if step.Create.Option.Timestamps {
+			defines = append(defines, "`created_at` TIMESTAMP NULL", "`updated_at` TIMESTAMP NULL")
+		}
+		if step.Create.Option.SoftDeletes {
+			defines = append(defines, "`deleted_at` TIMESTAMP NULL", "`__restore_data` JSON NULL")
+		}
+		for _, foreign := range step.Create.Foreigns {
+			defines = append(defines, foreignSQL(foreign))
+		}
+		stmts = append(stmts, fmt.Sprintf("CREATE TABLE %s (%s)", name, strings.Join(defines, ", ")))
+		for _, index := range step.Create.Indexes {
+			stmts = append(stmts, indexSQL(table, index))
+		}
+		return stmts
+	}
+
+	for _, foreign := range step.DelForeigns {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", name, quote(foreign.Name)))
+	}
+
+	for _, column := range step.AddColumns {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", name, columnSQL(column)))
+	}
+
+	for _, column := range step.AltColumns {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", name, columnSQL(column)))
+	}
+
+	// the deleted columns are renamed to __DEL__<name>, see xun.ColumnDel. CHANGE COLUMN works before MySQL 8
+	for _, column := range step.DelColumns {
+		column.Nullable = true
+		column.Primary = false
+		column.Unique = false
+		origin := column.Name
+		column.Name = "__DEL__" + origin
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s CHANGE COLUMN %s %s", name, quote(origin), columnSQL(column)))
+	}
+
+	for _, index := range step.AddIndexes {
+		stmts = append(stmts, indexSQL(table, index))
+	}
+
+	for _, index := range step.DelIndexes {
+		stmts = append(stmts, fmt.Sprintf("DROP INDEX %s ON %s", quote(index.Name), name))
+	}
+
+	for _, foreign := range step.AddForeigns {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD %s", name, foreignSQL(foreign)))
+	}
+
+	return stmts
+}
+
+func columnSQL(column types.Column) string {
+	typ, has := sqlTypes[strings.ToLower(column.Type)]
+	if !has {
+		typ = strings.ToUpper(column.Type)
+	}
+
+	switch strings.ToLower(column.Type) {
+	case "string", "char", "binary":
+		length := column.Length
+		if length == 0 {
+			length = 200
+		}
+		typ = fmt.Sprintf("%s(%d)", typ, length)
+
+	case "decimal", "float", "double":
+		if column.Precision > 0 {
+			typ = fmt.Sprintf("%s(%d,%d)", typ, column.Precision, column.Scale)
+		}
+
+	case "enum":
+		options := []string{}
+		for _, option := range column.Option {
+			options = append(options, fmt.Sprintf("'%s'", strings.ReplaceAll(option, "'", "''")))
+		}
+		typ = fmt.Sprintf("%s(%s)", typ, strings.Join(options, ","))
+	}
+
+	sql := fmt.Sprintf("%s %s", quote(column.Name), typ)
+	if column.Nullable {
+		sql = sql + " NULL"
+	} else {
+		sql = sql + " NOT NULL"
+	}
+
+	if column.DefaultRaw != "" {
+		sql = fmt.Sprintf("%s DEFAULT %s", sql, column.DefaultRaw)
+	} else if column.Default != nil {
+		sql = fmt.Sprintf("%s DEFAULT '%v'", sql, column.Default)
+	}
+
+	if column.Primary || strings.ToLower(column.Type) == "id" {
+		sql = sql + " PRIMARY KEY"
+	} else if column.Unique {
+		sql = sql + " UNIQUE"
+	}
+
+	if column.Comment != "" {
+		sql = fmt.Sprintf("%s COMMENT '%s'", sql, strings.ReplaceAll(column.Comment, "'", "''"))
+	}
+	return sql
+}
+
+func indexSQL(table string, index types.Index) string {
+	columns := []string{}
+	for _, column := range index.Columns {
+		columns = append(columns, quote(column))
+	}
+
+	switch index.Type {
+	case "primary":
+		return fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", quote(table), strings.Join(columns, ", "))
+	case "unique":
+		return fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", quote(index.Name), quote(table), strings.Join(columns, ", "))
+	case "fulltext":
+		return fmt.Sprintf("CREATE FULLTEXT INDEX %s ON %s (%s)", quote(index.Name), quote(table), strings.Join(columns, ", "))
+	}
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s)", quote(index.Name), quote(table), strings.Join(columns, ", "))
+}
+
+func foreignSQL(foreign types.Foreign) string {
+	sql := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		quote(foreign.Name), quote(foreign.Column), quote(foreign.Table), quote(foreign.Key))
+
+	if action := types.ForeignAction(foreign.OnDelete); action != "" {
+		sql = fmt.Sprintf("%s ON DELETE %s", sql, action)
+	}
+
+	if action := types.ForeignAction(foreign.OnUpdate); action != "" {
+		sql = fmt.Sprintf("%s ON UPDATE %s", sql, action)
+	}
+	return sql
+}
+
+func quote(name string) string {
+	return fmt.Sprintf("`%s`", strings.ReplaceAll(name, "`", "``"))
+}
@@ -0,0 +1,47 @@
+package migration
+
+import (
+	"github.com/yaoapp/gou/schema/types"
+)
+
+// Migration the versioned migration of a table
+type Migration struct {
+	Version   string `json:"version"` // the timestamp version, eg: 20240102150405
+	Name      string `json:"name"`
+	Connector string `json:"connector,omitempty"`
+	Table     string `json:"table"`
+	Up        Step   `json:"up"`
+	Down      Step   `json:"down"`
+	File      string `json:"-"`
+}
+
+// Step the schema changes of one direction (up or down)
+type Step struct {
+	Create      *types.Blueprint `json:"create,omitempty"` // create the table
+	Drop        bool             `json:"drop,omitempty"`   // drop the table
+	AddColumns  []types.Column   `json:"add_columns,omitempty"`
+	AltColumns  []types.Column   `json:"alt_columns,omitempty"`
+	DelColumns  []types.Column   `json:"del_columns,omitempty"`
+	AddIndexes  []types.Index    `json:"add_indexes,omitempty"`
+	DelIndexes  []types.Index    `json:"del_indexes,omitempty"`
+	AddForeigns []types.Foreign  `json:"add_foreigns,omitempty"`
+	DelForeigns []types.Foreign  `json:"del_foreigns,omitempty"`
+}
+
+// State the migration state
+type State struct {
+	Version   string      `json:"version"`
+	Name      string      `json:"name"`
+	Table     string      `json:"table"`
+	File      string      `json:"file,omitempty"`
+	Applied   bool        `json:"applied"`
+	AppliedAt interface{} `json:"applied_at,omitempty"`
+}
+
+// Result the result of the migration running
+type Result struct {
+	Version string   `json:"version"`
+	Name    string   `json:"name"`
+	Table   string   `json:"table"`
+	SQL     []string `json:"sql,omitempty"` // the statements of the step, MySQL only
+}
@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -17,6 +19,10 @@ import (
 	"github.com/yaoapp/xun/capsule"
 )
 
+// deferredForeigns the foreign keys waiting for the referenced tables, the connector => the table => the foreign keys
+var deferredForeigns = map[string]map[string][]types.Foreign{}
+var deferredLock sync.Mutex
+
 // CreateTable create the table of the model
 func (mod *Model) CreateTable() error {
 	connector := mod.MetaData.Connector
@@ -34,9 +40,33 @@ func (mod *Model) CreateTable() error {
 		return err
 	}
 
-	sch := schema.Use(connector)
-	return sch.TableCreate(table, blueprint)
+	// the foreign keys are added after the referenced tables created
+	foreigns := blueprint.Foreigns
+	blueprint.Foreigns = nil
+
+	sch, err := schema.Select(connector)
+	if err != nil {
+		return err
+	}
 
+	err = sch.TableCreate(table, blueprint)
+	if err != nil {
+		return err
+	}
+
+	foreigns, err = deferForeigns(sch, connector, table, foreigns)
+	if err != nil {
+		return err
+	}
+
+	for _, foreign := range foreigns {
+		err = sch.ForeignAdd(table, foreign)
+		if err != nil {
+			return err
+		}
+	}
+
+	return addDeferredForeigns(sch, connector, table)
 }
 
 // SaveTable update or create the table of the model
@@ -56,11 +86,90 @@ func (mod *Model) SaveTable() error {
 		return err
 	}
 
-	sch := schema.Use(connector)
+	sch, err := schema.Select(connector)
+	if err != nil {
+		return err
+	}
+
+	blueprint.Foreigns, err = deferForeigns(sch, connector, table, blueprint.Foreigns)
+	if err != nil {
+		return err
+	}
+
 	err = sch.TableSave(table, blueprint)
 	if err != nil {
 		return err
 	}
+	return addDeferredForeigns(sch, connector, table)
+}
+
+// deferForeigns defer the foreign keys referencing the tables not created yet, returns the foreign keys to add now.
+// the models may be migrated before the models they reference
+func deferForeigns(sch types.Schema, connector string, table string, foreigns []types.Foreign) ([]types.Foreign, error) {
+	deferredLock.Lock()
+	defer deferredLock.Unlock()
+
+	res := []types.Foreign{}
+	deferred := []types.Foreign{}
+	for _, foreign := range foreigns {
+		if foreign.Table == table {
+			res = append(res, foreign)
+			continue
+		}
+
+		has, err := sch.TableExists(foreign.Table)
+		if err != nil {
+			return nil, err
+		}
+
+		if has {
+			res = append(res, foreign)
+			continue
+		}
+		deferred = append(deferred, foreign)
+	}
+
+	if _, has := deferredForeigns[connector]; !has {
+		deferredForeigns[connector] = map[string][]types.Foreign{}
+	}
+
+	delete(deferredForeigns[connector], table)
+	if len(deferred) > 0 {
+		deferredForeigns[connector][table] = deferred
+	}
+	return res, nil
+}
+
+// addDeferredForeigns add the deferred foreign keys of the other tables referencing the created table
+func addDeferredForeigns(sch types.Schema, connector string, table string) error {
+	deferredLock.Lock()
+	defer deferredLock.Unlock()
+
+	children := []string{}
+	for child := range deferredForeigns[connector] {
+		children = append(children, child)
+	}
+	sort.Strings(children)
+
+	for _, child := range children {
+		deferred := []types.Foreign{}
+		for _, foreign := range deferredForeigns[connector][child] {
+			if foreign.Table != table {
+				deferred = append(deferred, foreign)
+				continue
+			}
+
+			err := sch.ForeignAdd(child, foreign)
+			if err != nil {
+				return err
+			}
+		}
+
+		deferredForeigns[connector][child] = deferred
+		if len(deferred) == 0 {
+			delete(deferredForeigns[connector], child)
+		}
+	}
 	return nil
 }
 
@@ -76,7 +185,11 @@ func (mod *Model) DropTable() error {
 		return fmt.Errorf("missing table name")
 	}
 
-	sch := schema.Use(connector)
+	sch, err := schema.Select(connector)
+	if err != nil {
+		return err
+	}
+
 	return sch.TableDrop(table)
 }
 
@@ -92,8 +205,12 @@ func (mod *Model) HasTable() (bool, error) {
 		return false, fmt.Errorf("missing table name")
 	}
 
-	sch := schema.Use(connector)
-	_, err := sch.TableGet(table)
+	sch, err := schema.Select(connector)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = sch.TableGet(table)
 	if err != nil && strings.Contains(err.Error(), "does not exists") {
 		return false, nil
 	}
@@ -121,7 +238,85 @@ func (mod *Model) InsertValues() ([]int, []error) {
 
 // Blueprint cast to the blueprint struct
 func (mod *Model) Blueprint() (types.Blueprint, error) {
-	return types.NewAny(mod.MetaData)
+	blueprint, err := types.NewAny(mod.MetaData)
+	if err != nil {
+		return blueprint, err
+	}
+
+	if mod.MetaData.Option.Constraints {
+		blueprint.Foreigns = mod.Foreigns()
+	}
+	return blueprint, nil
+}
+
+// Foreigns get the foreign keys of the model from the hasOne, hasMany and belongsTo relations of the loaded models.
+// The foreign key belongs to the model holding the column which references the primary key of another model.
+func (mod *Model) Foreigns() []types.Foreign {
+
+	models := map[string]*Model{}
+	for id, m := range Models {
+		models[id] = m
+	}
+	models[mod.ID] = mod
+
+	ids := []string{}
+	for id := range models {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	foreigns := []types.Foreign{}
+	columns := map[string]bool{}
+	for _, id := range ids {
+		owner := models[id]
+		names := []string{}
+		for name := range owner.MetaData.Relations {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			rel := owner.MetaData.Relations[name]
+			if rel.Type != RelHasOne && rel.Type != RelHasMany && rel.Type != RelBelongsTo {
+				continue
+			}
+
+			related, has := models[rel.Model]
+			if !has {
+				continue
+			}
+
+			var child, parent *Model
+			var column, key string
+			if rel.Foreign == owner.PrimaryKey && rel.Key != related.PrimaryKey {
+				child, parent, column, key = related, owner, rel.Key, rel.Foreign
+			} else if rel.Key == related.PrimaryKey && rel.Foreign != owner.PrimaryKey {
+				child, parent, column, key = owner, related, rel.Foreign, rel.Key
+			} else {
+				continue
+			}
+
+			if child != mod || columns[column] {
+				continue
+			}
+
+			if _, has := mod.Columns[column]; !has {
+				continue
+			}
+
+			columns[column] = true
+			foreigns = append(foreigns, types.Foreign{
+				Name:     fmt.Sprintf("%s_%s_foreign", mod.MetaData.Table.Name, column),
+				Column:   column,
+				Table:    parent.MetaData.Table.Name,
+				Key:      key,
+				OnDelete: rel.OnDelete,
+				OnUpdate: rel.OnUpdate,
+			})
+		}
+	}
+
+	return foreigns
 }
 
 // Export the model
@@ -11,6 +11,8 @@ import (
 	"github.com/yaoapp/gou/application"
 	"github.com/yaoapp/gou/query"
 	"github.com/yaoapp/gou/query/gou"
+	"github.com/yaoapp/gou/schema"
+	"github.com/yaoapp/gou/schema/types"
 	"github.com/yaoapp/kun/exception"
 	"github.com/yaoapp/kun/maps"
 	"github.com/yaoapp/xun/capsule"
@@ -833,3 +835,131 @@ func dbconnect() {
 // 	assert.Equal(t, mod.Columns["action"].Label, "::Action")
 
 // }
+
+func TestMigrateDeferForeigns(t *testing.T) {
+	dbconnect()
+	sch := schema.Use("default")
+	sch.TableDrop("unit_fk_pet")
+	sch.TableDrop("unit_fk_owner")
+	defer sch.TableDrop("unit_fk_owner")
+	defer sch.TableDrop("unit_fk_pet")
+	defer delete(Models, "unit.fk.pet")
+	defer delete(Models, "unit.fk.owner")
+
+	owner, err := LoadSource([]byte(`{
+		"name": "owner", "table": {"name": "unit_fk_owner"},
+		"columns": [{"name": "id", "type": "ID"}],
+		"option": {"constraints": true}
+	}`), "unit.fk.owner", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pet, err := LoadSource([]byte(`{
+		"name": "pet", "table": {"name": "unit_fk_pet"},
+		"columns": [{"name": "id", "type": "ID"}, {"name": "owner_id", "type": "unsignedBigInteger", "nullable": true, "index": true}],
+		"relations": {"owner": {"type": "hasOne", "model": "unit.fk.owner", "key": "id", "foreign": "owner_id"}},
+		"option": {"constraints": true}
+	}`), "unit.fk.pet", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the child is migrated before the parent
+	err = pet.Migrate(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := sch.TableGet("unit_fk_pet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, len(table.Foreigns))
+
+	err = owner.Migrate(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table, err = sch.TableGet("unit_fk_pet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 1, len(table.Foreigns)) {
+		assert.Equal(t, "unit_fk_owner", table.Foreigns[0].Table)
+		assert.Equal(t, "owner_id", table.Foreigns[0].Column)
+	}
+}
+
+func TestMigrateHandForeigns(t *testing.T) {
+	dbconnect()
+	sch := schema.Use("default")
+	sch.TableDrop("unit_fk_pet")
+	sch.TableDrop("unit_fk_owner")
+	defer sch.TableDrop("unit_fk_owner")
+	defer sch.TableDrop("unit_fk_pet")
+	defer delete(Models, "unit.fk.pet")
+	defer delete(Models, "unit.fk.owner")
+
+	owner, err := LoadSource([]byte(`{
+		"name": "owner", "table": {"name": "unit_fk_owner"},
+		"columns": [{"name": "id", "type": "ID"}]
+	}`), "unit.fk.owner", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pet, err := LoadSource([]byte(`{
+		"name": "pet", "table": {"name": "unit_fk_pet"},
+		"columns": [{"name": "id", "type": "ID"}, {"name": "owner_id", "type": "unsignedBigInteger", "nullable": true, "index": true}],
+		"relations": {"owner": {"type": "hasOne", "model": "unit.fk.owner", "key": "id", "foreign": "owner_id"}}
+	}`), "unit.fk.pet", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = owner.Migrate(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = pet.Migrate(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sch.ForeignAdd("unit_fk_pet", types.Foreign{Name: "unit_fk_pet_owner", Column: "owner_id", Table: "unit_fk_owner", Key: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the model does not opt into the constraints
+	err = pet.Migrate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := sch.TableGet("unit_fk_pet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(table.Foreigns))
+
+	// the model opts into the constraints, the foreign key made by hand is kept
+	pet.MetaData.Option.Constraints = true
+	err = pet.Migrate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table, err = sch.TableGet("unit_fk_pet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, foreign := range table.Foreigns {
+		names = append(names, foreign.Name)
+	}
+	assert.ElementsMatch(t, []string{"unit_fk_pet_owner", "unit_fk_pet_owner_id_foreign"}, names)
+}
@@ -105,13 +105,15 @@ type Table struct {
 
 // Relation the new xun model relation
 type Relation struct {
-	Name    string     `json:"-"`
-	Type    string     `json:"type"`
-	Key     string     `json:"key,omitempty"`
-	Model   string     `json:"model,omitempty"`
-	Foreign string     `json:"foreign,omitempty"`
-	Links   []Relation `json:"links,omitempty"`
-	Query   QueryParam `json:"query,omitempty"`
+	Name     string     `json:"-"`
+	Type     string     `json:"type"`
+	Key      string     `json:"key,omitempty"`
+	Model    string     `json:"model,omitempty"`
+	Foreign  string     `json:"foreign,omitempty"`
+	OnDelete string     `json:"on_delete,omitempty"` // the foreign key action when constraints is true, eg: CASCADE
+	OnUpdate string     `json:"on_update,omitempty"` // the foreign key action when constraints is true, eg: CASCADE
+	Links    []Relation `json:"links,omitempty"`
+	Query    QueryParam `json:"query,omitempty"`
 }
 
 // Option 模型配置选项
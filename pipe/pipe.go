@@ -0,0 +1,83 @@
+package pipe
+
+import (
+	"fmt"
+
+	"github.com/yaoapp/gou/application"
+	"github.com/yaoapp/gou/query"
+)
+
+// Pipes the loaded pipes
+var Pipes = map[string]*Pipe{}
+
+// Load the pipe
+func Load(file string, id string) (*Pipe, error) {
+
+	data, err := application.App.Read(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := Pipe{ID: id, File: file}
+	err = application.Parse(file, data, &pipe)
+	if err != nil {
+		return nil, err
+	}
+
+	err = pipe.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	Pipes[id] = &pipe
+	return Pipes[id], nil
+}
+
+// Select the loaded pipe
+func Select(name string) (*Pipe, error) {
+	pipe, has := Pipes[name]
+	if !has {
+		return nil, fmt.Errorf("pipes.%s not loaded", name)
+	}
+	return pipe, nil
+}
+
+// prepare validate the pipe and load the query DSL of the stages
+func (pipe *Pipe) prepare() error {
+
+	switch pipe.Source.Type {
+	case "input", "values", "process", "model", "file", "http":
+	default:
+		return fmt.Errorf("pipes.%s source type %s does not support", pipe.ID, pipe.Source.Type)
+	}
+
+	for i, stage := range pipe.Stages {
+		switch stage.Type {
+		case "process", "map", "filter", "batch", "aggregate":
+		case "query":
+			engine, has := query.Engines[stage.Engine]
+			if !has {
+				return fmt.Errorf("pipes.%s stage %s: the query engine %s does not register", pipe.ID, stage.Name, stage.Engine)
+			}
+
+			dsl, err := engine.Load(stage.Query)
+			if err != nil {
+				return fmt.Errorf("pipes.%s stage %s: %s", pipe.ID, stage.Name, err.Error())
+			}
+			pipe.Stages[i].DSL = dsl
+
+		default:
+			return fmt.Errorf("pipes.%s stage %s: the type %s does not support", pipe.ID, stage.Name, stage.Type)
+		}
+	}
+
+	if pipe.Sink != nil {
+		switch pipe.Sink.Type {
+		case "model", "file", "store", "process":
+		default:
+			return fmt.Errorf("pipes.%s sink type %s does not support", pipe.ID, pipe.Sink.Type)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package pipe
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/fs"
+	"github.com/yaoapp/gou/fs/system"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/gou/store"
+	"github.com/yaoapp/kun/exception"
+)
+
+func TestRun(t *testing.T) {
+	prepareUnitProcesses()
+	pipe := &Pipe{Name: "unit.run", Buffer: 1, Source: Source{Type: "input"}, Stages: []Stage{
+		{Name: "adult", Type: "filter", Filter: map[string]interface{}{"left": "{{$record.age}}", "op": ">=", "right": 18}},
+		{Name: "name", Type: "map", Map: map[string]interface{}{"name": "{{$record.name}}", "prefix": "{{$in.1}}"}},
+		{Name: "upper", Type: "process", Process: "unit.pipe.upper", Args: []interface{}{"{{$record.name}}"}},
+		{Name: "batch", Type: "batch", Size: 2},
+	}}
+
+	users := []interface{}{
+		map[string]interface{}{"name": "u1", "age": 20},
+		map[string]interface{}{"name": "u2", "age": 10},
+		map[string]interface{}{"name": "u3", "age": 30},
+		map[string]interface{}{"name": "u4", "age": 40},
+	}
+
+	res, err := pipe.Run(context.Background(), users, "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 4, res.Read)
+	assert.Equal(t, 2, res.Written)
+	assert.Equal(t, []interface{}{
+		[]interface{}{"U1", "U3"},
+		[]interface{}{"U4"},
+	}, res.Records)
+}
+
+func TestRunAggregate(t *testing.T) {
+	pipe := &Pipe{Name: "unit.aggregate", Source: Source{Type: "values", Values: []interface{}{
+		map[string]interface{}{"type": "cat", "weight": 4},
+		map[string]interface{}{"type": "dog", "weight": 10},
+		map[string]interface{}{"type": "cat", "weight": 6},
+	}}, Stages: []Stage{
+		{Name: "stat", Type: "aggregate", Group: "{{$record.type}}", Aggregate: map[string]AggregateField{
+			"count": {OP: "count"},
+			"total": {OP: "sum", Value: "{{$record.weight}}"},
+			"avg":   {OP: "avg", Value: "{{$record.weight}}"},
+			"max":   {OP: "max", Value: "{{$record.weight}}"},
+		}},
+	}}
+
+	res, err := pipe.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"group": "cat", "count": 2, "total": 10.0, "avg": 5.0, "max": 6.0},
+		map[string]interface{}{"group": "dog", "count": 1, "total": 10.0, "avg": 10.0, "max": 10.0},
+	}, res.Records)
+}
+
+func TestRunFile(t *testing.T) {
+	root := t.TempDir()
+	fs.Register("pipe-tests", system.New(root))
+
+	_, err := fs.WriteFile(fs.MustGet("pipe-tests"), "/users.jsonl", []byte("{\"name\":\"u1\"}\n\n{\"name\":\"u2\"}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pipe := &Pipe{Name: "unit.file",
+		Source: Source{Type: "file", FS: "pipe-tests", File: "/users.jsonl"},
+		Stages: []Stage{{Name: "name", Type: "map", Map: "{{$record.name}}"}},
+		Sink:   &Sink{Type: "file", FS: "pipe-tests", File: "/names.txt", Format: "line"},
+	}
+
+	res, err := pipe.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, res.Read)
+	assert.Equal(t, 2, res.Written)
+
+	data, err := fs.ReadFile(fs.MustGet("pipe-tests"), "/names.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "u1\nu2\n", string(data))
+}
+
+func TestRunStore(t *testing.T) {
+	stor, err := store.New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Pools["pipe-tests"] = stor
+	defer delete(store.Pools, "pipe-tests")
+
+	pipe := &Pipe{Name: "unit.store",
+		Source: Source{Type: "input"},
+		Sink:   &Sink{Type: "store", Store: "pipe-tests", Key: "user:{{$record.id}}"},
+	}
+
+	res, err := pipe.Run(context.Background(), []interface{}{
+		map[string]interface{}{"id": "1", "name": "u1"},
+		map[string]interface{}{"id": "2", "name": "u2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, res.Written)
+	value, has := stor.Get("user:2")
+	assert.True(t, has)
+	assert.Equal(t, "u2", value.(map[string]interface{})["name"])
+}
+
+func TestRunError(t *testing.T) {
+	prepareUnitProcesses()
+	records := []interface{}{}
+	for i := 0; i < 1000; i++ {
+		records = append(records, i)
+	}
+
+	pipe := &Pipe{Name: "unit.error", Buffer: 1, Source: Source{Type: "input"}, Stages: []Stage{
+		{Name: "fail", Type: "process", Process: "unit.pipe.fail", Args: []interface{}{"{{$record}}", 10}},
+		{Name: "batch", Type: "batch", Size: 5},
+	}}
+
+	_, err := pipe.Run(context.Background(), records)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "stage fail:"))
+	assert.True(t, strings.Contains(err.Error(), "record 10"))
+
+	// canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = pipe.Run(ctx, records)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestPrepare(t *testing.T) {
+	pipe := &Pipe{ID: "unit.prepare", Source: Source{Type: "input"}, Stages: []Stage{{Name: "map", Type: "map"}}}
+	assert.Nil(t, pipe.prepare())
+
+	pipe.Stages[0].Type = "unknown"
+	assert.NotNil(t, pipe.prepare())
+
+	pipe.Stages[0].Type = "query"
+	pipe.Stages[0].Engine = "unknown"
+	assert.NotNil(t, pipe.prepare())
+
+	pipe.Stages = nil
+	pipe.Sink = &Sink{Type: "unknown"}
+	assert.NotNil(t, pipe.prepare())
+}
+
+func prepareUnitProcesses() {
+	process.Register("unit.pipe.upper", func(process *process.Process) interface{} {
+		return strings.ToUpper(process.ArgsString(0))
+	})
+
+	// fail when the record equals to the second arg
+	process.Register("unit.pipe.fail", func(process *process.Process) interface{} {
+		if process.ArgsInt(0) == process.ArgsInt(1) {
+			exception.New("record %d", 500, process.ArgsInt(0)).Throw()
+		}
+		return process.Args[0]
+	})
+}
@@ -0,0 +1,38 @@
+package pipe
+
+import (
+	"context"
+
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/kun/exception"
+	"github.com/yaoapp/kun/log"
+)
+
+func init() {
+	process.Register("pipes", processPipes)
+}
+
+// processPipes pipes.<id>
+// args: the pipe args, the first arg is the records of the input source
+// returns: {read, written, records}
+func processPipes(process *process.Process) interface{} {
+
+	pipe, err := Select(process.ID)
+	if err != nil {
+		exception.New("pipes.%s not loaded", 404, process.ID).Throw()
+		return nil
+	}
+
+	ctx := process.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	res, err := pipe.RunWith(ctx, process.Sid, process.Global, process.Args...)
+	if err != nil {
+		log.Error("pipes.%s: %s", process.ID, err.Error())
+		exception.New(err.Error(), 500).Throw()
+	}
+
+	return map[string]interface{}{"read": res.Read, "written": res.Written, "records": res.Records}
+}
@@ -0,0 +1,41 @@
+package pipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/process"
+)
+
+func TestProcessPipes(t *testing.T) {
+	Pipes["unit.process"] = &Pipe{ID: "unit.process", Source: Source{Type: "input"}, Stages: []Stage{
+		{Name: "session", Type: "map", Map: map[string]interface{}{"id": "{{$record}}", "global": "{{$global.foo}}"}},
+	}}
+	defer delete(Pipes, "unit.process")
+
+	p, err := process.Of("pipes.unit.process", []interface{}{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := p.WithGlobal(map[string]interface{}{"foo": "bar"}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"read":    2,
+		"written": 2,
+		"records": []interface{}{
+			map[string]interface{}{"id": 1, "global": "bar"},
+			map[string]interface{}{"id": 2, "global": "bar"},
+		},
+	}, res)
+
+	p, err = process.Of("pipes.unit.missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Exec()
+	assert.NotNil(t, err)
+}
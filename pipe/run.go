@@ -0,0 +1,385 @@
+package pipe
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/yaoapp/gou/flow"
+	"github.com/yaoapp/gou/helper"
+	"github.com/yaoapp/gou/process"
+	"github.com/yaoapp/kun/any"
+	"github.com/yaoapp/kun/exception"
+	"github.com/yaoapp/kun/maps"
+)
+
+// runner the execution of the pipe
+type runner struct {
+	pipe   *Pipe
+	ctx    context.Context
+	cancel context.CancelFunc
+	sid    string
+	global map[string]interface{}
+	in     []interface{}
+	read   int64
+	err    error
+	lock   sync.Mutex
+}
+
+// Run the pipe with the args
+func (pipe *Pipe) Run(parent context.Context, args ...interface{}) (*Result, error) {
+	return pipe.RunWith(parent, "", nil, args...)
+}
+
+// RunWith run the pipe with the session id and the global variables of the call
+// the source, the stages and the sink run concurrently, connected by the buffered channels.
+// the upstream blocks when the downstream buffer is full (back-pressure), the first error stops the pipe.
+func (pipe *Pipe) RunWith(parent context.Context, sid string, global map[string]interface{}, args ...interface{}) (*Result, error) {
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	run := &runner{pipe: pipe, ctx: ctx, cancel: cancel, sid: sid, global: global, in: args}
+
+	buffer := pipe.Buffer
+	if buffer <= 0 {
+		buffer = 100
+	}
+
+	var wg sync.WaitGroup
+	source := make(chan interface{}, buffer)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(source)
+		run.fail(run.source(source))
+	}()
+
+	var in <-chan interface{} = source
+	for i := range pipe.Stages {
+		out := make(chan interface{}, buffer)
+		wg.Add(1)
+		go func(stage *Stage, in <-chan interface{}, out chan<- interface{}) {
+			defer wg.Done()
+			defer close(out)
+			err := run.stage(stage, in, out)
+			if err != nil && err != run.ctx.Err() {
+				err = fmt.Errorf("stage %s: %s", stage.Name, err.Error())
+			}
+			run.fail(err)
+		}(&pipe.Stages[i], in, out)
+		in = out
+	}
+
+	res := &Result{}
+	run.fail(run.sink(in, res))
+	wg.Wait()
+
+	if run.err != nil {
+		return nil, run.err
+	}
+
+	res.Read = int(atomic.LoadInt64(&run.read))
+	return res, nil
+}
+
+// fail stop the pipe with the first error
+func (run *runner) fail(err error) {
+	if err == nil {
+		return
+	}
+
+	run.lock.Lock()
+	defer run.lock.Unlock()
+	if run.err == nil {
+		run.err = err
+		run.cancel()
+	}
+}
+
+// send the record to the next stage, wait until the buffer is available or the pipe is stopped
+func (run *runner) send(out chan<- interface{}, record interface{}) error {
+	select {
+	case <-run.ctx.Done():
+		return run.ctx.Err()
+	case out <- record:
+		return nil
+	}
+}
+
+// data the binding data of the record
+func (run *runner) data(record interface{}) maps.Map {
+	return maps.Map{"$record": record, "$in": run.in, "$global": run.global}.Dot()
+}
+
+// call the process with the session id and the global variables of the pipe
+// the args are bound with the data, the record is the only arg if the args are not set
+func (run *runner) call(name string, args []interface{}, record interface{}, data maps.Map) (interface{}, error) {
+	values := []interface{}{record}
+	if len(args) > 0 {
+		values = args
+		if data != nil {
+			values = []interface{}{}
+			for _, arg := range args {
+				values = append(values, helper.Bind(arg, data))
+			}
+		}
+	}
+
+	p, err := process.Of(name, values...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.WithSID(run.sid).WithGlobal(run.global).WithContext(run.ctx).Execute()
+	if err != nil {
+		return nil, err
+	}
+	defer p.Release()
+	return p.Value(), nil
+}
+
+// stage run the stage, read the records from in and send the results to out
+func (run *runner) stage(stage *Stage, in <-chan interface{}, out chan<- interface{}) error {
+	switch stage.Type {
+	case "batch":
+		return run.batch(stage, in, out)
+	case "aggregate":
+		return run.aggregate(stage, in, out)
+	}
+
+	for record := range in {
+		res, keep, err := run.transform(stage, record)
+		if err != nil {
+			return err
+		}
+
+		if !keep {
+			continue
+		}
+
+		err = run.send(out, res)
+		if err != nil {
+			return err
+		}
+	}
+	return run.ctx.Err()
+}
+
+// transform the record by the process, query, map or filter stage, keep is false if the record is dropped
+func (run *runner) transform(stage *Stage, record interface{}) (res interface{}, keep bool, err error) {
+	data := run.data(record)
+	switch stage.Type {
+	case "process":
+		res, err = run.call(stage.Process, stage.Args, record, data)
+		return res, res != nil, err
+
+	case "query":
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = exception.Catch(recovered)
+			}
+		}()
+		res = stage.DSL.Run(data)
+		return res, res != nil, nil
+
+	case "map":
+		return helper.Bind(stage.Map, data), true, nil
+
+	case "filter":
+		keep, err = flow.When(stage.Filter, data)
+		return record, keep, err
+	}
+
+	return nil, false, fmt.Errorf("the type %s does not support", stage.Type)
+}
+
+// batch group the records into the arrays of the stage size
+func (run *runner) batch(stage *Stage, in <-chan interface{}, out chan<- interface{}) error {
+	size := stage.Size
+	if size <= 0 {
+		size = 100
+	}
+
+	records := []interface{}{}
+	for record := range in {
+		records = append(records, record)
+		if len(records) < size {
+			continue
+		}
+
+		err := run.send(out, records)
+		if err != nil {
+			return err
+		}
+		records = []interface{}{}
+	}
+
+	if len(records) > 0 && run.ctx.Err() == nil {
+		return run.send(out, records)
+	}
+	return run.ctx.Err()
+}
+
+// aggregate the records by the group key, the aggregated records are sent after all records read
+func (run *runner) aggregate(stage *Stage, in <-chan interface{}, out chan<- interface{}) error {
+
+	type group struct {
+		key    interface{}
+		fields map[string]*aggregator
+	}
+
+	keys := []string{}
+	groups := map[string]*group{}
+	for record := range in {
+		data := run.data(record)
+
+		var key interface{}
+		if stage.Group != nil {
+			key = helper.Bind(stage.Group, data)
+		}
+
+		id := fmt.Sprintf("%v", key)
+		g, has := groups[id]
+		if !has {
+			g = &group{key: key, fields: map[string]*aggregator{}}
+			for name := range stage.Aggregate {
+				g.fields[name] = &aggregator{}
+			}
+			groups[id] = g
+			keys = append(keys, id)
+		}
+
+		for name, field := range stage.Aggregate {
+			err := g.fields[name].add(field, helper.Bind(field.Value, data))
+			if err != nil {
+				return fmt.Errorf("%s %s", name, err.Error())
+			}
+		}
+	}
+
+	err := run.ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range keys {
+		g := groups[id]
+		record := map[string]interface{}{}
+		if stage.Group != nil {
+			record["group"] = g.key
+		}
+		for name, field := range stage.Aggregate {
+			record[name] = g.fields[name].value(field)
+		}
+
+		err := run.send(out, record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aggregator the state of an aggregated field
+type aggregator struct {
+	count   int
+	numbers int
+	sum     float64
+	min     *float64
+	max     *float64
+	first   interface{}
+	last    interface{}
+	values  []interface{}
+}
+
+func (agg *aggregator) add(field AggregateField, value interface{}) error {
+	if agg.count == 0 {
+		agg.first = value
+	}
+	agg.count++
+	agg.last = value
+
+	switch field.OP {
+	case "count", "first", "last":
+		return nil
+
+	case "collect":
+		agg.values = append(agg.values, value)
+		return nil
+
+	case "sum", "avg", "min", "max":
+		if value == nil {
+			return nil
+		}
+
+		v := any.Of(value)
+		if !v.IsNumber() {
+			return fmt.Errorf("%s: %v is not a number", field.OP, value)
+		}
+
+		number := v.CFloat64()
+		agg.numbers++
+		agg.sum = agg.sum + number
+		if agg.min == nil || number < *agg.min {
+			agg.min = &number
+		}
+		if agg.max == nil || number > *agg.max {
+			agg.max = &number
+		}
+		return nil
+	}
+
+	return fmt.Errorf("the op %s does not support", field.OP)
+}
+
+func (agg *aggregator) value(field AggregateField) interface{} {
+	switch field.OP {
+	case "count":
+		return agg.count
+	case "sum":
+		return agg.sum
+	case "avg":
+		if agg.numbers == 0 {
+			return nil
+		}
+		return agg.sum / float64(agg.numbers)
+	case "min":
+		if agg.min == nil {
+			return nil
+		}
+		return *agg.min
+	case "max":
+		if agg.max == nil {
+			return nil
+		}
+		return *agg.max
+	case "first":
+		return agg.first
+	case "last":
+		return agg.last
+	case "collect":
+		return agg.values
+	}
+	return nil
+}
+
+// toArray convert the slice value to []interface{}, nil if the value is not a slice
+func toArray(value interface{}) ([]interface{}, bool) {
+	if value == nil {
+		return []interface{}{}, true
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	values := []interface{}{}
+	for i := 0; i < rv.Len(); i++ {
+		values = append(values, rv.Index(i).Interface())
+	}
+	return values, true
+}
@@ -0,0 +1,197 @@
+package pipe
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/fs"
+	"github.com/yaoapp/gou/helper"
+	"github.com/yaoapp/gou/store"
+	"github.com/yaoapp/kun/maps"
+)
+
+// sink write the records of the last stage, the records are collected if the sink is not set
+func (run *runner) sink(in <-chan interface{}, res *Result) error {
+	sink := run.pipe.Sink
+	if sink == nil {
+		res.Records = []interface{}{}
+		for record := range in {
+			res.Records = append(res.Records, record)
+			res.Written++
+		}
+		return run.ctx.Err()
+	}
+
+	var err error
+	switch sink.Type {
+	case "model":
+		err = run.sinkModel(in, sink, res)
+
+	case "file":
+		err = run.sinkFile(in, sink, res)
+
+	case "store":
+		err = run.sinkStore(in, sink, res)
+
+	case "process":
+		err = run.sinkProcess(in, sink, res)
+
+	default:
+		err = fmt.Errorf("the sink type %s does not support", sink.Type)
+	}
+
+	if err != nil {
+		return fmt.Errorf("sink %s: %s", sink.Type, err.Error())
+	}
+	return run.ctx.Err()
+}
+
+// sinkModel insert the records into the model in chunks
+func (run *runner) sinkModel(in <-chan interface{}, sink *Sink, res *Result) error {
+	chunk := sink.Chunk
+	if chunk <= 0 {
+		chunk = 100
+	}
+
+	name := fmt.Sprintf("models.%s.Insert", sink.Model)
+	columns := sink.Columns
+	rows := [][]interface{}{}
+	insert := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+
+		_, err := run.call(name, []interface{}{columns, rows}, nil, nil)
+		if err != nil {
+			return err
+		}
+		res.Written = res.Written + len(rows)
+		rows = [][]interface{}{}
+		return nil
+	}
+
+	for record := range in {
+		var row map[string]interface{}
+		switch value := record.(type) {
+		case map[string]interface{}:
+			row = value
+		case maps.MapStr:
+			row = value
+		default:
+			return fmt.Errorf("the record should be a map, %T given", record)
+		}
+
+		if len(columns) == 0 {
+			for column := range row {
+				columns = append(columns, column)
+			}
+			sort.Strings(columns)
+		}
+
+		values := []interface{}{}
+		for _, column := range columns {
+			values = append(values, row[column])
+		}
+		rows = append(rows, values)
+
+		if len(rows) >= chunk {
+			err := insert()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if run.ctx.Err() != nil {
+		return nil
+	}
+	return insert()
+}
+
+// sinkFile write the records to the file, one record per line
+func (run *runner) sinkFile(in <-chan interface{}, sink *Sink, res *Result) error {
+	name := sink.FS
+	if name == "" {
+		name = "system"
+	}
+
+	xfs, err := fs.Get(name)
+	if err != nil {
+		return err
+	}
+
+	// overwrite the file
+	exists, err := fs.Exists(xfs, sink.File)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		err = fs.Remove(xfs, sink.File)
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := fs.WriteCloser(xfs, sink.File, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for record := range in {
+		line := ""
+		if value, ok := record.(string); ok && sink.Format == "line" {
+			line = value
+		} else {
+			bytes, err := jsoniter.Marshal(record)
+			if err != nil {
+				return err
+			}
+			line = string(bytes)
+		}
+
+		_, err = writer.WriteString(line + "\n")
+		if err != nil {
+			return err
+		}
+		res.Written++
+	}
+
+	return writer.Flush()
+}
+
+// sinkStore set the records to the store by the bound key
+func (run *runner) sinkStore(in <-chan interface{}, sink *Sink, res *Result) error {
+	stor, has := store.Pools[sink.Store]
+	if !has {
+		return fmt.Errorf("the store %s does not load", sink.Store)
+	}
+
+	ttl := time.Duration(sink.TTL) * time.Second
+	for record := range in {
+		key := fmt.Sprintf("%v", helper.Bind(sink.Key, run.data(record)))
+		err := stor.Set(key, record, ttl)
+		if err != nil {
+			return err
+		}
+		res.Written++
+	}
+	return nil
+}
+
+// sinkProcess call the process per record
+func (run *runner) sinkProcess(in <-chan interface{}, sink *Sink, res *Result) error {
+	for record := range in {
+		_, err := run.call(sink.Process, sink.Args, record, run.data(record))
+		if err != nil {
+			return err
+		}
+		res.Written++
+	}
+	return nil
+}
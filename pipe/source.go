@@ -0,0 +1,212 @@
+package pipe
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/fs"
+	"github.com/yaoapp/gou/helper"
+	"github.com/yaoapp/gou/http"
+	"github.com/yaoapp/kun/any"
+)
+
+// source read the records from the source and send them to out
+func (run *runner) source(out chan<- interface{}) error {
+	src := run.pipe.Source
+	data := run.data(nil)
+
+	switch src.Type {
+	case "input":
+		if len(run.in) == 0 {
+			return nil
+		}
+		return run.emitArray(out, run.in[0])
+
+	case "values":
+		return run.emitArray(out, helper.Bind(src.Values, data))
+
+	case "process":
+		res, err := run.call(src.Process, src.Args, nil, data)
+		if err != nil {
+			return err
+		}
+		return run.emitArray(out, res)
+
+	case "model":
+		return run.sourceModel(out, src, data)
+
+	case "file":
+		return run.sourceFile(out, src)
+
+	case "http":
+		return run.sourceHTTP(out, src, data)
+	}
+
+	return fmt.Errorf("the source type %s does not support", src.Type)
+}
+
+// emit send the record read from the source
+func (run *runner) emit(out chan<- interface{}, record interface{}) error {
+	err := run.send(out, record)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&run.read, 1)
+	return nil
+}
+
+// emitArray send the elements of the array
+func (run *runner) emitArray(out chan<- interface{}, value interface{}) error {
+	records, ok := toArray(value)
+	if !ok {
+		return fmt.Errorf("the source should be an array, %T given", value)
+	}
+
+	for _, record := range records {
+		err := run.emit(out, record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceModel read the rows of the model page by page
+func (run *runner) sourceModel(out chan<- interface{}, src Source, data map[string]interface{}) error {
+	chunk := src.Chunk
+	if chunk <= 0 {
+		chunk = 100
+	}
+
+	query := map[string]interface{}{}
+	if src.Query != nil {
+		query = any.Of(helper.Bind(src.Query, data)).MapStr()
+	}
+
+	name := fmt.Sprintf("models.%s.Paginate", src.Model)
+	for page := 1; ; page++ {
+		res, err := run.call(name, []interface{}{query, page, chunk}, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		result := any.Of(res).MapStr()
+		rows, ok := toArray(result.Get("data"))
+		if !ok {
+			return fmt.Errorf("%s returns invalid data", name)
+		}
+
+		for _, row := range rows {
+			err := run.emit(out, row)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < chunk || page >= any.Of(result.Get("pagecnt")).CInt() {
+			return nil
+		}
+	}
+}
+
+// sourceFile read the file line by line
+func (run *runner) sourceFile(out chan<- interface{}, src Source) error {
+	name := src.FS
+	if name == "" {
+		name = "system"
+	}
+
+	xfs, err := fs.Get(name)
+	if err != nil {
+		return err
+	}
+
+	reader, err := fs.ReadCloser(xfs, src.File)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		record, ok, err := decode(scanner.Bytes(), src.Format)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			continue
+		}
+
+		err = run.emit(out, record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// sourceHTTP read the lines of the http stream
+func (run *runner) sourceHTTP(out chan<- interface{}, src Source, data map[string]interface{}) error {
+	method := strings.ToUpper(src.Method)
+	if method == "" {
+		method = "GET"
+	}
+
+	req := http.New(fmt.Sprintf("%v", helper.Bind(src.URL, data)))
+	for name, value := range src.Headers {
+		req.AddHeader(name, fmt.Sprintf("%v", helper.Bind(value, data)))
+	}
+
+	var failed error
+	err := req.Stream(run.ctx, method, helper.Bind(src.Data, data), func(line []byte) int {
+		record, ok, err := decode(line, src.Format)
+		if err != nil {
+			failed = err
+			return http.HandlerReturnBreak
+		}
+
+		if !ok {
+			return http.HandlerReturnOk
+		}
+
+		err = run.emit(out, record)
+		if err != nil {
+			failed = err
+			return http.HandlerReturnBreak
+		}
+		return http.HandlerReturnOk
+	})
+
+	if failed != nil {
+		return failed
+	}
+	return err
+}
+
+// decode the line, the blank lines are skipped (ok is false)
+// the json line could be a server-sent event "data: {...}", the "[DONE]" event is skipped
+func decode(line []byte, format string) (interface{}, bool, error) {
+	if format == "line" {
+		return string(line), true, nil
+	}
+
+	line = bytes.TrimSpace(line)
+	line = bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+	if len(line) == 0 || string(line) == "[DONE]" {
+		return nil, false, nil
+	}
+
+	var record interface{}
+	err := jsoniter.Unmarshal(line, &record)
+	if err != nil {
+		return nil, false, fmt.Errorf("decode %s: %s", string(line), err.Error())
+	}
+	return record, true, nil
+}
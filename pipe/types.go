@@ -0,0 +1,80 @@
+package pipe
+
+import "github.com/yaoapp/gou/query/share"
+
+// Pipe the streaming data pipeline, the records are read from the source,
+// pass through the stages one by one and written to the sink
+type Pipe struct {
+	ID          string  `json:"-"`
+	File        string  `json:"-"`
+	Name        string  `json:"name"`
+	Version     string  `json:"version,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Source      Source  `json:"source"`
+	Stages      []Stage `json:"stages,omitempty"`
+	Sink        *Sink   `json:"sink,omitempty"`   // the records are returned if the sink is not set
+	Buffer      int     `json:"buffer,omitempty"` // the buffer size between the stages, the source blocks when the buffer is full, default 100
+}
+
+// Source the source of the records
+type Source struct {
+	Type    string                 `json:"type"`              // input, values, process, model, file, http
+	Values  []interface{}          `json:"values,omitempty"`  // values: the records
+	Process string                 `json:"process,omitempty"` // process: the process returns an array
+	Args    []interface{}          `json:"args,omitempty"`    // process: the args, $in is the pipe args
+	Model   string                 `json:"model,omitempty"`   // model: the model name
+	Query   map[string]interface{} `json:"query,omitempty"`   // model: the query param
+	Chunk   int                    `json:"chunk,omitempty"`   // model: the rows per page, default 100
+	FS      string                 `json:"fs,omitempty"`      // file: the file system name, default system
+	File    string                 `json:"file,omitempty"`    // file: the file name
+	Format  string                 `json:"format,omitempty"`  // file, http: line (the record is the line) or json (the record is the line decoded), default json
+	URL     string                 `json:"url,omitempty"`     // http: the stream url
+	Method  string                 `json:"method,omitempty"`  // http: the method, default GET
+	Headers map[string]string      `json:"headers,omitempty"` // http: the request headers
+	Data    interface{}            `json:"data,omitempty"`    // http: the request payload
+}
+
+// Stage the stage of the pipe, the records of the stage are bound as $record
+type Stage struct {
+	Name      string                    `json:"name,omitempty"`
+	Type      string                    `json:"type"`                // process, query, map, filter, batch, aggregate
+	Process   string                    `json:"process,omitempty"`   // process: the returned value is the new record, nil drops the record
+	Args      []interface{}             `json:"args,omitempty"`      // process: the args, default [$record]
+	Engine    string                    `json:"engine,omitempty"`    // query: the query engine name
+	Query     interface{}               `json:"query,omitempty"`     // query: the query source
+	DSL       share.DSL                 `json:"-"`                   // query: the query DSL
+	Map       interface{}               `json:"map,omitempty"`       // map: the bound value is the new record
+	Filter    interface{}               `json:"filter,omitempty"`    // filter: the condition of the flow node when, drops the record if false
+	Size      int                       `json:"size,omitempty"`      // batch: the records per batch, default 100
+	Group     interface{}               `json:"group,omitempty"`     // aggregate: the bound group key, all records in one group if not set
+	Aggregate map[string]AggregateField `json:"aggregate,omitempty"` // aggregate: the fields of the aggregated record
+}
+
+// AggregateField the aggregated field
+type AggregateField struct {
+	OP    string      `json:"op"`              // count, sum, avg, min, max, first, last, collect
+	Value interface{} `json:"value,omitempty"` // the bound value of the record
+}
+
+// Sink the destination of the records
+type Sink struct {
+	Type    string        `json:"type"`              // model, file, store, process
+	Model   string        `json:"model,omitempty"`   // model: the model name, the records are inserted in chunks
+	Columns []string      `json:"columns,omitempty"` // model: the columns, default the keys of the first record
+	Chunk   int           `json:"chunk,omitempty"`   // model: the rows per insert, default 100
+	FS      string        `json:"fs,omitempty"`      // file: the file system name, default system
+	File    string        `json:"file,omitempty"`    // file: the file name, one record per line
+	Format  string        `json:"format,omitempty"`  // file: line or json, default json
+	Store   string        `json:"store,omitempty"`   // store: the store name
+	Key     interface{}   `json:"key,omitempty"`     // store: the bound key of the record
+	TTL     int           `json:"ttl,omitempty"`     // store: the ttl in seconds, 0 means no expiration
+	Process string        `json:"process,omitempty"` // process: called per record
+	Args    []interface{} `json:"args,omitempty"`    // process: the args, default [$record]
+}
+
+// Result the result of the pipe
+type Result struct {
+	Read    int           `json:"read"`              // the records read from the source
+	Written int           `json:"written"`           // the records written to the sink or returned
+	Records []interface{} `json:"records,omitempty"` // the records, if the sink is not set
+}
@@ -0,0 +1,273 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yaoapp/kun/any"
+	"github.com/yaoapp/kun/exception"
+)
+
+// the status of the asynchronous job
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// AsyncTimeout the timeout of the jobs launched by process.Async, 0 is no timeout
+var AsyncTimeout time.Duration = 10 * time.Minute
+
+// jobTTL the finished jobs launched by process.Async are removed after the ttl if not awaited
+var jobTTL = 10 * time.Minute
+
+// jobs the jobs launched by process.Async, the job id => job
+var jobs = map[string]*Job{}
+var jobsLock sync.Mutex
+
+// Job the handle of the asynchronous process
+type Job struct {
+	ID       string
+	Process  *Process
+	Created  time.Time
+	Finished time.Time
+	status   string
+	value    interface{}
+	err      error
+	done     chan struct{}
+	cancel   context.CancelFunc
+	lock     sync.Mutex
+}
+
+func init() {
+	RegisterGroup("process", map[string]Handler{
+		"async": processAsync,
+		"await": processAwait,
+	}, map[string]Meta{
+		"async": {
+			Description: "Run the process asynchronously, returns the job id",
+			Args: []Arg{
+				{Name: "name", Description: "the process name", Required: true, Schema: map[string]interface{}{"type": "string", "minLength": 1}},
+				{Name: "args", Description: "the args of the process, the rest args are passed to the process"},
+			},
+			Return: map[string]interface{}{"type": "string"},
+		},
+		"await": {
+			Description: "Wait for the jobs, returns the result of the job, or the results of the jobs in order",
+			Args: []Arg{
+				{Name: "id", Description: "the job id or the job ids", Required: true, Schema: map[string]interface{}{
+					"type": []interface{}{"string", "array"}, "items": map[string]interface{}{"type": "string"},
+				}},
+				{Name: "timeout", Description: "the timeout in seconds", Schema: map[string]interface{}{"type": "number", "exclusiveMinimum": 0}},
+			},
+		},
+	})
+}
+
+// Go run the process asynchronously, the job is canceled when the context done
+func Go(ctx context.Context, name string, args ...interface{}) (*Job, error) {
+	process, err := Of(name, args...)
+	if err != nil {
+		return nil, err
+	}
+	return process.WithContext(ctx).ExecuteAsync()
+}
+
+// ExecuteAsync execute the process asynchronously and return the job handle.
+// the job has no default timeout, it runs until the handler finished or the context of the process done
+func (process *Process) ExecuteAsync() (*Job, error) {
+	if _, err := process.handler(); err != nil {
+		return nil, err
+	}
+
+	parent := process.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	process.Context = ctx
+	job := &Job{
+		ID:      uuid.NewString(),
+		Process: process,
+		Created: time.Now(),
+		status:  JobRunning,
+		done:    make(chan struct{}),
+		cancel:  cancel,
+	}
+
+	go func() {
+		defer cancel()
+		// the handler may still run after the context done, the value is read once the handler finished
+		err := process.Execute()
+		value := process.Value()
+		process.Release()
+
+		job.lock.Lock()
+		defer job.lock.Unlock()
+		job.Finished = time.Now()
+		job.value = value
+		job.err = err
+		if job.status == JobRunning {
+			job.status = JobCompleted
+			if err != nil {
+				job.status = JobFailed
+			}
+		}
+		close(job.done)
+	}()
+
+	return job, nil
+}
+
+// Wait for the job finished, returns the result of the process
+func (job *Job) Wait() (interface{}, error) {
+	<-job.done
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	return job.value, job.err
+}
+
+// Done returns a channel that's closed when the job finished
+func (job *Job) Done() <-chan struct{} {
+	return job.done
+}
+
+// Cancel the job, the handler may still run in background if it does not check the context
+func (job *Job) Cancel() {
+	job.lock.Lock()
+	if job.status == JobRunning {
+		job.status = JobCanceled
+	}
+	job.lock.Unlock()
+	job.cancel()
+}
+
+// Status the status of the job
+func (job *Job) Status() string {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	return job.status
+}
+
+// track the job launched by process.Async, the job is removed after the ttl once finished
+func (job *Job) track() {
+	jobsLock.Lock()
+	jobs[job.ID] = job
+	jobsLock.Unlock()
+
+	go func() {
+		<-job.done
+		time.AfterFunc(jobTTL, func() { untrack(job.ID) })
+	}()
+}
+
+// untrack remove the job
+func untrack(id string) {
+	jobsLock.Lock()
+	delete(jobs, id)
+	jobsLock.Unlock()
+}
+
+// process.Async
+// args: [name, args...]
+func processAsync(process *Process) interface{} {
+	process.ValidateArgNums(1)
+	p, err := Of(process.ArgsString(0), process.Args[1:]...)
+	if err != nil {
+		exception.New(err.Error(), 404).Throw()
+	}
+
+	// the job is detached from the caller, the caller context is done once the caller returns
+	p.Sid = process.Sid
+	p.Global = process.Global
+	ctx := context.Background()
+	cancel := func() {}
+	if AsyncTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, AsyncTimeout)
+	}
+
+	job, err := p.WithContext(ctx).ExecuteAsync()
+	if err != nil {
+		cancel()
+		exception.New(err.Error(), 404).Throw()
+	}
+
+	go func() {
+		<-job.Done()
+		cancel()
+	}()
+
+	job.track()
+	return job.ID
+}
+
+// process.Await
+// args: [id | [id...], timeout?]
+func processAwait(process *Process) interface{} {
+	process.ValidateArgNums(1)
+
+	ids := []string{}
+	single := false
+	switch value := process.Args[0].(type) {
+	case string:
+		ids = append(ids, value)
+		single = true
+	default:
+		ids = process.ArgsStrings(0)
+	}
+
+	selected := []*Job{}
+	jobsLock.Lock()
+	for _, id := range ids {
+		job, has := jobs[id]
+		if !has {
+			jobsLock.Unlock()
+			exception.New("job %s not found", 404, id).Throw()
+		}
+		selected = append(selected, job)
+	}
+	jobsLock.Unlock()
+
+	var timeout <-chan time.Time
+	if process.NumOfArgs() > 1 {
+		timer := time.NewTimer(time.Duration(any.Of(process.Args[1]).CFloat64() * float64(time.Second)))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var ctxDone <-chan struct{}
+	if process.Context != nil {
+		ctxDone = process.Context.Done()
+	}
+
+	results := []interface{}{}
+	for _, job := range selected {
+		select {
+		case <-job.Done():
+		case <-timeout:
+			exception.New("job %s timeout", 408, job.ID).Throw()
+		case <-ctxDone:
+			exception.New("job %s: %s", 500, job.ID, process.Context.Err().Error()).Throw()
+		}
+
+		value, err := job.Wait()
+		untrack(job.ID)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				exception.New("job %s canceled", 500, job.ID).Throw()
+			}
+			exception.New("job %s: %s", 500, job.ID, err.Error()).Throw()
+		}
+		results = append(results, value)
+	}
+
+	if single {
+		return results[0]
+	}
+	return results
+}
@@ -0,0 +1,139 @@
+package process
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/kun/exception"
+)
+
+func TestGo(t *testing.T) {
+	prepareAsync()
+
+	job, err := Go(context.Background(), "unit.async.sleep", 50, "done")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, JobRunning, job.Status())
+
+	res, err := job.Wait()
+	assert.Nil(t, err)
+	assert.Equal(t, "done", res)
+	assert.Equal(t, JobCompleted, job.Status())
+
+	job, err = Go(context.Background(), "unit.async.fail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = job.Wait()
+	assert.Contains(t, err.Error(), "async failed")
+	assert.Equal(t, JobFailed, job.Status())
+
+	job, err = Go(context.Background(), "unit.async.sleep", 5000, "never")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.Cancel()
+	_, err = job.Wait()
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, JobCanceled, job.Status())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	job, err = Go(ctx, "unit.async.sleep", 5000, "never")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = job.Wait()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, JobFailed, job.Status())
+
+	_, err = Go(context.Background(), "unit.async.missing")
+	assert.NotNil(t, err)
+}
+
+func TestAsyncAwait(t *testing.T) {
+	prepareAsync()
+
+	start := time.Now()
+	ids := []interface{}{}
+	for _, value := range []string{"a", "b", "c"} {
+		id, err := New("process.Async", "unit.async.sleep", 50, value).Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	res, err := New("process.Await", ids).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []interface{}{"a", "b", "c"}, res)
+	assert.Less(t, time.Since(start), 140*time.Millisecond)
+
+	// the awaited jobs are removed
+	_, err = New("process.Await", ids[0]).Exec()
+	assert.Contains(t, err.Error(), "not found")
+
+	id, err := New("process.Async", "unit.async.sleep", 1000, "slow").WithSID("sid-async").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New("process.Await", id, 0.02).Exec()
+	assert.Contains(t, err.Error(), "408")
+
+	jobsLock.Lock()
+	job := jobs[id.(string)]
+	jobsLock.Unlock()
+	assert.Equal(t, "sid-async", job.Process.Sid)
+	job.Cancel()
+	_, err = New("process.Await", id).Exec()
+	assert.Contains(t, err.Error(), "canceled")
+
+	id, err = New("process.Async", "unit.async.fail").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New("process.Await", id).Exec()
+	assert.Contains(t, err.Error(), "async failed")
+
+	_, err = New("process.Async", "unit.async.missing").Exec()
+	assert.Contains(t, err.Error(), "404")
+
+	_, err = New("process.Async").Exec()
+	assert.Contains(t, err.Error(), "400")
+
+	// the timeout of the jobs
+	AsyncTimeout = 50 * time.Millisecond
+	defer func() { AsyncTimeout = 10 * time.Minute }()
+	stopped := make(chan struct{})
+	Register("unit.async.block", func(process *Process) interface{} {
+		<-process.Context.Done()
+		close(stopped)
+		return nil
+	})
+
+	id, err = New("process.Async", "unit.async.block").Exec()
+	assert.Nil(t, err)
+	_, err = New("process.Await", id, 1).Exec()
+	assert.Contains(t, err.Error(), "deadline exceeded")
+	<-stopped
+}
+
+func prepareAsync() {
+	Register("unit.async.sleep", func(process *Process) interface{} {
+		select {
+		case <-time.After(time.Duration(process.ArgsInt(0)) * time.Millisecond):
+		case <-process.Context.Done():
+		}
+		return process.Args[1]
+	})
+
+	Register("unit.async.fail", func(process *Process) interface{} {
+		exception.New("async failed", 500).Throw()
+		return nil
+	})
+}
@@ -0,0 +1,161 @@
+package process
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yaoapp/kun/exception"
+)
+
+// Interceptor wraps the handler invocation of the processes.
+// call next to run the handler (or the next interceptor), the args could be changed before calling next.
+// return a value without calling next to short-circuit, throw an exception to fail the process.
+type Interceptor func(process *Process, next Handler) interface{}
+
+type interceptor struct {
+	name    string
+	pattern string
+	handle  Interceptor
+}
+
+var interceptors = []interceptor{}
+var interceptorsLock sync.RWMutex
+
+// Intercept register the interceptor for the processes matched the name pattern, eg: "*", "models.*", "scripts.*.Hello"
+// the pattern is matched with the lowercased process name by path.Match, the first registered interceptor is the outermost.
+// the interceptor with the same name is replaced.
+func Intercept(name string, pattern string, handle Interceptor) error {
+	pattern = strings.ToLower(pattern)
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return fmt.Errorf("interceptor %s: the pattern %s is invalid", name, pattern)
+	}
+
+	interceptorsLock.Lock()
+	defer interceptorsLock.Unlock()
+	for i, itc := range interceptors {
+		if itc.name == name {
+			interceptors[i] = interceptor{name: name, pattern: pattern, handle: handle}
+			return nil
+		}
+	}
+
+	interceptors = append(interceptors, interceptor{name: name, pattern: pattern, handle: handle})
+	return nil
+}
+
+// InterceptProcess register the processes as the interceptor of the processes matched the name pattern.
+// the before process is called with {name, args, sid, global}, it returns {"args": [...]} to change the args,
+// or {"result": <value>} to short-circuit, or throws an exception to fail the process.
+// the after process is called with {name, args, result, error, duration}, the duration is in milliseconds.
+// the interceptor processes are not intercepted.
+func InterceptProcess(name string, pattern string, before string, after string) error {
+	return Intercept(name, pattern, func(process *Process, next Handler) interface{} {
+
+		if before != "" {
+			res := process.direct(before, map[string]interface{}{
+				"name":   process.Name,
+				"args":   process.Args,
+				"sid":    process.Sid,
+				"global": process.Global,
+			})
+
+			if values, ok := res.(map[string]interface{}); ok {
+				if result, has := values["result"]; has {
+					return result
+				}
+
+				if args, ok := values["args"].([]interface{}); ok {
+					process.Args = args
+				}
+			}
+		}
+
+		if after == "" {
+			return next(process)
+		}
+
+		start := time.Now()
+		var res interface{}
+		defer func() {
+			recovered := recover()
+			payload := map[string]interface{}{
+				"name":     process.Name,
+				"args":     process.Args,
+				"result":   res,
+				"duration": float64(time.Since(start).Microseconds()) / 1000,
+			}
+
+			if err := exception.Catch(recovered); err != nil {
+				payload["error"] = exception.Trim(err)
+			}
+
+			process.direct(after, payload)
+			if recovered != nil {
+				panic(recovered)
+			}
+		}()
+
+		res = next(process)
+		return res
+	})
+}
+
+// RemoveInterceptor remove the interceptor by the name
+func RemoveInterceptor(name string) {
+	interceptorsLock.Lock()
+	defer interceptorsLock.Unlock()
+	for i, itc := range interceptors {
+		if itc.name == name {
+			interceptors = append(interceptors[:i], interceptors[i+1:]...)
+			return
+		}
+	}
+}
+
+// invoke the handler with the matched interceptors, the args are validated with the metadata before the handler runs
+func (process *Process) invoke(hd Handler) interface{} {
+	name := strings.ToLower(process.Name)
+
+	interceptorsLock.RLock()
+	chain := []Interceptor{}
+	for _, itc := range interceptors {
+		if matched, _ := path.Match(itc.pattern, name); matched {
+			chain = append(chain, itc.handle)
+		}
+	}
+	interceptorsLock.RUnlock()
+
+	next := func(process *Process) interface{} {
+		process.validate()
+		return hd(process)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		handle := chain[i]
+		inner := next
+		next = func(process *Process) interface{} { return handle(process, inner) }
+	}
+	return next(process)
+}
+
+// direct run the process without the interceptors, with the session and the context of the intercepted process
+func (process *Process) direct(name string, args ...interface{}) interface{} {
+	p, err := Of(name, args...)
+	if err != nil {
+		exception.New("%s", 500, err.Error()).Throw()
+	}
+
+	hd, err := p.handler()
+	if err != nil {
+		exception.New("%s", 500, err.Error()).Throw()
+	}
+
+	p.Sid = process.Sid
+	p.Global = process.Global
+	p.Context = process.Context
+	p.validate()
+	return hd(p)
+}
@@ -0,0 +1,128 @@
+package process
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/kun/exception"
+)
+
+func TestIntercept(t *testing.T) {
+	prepareInterceptor()
+	defer RemoveInterceptor("unit.outer")
+	defer RemoveInterceptor("unit.inner")
+
+	calls := []string{}
+	var lock sync.Mutex
+	err := Intercept("unit.outer", "unit.itc.*", func(process *Process, next Handler) interface{} {
+		lock.Lock()
+		calls = append(calls, "outer")
+		lock.Unlock()
+
+		if process.ArgsString(0) == "blocked" {
+			exception.New("%s is blocked", 403, process.Name).Throw()
+		}
+
+		// redact the args
+		process.Args = []interface{}{strings.ToUpper(process.ArgsString(0))}
+		return next(process)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Intercept("unit.inner", "unit.itc.echo", func(process *Process, next Handler) interface{} {
+		lock.Lock()
+		calls = append(calls, "inner")
+		lock.Unlock()
+
+		if process.ArgsString(0) == "CACHED" {
+			return "from cache"
+		}
+		return next(process)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := New("unit.itc.Echo", "hello").Exec()
+	assert.Nil(t, err)
+	assert.Equal(t, "HELLO", res)
+	assert.Equal(t, []string{"outer", "inner"}, calls)
+
+	p := New("unit.itc.echo", "cached")
+	err = p.Execute()
+	assert.Nil(t, err)
+	assert.Equal(t, "from cache", p.Value())
+
+	_, err = New("unit.itc.echo", "blocked").Exec()
+	assert.Contains(t, err.Error(), "403")
+
+	// the other processes are not intercepted
+	calls = []string{}
+	assert.Equal(t, "world", New("unit.test.echo", "world").Run())
+	assert.Empty(t, calls)
+
+	assert.NotNil(t, Intercept("unit.invalid", "[", nil))
+}
+
+func TestInterceptProcess(t *testing.T) {
+	prepareInterceptor()
+	defer RemoveInterceptor("unit.audit")
+
+	audits := []map[string]interface{}{}
+	var lock sync.Mutex
+	Register("unit.audit.before", func(process *Process) interface{} {
+		payload := process.ArgsMap(0)
+		if payload["args"].([]interface{})[0] == "short" {
+			return map[string]interface{}{"result": "short-circuit"}
+		}
+		return map[string]interface{}{"args": []interface{}{"changed"}}
+	})
+
+	Register("unit.audit.after", func(process *Process) interface{} {
+		lock.Lock()
+		defer lock.Unlock()
+		audits = append(audits, process.ArgsMap(0))
+		return nil
+	})
+
+	// the interceptor processes are matched by the pattern too
+	err := InterceptProcess("unit.audit", "unit.*", "unit.audit.before", "unit.audit.after")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := New("unit.itc.echo", "origin").Exec()
+	assert.Nil(t, err)
+	assert.Equal(t, "changed", res)
+
+	res, err = New("unit.itc.echo", "short").Exec()
+	assert.Nil(t, err)
+	assert.Equal(t, "short-circuit", res)
+
+	_, err = New("unit.itc.fail", "origin").Exec()
+	assert.NotNil(t, err)
+
+	assert.Equal(t, 2, len(audits))
+	assert.Equal(t, "changed", audits[0]["result"])
+	assert.Equal(t, "unit.itc.fail", audits[1]["name"])
+	assert.Equal(t, "failed", audits[1]["error"])
+}
+
+func prepareInterceptor() {
+	Register("unit.itc.echo", func(process *Process) interface{} {
+		return process.Args[0]
+	})
+
+	Register("unit.itc.fail", func(process *Process) interface{} {
+		exception.New("failed", 500).Throw()
+		return nil
+	})
+
+	Register("unit.test.echo", func(process *Process) interface{} {
+		return process.Args[0]
+	})
+}
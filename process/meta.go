@@ -0,0 +1,185 @@
+package process
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/helper"
+	"github.com/yaoapp/kun/exception"
+	"github.com/yaoapp/kun/log"
+)
+
+// Metas the metadata of the process handlers, the handler name => metadata
+var Metas = map[string]*Meta{}
+
+// Meta the metadata of the process handler
+type Meta struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Args        []Arg                  `json:"args,omitempty"`
+	Return      map[string]interface{} `json:"return,omitempty"` // the JSON schema of the return value
+	Deprecated  bool                   `json:"deprecated,omitempty"`
+}
+
+// Arg the metadata of the process argument
+type Arg struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Required    bool                   `json:"required,omitempty"`
+	Schema      map[string]interface{} `json:"schema,omitempty"` // the JSON schema of the argument
+}
+
+// deprecated the deprecated handlers warned
+var deprecated = sync.Map{}
+
+func init() {
+	RegisterGroup("process", map[string]Handler{
+		"list":     processList,
+		"describe": processDescribe,
+	}, map[string]Meta{
+		"list": {
+			Description: "List the registered processes with the metadata",
+			Args:        []Arg{{Name: "pattern", Description: "the name pattern, eg: models.*", Schema: map[string]interface{}{"type": "string"}}},
+			Return:      map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "object"}},
+		},
+		"describe": {
+			Description: "Get the metadata of the process",
+			Args:        []Arg{{Name: "name", Description: "the process name, eg: models.user.Find", Required: true, Schema: map[string]interface{}{"type": "string"}}},
+			Return:      map[string]interface{}{"type": "object"},
+		},
+	})
+}
+
+// Describe set the metadata of the registered process handler
+func Describe(name string, meta Meta) {
+	name = strings.ToLower(name)
+	meta.Name = name
+	Metas[name] = &meta
+}
+
+// MetaOf get the metadata of the process, returns nil if the process has no metadata
+func MetaOf(name string) (*Meta, error) {
+	process, err := Of(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := process.handler(); err != nil {
+		return nil, err
+	}
+	return Metas[process.Handler], nil
+}
+
+// List the metadata of the registered processes matched the name pattern, all the processes if the pattern is empty.
+// the processes without metadata have the name only
+func List(pattern string) ([]Meta, error) {
+	pattern = strings.ToLower(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("the pattern %s is invalid", pattern)
+	}
+
+	names := []string{}
+	for name := range Handlers {
+		if pattern != "" {
+			if matched, _ := path.Match(pattern, name); !matched {
+				continue
+			}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := []Meta{}
+	for _, name := range names {
+		if meta, has := Metas[name]; has {
+			res = append(res, *meta)
+			continue
+		}
+		res = append(res, Meta{Name: name})
+	}
+	return res, nil
+}
+
+// validate the args with the metadata of the handler
+func (process *Process) validate() {
+	meta, has := Metas[process.Handler]
+	if !has {
+		return
+	}
+
+	if meta.Deprecated {
+		if _, warned := deprecated.LoadOrStore(process.Handler, true); !warned {
+			log.Warn("[Process] %s is deprecated", process.Name)
+		}
+	}
+
+	errs := []string{}
+	for i, arg := range meta.Args {
+		name := fmt.Sprintf("args[%d]", i)
+		if arg.Name != "" {
+			name = fmt.Sprintf("%s(%s)", name, arg.Name)
+		}
+
+		if i >= len(process.Args) || process.Args[i] == nil {
+			if arg.Required {
+				errs = append(errs, fmt.Sprintf("%s is required", name))
+			}
+			continue
+		}
+		errs = append(errs, helper.ValidateSchema(arg.Schema, process.Args[i], name)...)
+	}
+
+	if len(errs) > 0 {
+		exception.New("%s: %s", 400, process.Name, strings.Join(errs, "; ")).Throw()
+	}
+}
+
+// mapOf the metadata as a map
+func (meta Meta) mapOf() map[string]interface{} {
+	res := map[string]interface{}{}
+	data, err := jsoniter.Marshal(meta)
+	if err != nil {
+		return res
+	}
+	jsoniter.Unmarshal(data, &res)
+	return res
+}
+
+// process.List
+// args: [pattern?]
+func processList(process *Process) interface{} {
+	pattern := ""
+	if len(process.Args) > 0 {
+		pattern = process.ArgsString(0)
+	}
+
+	metas, err := List(pattern)
+	if err != nil {
+		exception.New(err.Error(), 400).Throw()
+	}
+
+	res := []interface{}{}
+	for _, meta := range metas {
+		res = append(res, meta.mapOf())
+	}
+	return res
+}
+
+// process.Describe
+// args: [name]
+func processDescribe(process *Process) interface{} {
+	name := process.ArgsString(0)
+	meta, err := MetaOf(name)
+	if err != nil {
+		exception.New(err.Error(), 404).Throw()
+	}
+
+	if meta == nil {
+		return map[string]interface{}{"name": strings.ToLower(name)}
+	}
+	return meta.mapOf()
+}
@@ -0,0 +1,109 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/kun/any"
+)
+
+func TestMeta(t *testing.T) {
+	prepareMeta()
+
+	res, err := New("unit.meta.Greet", "yao", map[string]interface{}{"times": 2}).Exec()
+	assert.Nil(t, err)
+	assert.Equal(t, "hello yao x2", res)
+
+	// the optional arg
+	res, err = New("unit.meta.Greet", "yao").Exec()
+	assert.Nil(t, err)
+	assert.Equal(t, "hello yao x1", res)
+
+	_, err = New("unit.meta.Greet").Exec()
+	assert.Contains(t, err.Error(), "400")
+	assert.Contains(t, err.Error(), "args[0](name) is required")
+
+	_, err = New("unit.meta.Greet", 1).Exec()
+	assert.Contains(t, err.Error(), "args[0](name) should be string")
+
+	_, err = New("unit.meta.Greet", "", map[string]interface{}{"times": 1.5, "loud": true}).Exec()
+	assert.Contains(t, err.Error(), "args[0](name) should be at least 1 characters")
+	assert.Contains(t, err.Error(), "args[1](options).loud is not allowed")
+	assert.Contains(t, err.Error(), "args[1](options).times should be integer")
+
+	// the alias keeps the metadata
+	Alias("unit.meta.greet", "unit.meta.hello")
+	_, err = New("unit.meta.hello", 1).Exec()
+	assert.NotNil(t, err)
+
+	// the process without metadata is not validated
+	res, err = New("unit.meta.raw", 1).Exec()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res)
+}
+
+func TestMetaList(t *testing.T) {
+	prepareMeta()
+
+	metas, err := List("unit.meta.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, len(metas))
+	assert.Equal(t, "unit.meta.greet", metas[0].Name)
+	assert.Equal(t, "unit.meta.old", metas[1].Name)
+	assert.True(t, metas[1].Deprecated)
+	assert.Equal(t, Meta{Name: "unit.meta.raw"}, metas[2])
+
+	_, err = List("[")
+	assert.NotNil(t, err)
+
+	res, err := New("process.List", "unit.meta.g*").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := res.([]interface{})
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, "Greet someone", any.Of(list[0]).MapStr().Get("description"))
+
+	res, err = New("process.Describe", "unit.meta.Greet").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := any.Of(res).MapStr().Get("args").([]interface{})
+	assert.Equal(t, "name", any.Of(args[0]).MapStr().Get("name"))
+
+	_, err = New("process.Describe", "unit.meta.missing").Exec()
+	assert.Contains(t, err.Error(), "404")
+
+	_, err = New("process.Describe").Exec()
+	assert.Contains(t, err.Error(), "400")
+}
+
+func prepareMeta() {
+	Register("unit.meta.greet", func(process *Process) interface{} {
+		times := 1
+		if process.NumOfArgs() > 1 {
+			times = any.Of(process.ArgsMap(1)["times"]).CInt()
+		}
+		return "hello " + process.ArgsString(0) + " x" + any.Of(times).CString()
+	}, Meta{
+		Description: "Greet someone",
+		Args: []Arg{
+			{Name: "name", Required: true, Schema: map[string]interface{}{"type": "string", "minLength": 1}},
+			{Name: "options", Schema: map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{"times": map[string]interface{}{"type": "integer", "minimum": 1}},
+				"additionalProperties": false,
+			}},
+		},
+		Return: map[string]interface{}{"type": "string"},
+	})
+
+	RegisterGroup("unit.meta", map[string]Handler{
+		"raw": func(process *Process) interface{} { return process.Args[0] },
+		"old": func(process *Process) interface{} { return nil },
+	}, map[string]Meta{"old": {Deprecated: true}})
+	delete(Metas, "unit.meta.hello")
+	delete(Handlers, "unit.meta.hello")
+}
@@ -56,25 +56,31 @@ func (process *Process) Execute() (err error) {
 		return err
 	}
 
+	// the handler error, not shared with the returned error, the handler may still run after the context done
+	// the value is set by the caller, the process may be disposed while the handler is still running
+	var hdErr error
+	var value interface{}
 	done := make(chan struct{})
 	go func() {
 		defer close(done)
 		defer func() {
 			recovered := recover()
-			err = exception.Catch(recovered)
-			if err != nil {
-				exception.DebugPrint(err, "%s", process)
+			hdErr = exception.Catch(recovered)
+			if hdErr != nil {
+				exception.DebugPrint(hdErr, "%s", process)
 			}
 		}()
-		value := hd(process)
-		process._val = &value
+		value = process.invoke(hd)
 	}()
 
 	select {
 	case <-process.Context.Done():
 		return process.Context.Err()
 	case <-done:
-		return err
+		if hdErr == nil {
+			process._val = &value
+		}
+		return hdErr
 	}
 }
 
@@ -122,7 +128,7 @@ func (process *Process) Run() interface{} {
 	}
 
 	defer func() { process.Release() }()
-	return hd(process)
+	return process.invoke(hd)
 }
 
 // Exec execute the process and return error
@@ -150,22 +156,32 @@ func (process *Process) Exec() (value interface{}, err error) {
 	}
 
 	defer func() { err = exception.Catch(recover()) }()
-	value = hd(process)
+	value = process.invoke(hd)
 	return
 }
 
-// Register register a process handler
-func Register(name string, handler Handler) {
+// Register register a process handler, the metadata is optional
+func Register(name string, handler Handler, meta ...Meta) {
 	name = strings.ToLower(name)
 	Handlers[name] = handler
+	if len(meta) > 0 {
+		Describe(name, meta[0])
+	}
 }
 
-// RegisterGroup register a process handler group
-func RegisterGroup(name string, group map[string]Handler) {
+// RegisterGroup register a process handler group, the metadata of the methods is optional (method => metadata)
+func RegisterGroup(name string, group map[string]Handler, metas ...map[string]Meta) {
 	for method, handler := range group {
 		id := fmt.Sprintf("%s.%s", strings.ToLower(name), strings.ToLower(method))
 		Handlers[id] = handler
 	}
+
+	for _, meta := range metas {
+		for method, m := range meta {
+			id := fmt.Sprintf("%s.%s", strings.ToLower(name), strings.ToLower(method))
+			Describe(id, m)
+		}
+	}
 }
 
 // Alias set an alias a process
@@ -174,6 +190,9 @@ func Alias(name string, alias string) {
 	alias = strings.ToLower(alias)
 	if _, has := Handlers[name]; has {
 		Handlers[alias] = Handlers[name]
+		if meta, has := Metas[name]; has {
+			Describe(alias, *meta)
+		}
 		return
 	}
 	exception.New("Process: %s does not exist", 404, name).Throw()
@@ -0,0 +1,168 @@
+package schema
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/fs"
+	"github.com/yaoapp/gou/schema/types"
+)
+
+// Generate the model DSL of the tables, filter the tables by the given prefix (optional)
+// the hasOne/hasMany relations are guessed from the <table>_id columns
+func Generate(sch types.Schema, prefix ...string) (map[string]types.Model, error) {
+	tables, err := sch.Tables(prefix...)
+	if err != nil {
+		return nil, err
+	}
+
+	models := map[string]types.Model{}
+	foreigns := map[string][]types.Foreign{}
+	for _, name := range tables {
+		blueprint, err := sch.TableGet(name)
+		if err != nil {
+			return nil, err
+		}
+
+		models[name] = types.Model{
+			Name:      name,
+			Table:     types.ModelTable{Name: name},
+			Columns:   blueprint.Columns,
+			Indexes:   blueprint.Indexes,
+			Relations: map[string]types.Relation{},
+			Option:    blueprint.Option,
+		}
+
+		if len(blueprint.Foreigns) > 0 {
+			foreigns[name] = blueprint.Foreigns
+			model := models[name]
+			model.Option.Constraints = true
+			models[name] = model
+		}
+	}
+
+	tablePrefix := ""
+	if len(prefix) > 0 {
+		tablePrefix = prefix[0]
+	}
+	guessRelations(models, foreigns, tablePrefix)
+	return models, nil
+}
+
+// WriteModels write the model DSL files (<dir>/<name>.mod.yao) to the given filesystem, return the file list
+func WriteModels(stor fs.FileSystem, dir string, models map[string]types.Model) ([]string, error) {
+	files := []string{}
+	for _, name := range sortedModelNames(models) {
+		data, err := jsoniter.MarshalIndent(models[name], "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		file := filepath.Join(dir, fmt.Sprintf("%s.mod.yao", name))
+		_, err = fs.WriteFile(stor, file, data, 0644)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// guessRelations guess the relations from the foreign keys and the <table>_id columns
+// user.id <- pet.user_id: pet hasOne user (user), user hasMany pet (pet)
+func guessRelations(models map[string]types.Model, foreigns map[string][]types.Foreign, prefix string) {
+	for _, name := range sortedModelNames(models) {
+		constraints := map[string]types.Foreign{}
+		for _, foreign := range foreigns[name] {
+			constraints[foreign.Column] = foreign
+		}
+
+		for _, column := range models[name].Columns {
+			foreign, isForeign := constraints[column.Name]
+			if column.Primary || (!isForeign && !strings.HasSuffix(column.Name, "_id")) {
+				continue
+			}
+
+			base := strings.TrimSuffix(column.Name, "_id")
+			target, key := foreign.Table, foreign.Key
+			if _, has := models[target]; !isForeign || !has {
+				var has bool
+				target, has = guessTable(models, prefix, base)
+				if !has {
+					continue
+				}
+				key = primaryKey(models[target])
+			}
+
+			if key == "" {
+				continue
+			}
+
+			if _, has := models[name].Relations[base]; !has {
+				models[name].Relations[base] = types.Relation{
+					Type:     "hasOne",
+					Model:    target,
+					Key:      key,
+					Foreign:  column.Name,
+					OnDelete: types.ForeignAction(foreign.OnDelete),
+					OnUpdate: types.ForeignAction(foreign.OnUpdate),
+				}
+			}
+
+			rel := strings.TrimPrefix(name, prefix)
+			if _, has := models[target].Relations[rel]; has {
+				rel = fmt.Sprintf("%s_%s", rel, base)
+			}
+			models[target].Relations[rel] = types.Relation{
+				Type:     "hasMany",
+				Model:    name,
+				Key:      column.Name,
+				Foreign:  key,
+				OnDelete: types.ForeignAction(foreign.OnDelete),
+				OnUpdate: types.ForeignAction(foreign.OnUpdate),
+			}
+		}
+	}
+}
+
+// guessTable find the table the <base>_id column refers to. eg: user, users, erp_user
+func guessTable(models map[string]types.Model, prefix string, base string) (string, bool) {
+	candidates := []string{base, base + "s", base + "es"}
+	if strings.HasSuffix(base, "y") {
+		candidates = append(candidates, strings.TrimSuffix(base, "y")+"ies")
+	}
+
+	for _, candidate := range candidates {
+		if prefix != "" {
+			if _, has := models[prefix+candidate]; has {
+				return prefix + candidate, true
+			}
+		}
+		if _, has := models[candidate]; has {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// primaryKey get the single primary key of the model
+func primaryKey(model types.Model) string {
+	for _, column := range model.Columns {
+		if column.Primary || strings.ToLower(column.Type) == "id" {
+			return column.Name
+		}
+	}
+	return ""
+}
+
+func sortedModelNames(models map[string]types.Model) []string {
+	names := []string{}
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
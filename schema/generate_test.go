@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/fs/system"
+	"github.com/yaoapp/gou/schema/types"
+)
+
+func TestGenerate(t *testing.T) {
+	sch := newXunSchema(t)
+	defer sch.Close()
+
+	createGenerateTables(t, sch)
+	defer sch.TableDrop("schema_tests_gen_user")
+	defer sch.TableDrop("schema_tests_gen_pet")
+
+	models, err := Generate(sch, "schema_tests_gen_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, len(models))
+	user := models["schema_tests_gen_user"]
+	pet := models["schema_tests_gen_pet"]
+	assert.Equal(t, "schema_tests_gen_user", user.Table.Name)
+	assert.Equal(t, 3, len(pet.Columns))
+
+	assert.Equal(t, types.Relation{
+		Type:    "hasOne",
+		Model:   "schema_tests_gen_user",
+		Key:     "id",
+		Foreign: "user_id",
+	}, pet.Relations["user"])
+
+	assert.Equal(t, types.Relation{
+		Type:    "hasMany",
+		Model:   "schema_tests_gen_pet",
+		Key:     "user_id",
+		Foreign: "id",
+	}, user.Relations["pet"])
+}
+
+func TestWriteModels(t *testing.T) {
+	sch := newXunSchema(t)
+	defer sch.Close()
+
+	createGenerateTables(t, sch)
+	defer sch.TableDrop("schema_tests_gen_user")
+	defer sch.TableDrop("schema_tests_gen_pet")
+
+	models, err := Generate(sch, "schema_tests_gen_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	files, err := WriteModels(system.New(root), "models", models)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{
+		filepath.Join("models", "schema_tests_gen_pet.mod.yao"),
+		filepath.Join("models", "schema_tests_gen_user.mod.yao"),
+	}, files)
+
+	blueprint, err := types.NewFile(filepath.Join(root, "models", "schema_tests_gen_pet.mod.yao"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, len(blueprint.Columns))
+
+	_, err = os.Stat(filepath.Join(root, "models", "schema_tests_gen_user.mod.yao"))
+	assert.Nil(t, err)
+}
+
+func createGenerateTables(t *testing.T, sch types.Schema) {
+	sch.TableDrop("schema_tests_gen_user")
+	sch.TableDrop("schema_tests_gen_pet")
+
+	err := sch.TableCreate("schema_tests_gen_user", types.Blueprint{
+		Columns: []types.Column{
+			{Name: "id", Type: "ID"},
+			{Name: "name", Type: "string", Length: 80},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sch.TableCreate("schema_tests_gen_pet", types.Blueprint{
+		Columns: []types.Column{
+			{Name: "id", Type: "ID"},
+			{Name: "name", Type: "string", Length: 80},
+			{Name: "user_id", Type: "bigInteger", Index: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,10 +1,13 @@
 package schema
 
 import (
+	"github.com/yaoapp/gou/fs"
 	"github.com/yaoapp/gou/process"
 	"github.com/yaoapp/gou/schema/types"
+	"github.com/yaoapp/kun/any"
 	"github.com/yaoapp/kun/exception"
 	"github.com/yaoapp/kun/log"
+	"github.com/yaoapp/kun/maps"
 )
 
 // SchemaHandlers Processes
@@ -27,6 +30,13 @@ var SchemaHandlers = map[string]process.Handler{
 
 	"indexadd": processSchemaIndexAdd,
 	"indexdel": processSchemaIndexDel,
+
+	"foreignadd": processSchemaForeignAdd,
+	"foreigndel": processSchemaForeignDel,
+
+	"generate": processSchemaGenerate,
+	"snapshot": processSchemaSnapshot,
+	"compare":  processSchemaCompare,
 }
 
 func init() {
@@ -201,8 +211,9 @@ func processSchemaTableDiff(process *process.Process) interface{} {
 }
 
 // schemas.<connector>.TableSave
-// args: [tableName:String, blueprint:Blueprint]
+// args: [tableName:String, blueprint:Blueprint, option:Map<optional>]
 // TableSave Save a table, if the table exists update, otherwise create
+// option: {"strategy": "rebuild", "chunk_size": 1000}, rebuild the table via a shadow table when the columns are changed, SQLite rebuilds it by default to alter the columns
 func processSchemaTableSave(process *process.Process) interface{} {
 	process.ValidateArgNums(2)
 	sch := Use(process.ID)
@@ -213,7 +224,21 @@ func processSchemaTableSave(process *process.Process) interface{} {
 		exception.New(err.Error(), 500).Throw()
 		return nil
 	}
-	err = sch.TableSave(name, blueprint)
+
+	options := []types.ApplyOption{}
+	if process.NumOfArgsIs(3) {
+		option := process.ArgsMap(2, maps.MapStrAny{})
+		strategy, _ := option["strategy"].(string)
+		options = append(options, types.ApplyOption{
+			Strategy:  strategy,
+			ChunkSize: any.Of(option.Get("chunk_size")).CInt(),
+			Progress: func(copied, total int) {
+				log.Info("schemas.%s.TableSave: %s %d/%d rows copied", process.ID, name, copied, total)
+			},
+		})
+	}
+
+	err = sch.TableSave(name, blueprint, options...)
 	if err != nil {
 		log.Error("schemas.%s.TableSave: %s", process.ID, err.Error())
 		exception.New(err.Error(), 500).Throw()
@@ -322,3 +347,164 @@ func processSchemaIndexDel(process *process.Process) interface{} {
 	}
 	return nil
 }
+
+// schemas.<connector>.ForeignAdd
+// args: [tableName:String, foreign:Foreign]
+// ForeignAdd add a foreign key to the given table
+func processSchemaForeignAdd(process *process.Process) interface{} {
+	process.ValidateArgNums(2)
+	sch := Use(process.ID)
+	name := process.ArgsString(0)
+	foreign, err := types.NewForeignAny(process.Args[1])
+	if err != nil {
+		log.Error("schemas.%s.ForeignAdd: %s", process.ID, err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+
+	err = sch.ForeignAdd(name, foreign)
+	if err != nil {
+		log.Error("schemas.%s.ForeignAdd: %s", process.ID, err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+	return nil
+}
+
+// schemas.<connector>.ForeignDel
+// args: [tableName:String, foreignName:String]
+// ForeignDel delete a foreign key from the given table
+func processSchemaForeignDel(process *process.Process) interface{} {
+	process.ValidateArgNums(2)
+	sch := Use(process.ID)
+	name := process.ArgsString(0)
+	foreign := process.ArgsString(1)
+	err := sch.ForeignDel(name, foreign)
+	if err != nil {
+		log.Error("schemas.%s.ForeignDel: %s", process.ID, err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+	return nil
+}
+
+// schemas.<connector>.Generate
+// args: [dir:String, option:Map<optional>]
+// Generate the model DSL files from the tables, option: {"prefix": "erp_", "fs": "system"}
+func processSchemaGenerate(process *process.Process) interface{} {
+	process.ValidateArgNums(1)
+	sch := Use(process.ID)
+	dir := process.ArgsString(0)
+	option := process.ArgsMap(1, maps.MapStrAny{})
+	prefix, stor := filesOption(process, "Generate", option)
+
+	models, err := Generate(sch, prefix...)
+	if err != nil {
+		log.Error("schemas.%s.Generate: %s", process.ID, err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+
+	if process.ID != "default" {
+		for name, mod := range models {
+			mod.Connector = process.ID
+			models[name] = mod
+		}
+	}
+
+	files, err := WriteModels(stor, dir, models)
+	if err != nil {
+		log.Error("schemas.%s.Generate: %s", process.ID, err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+	return files
+}
+
+// schemas.<connector>.Snapshot
+// args: [file:String, option:Map<optional>]
+// Snapshot dump the blueprints of the tables to the snapshot file, option: {"prefix": "erp_", "fs": "system"}
+func processSchemaSnapshot(process *process.Process) interface{} {
+	process.ValidateArgNums(1)
+	file := process.ArgsString(0)
+	option := process.ArgsMap(1, maps.MapStrAny{})
+	sch := Use(process.ID)
+	prefix, stor := filesOption(process, "Snapshot", option)
+
+	snapshot, err := Dump(sch, prefix...)
+	if err != nil {
+		log.Error("schemas.%s.Snapshot: %s", process.ID, err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+	snapshot.Connector = process.ID
+
+	err = SaveSnapshot(stor, file, snapshot)
+	if err != nil {
+		log.Error("schemas.%s.Snapshot: %s", process.ID, err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+	return file
+}
+
+// schemas.<connector>.Compare
+// args: [target:String, option:Map<optional>]
+// Compare the tables with another connector or a snapshot file, return the changes to make the connector same as the target
+// option: {"prefix": "erp_", "fs": "system", "snapshot": true}, the target is the snapshot file if the snapshot option is true
+func processSchemaCompare(process *process.Process) interface{} {
+	process.ValidateArgNums(1)
+	target := process.ArgsString(0)
+	option := process.ArgsMap(1, maps.MapStrAny{})
+	sch := Use(process.ID)
+	prefix, stor := filesOption(process, "Compare", option)
+
+	source, err := Dump(sch, prefix...)
+	if err != nil {
+		log.Error("schemas.%s.Compare: %s", process.ID, err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+
+	var another types.Snapshot
+	if isSnapshot, _ := option["snapshot"].(bool); isSnapshot {
+		another, err = LoadSnapshot(stor, target)
+	} else {
+		another, err = Dump(Use(target), prefix...)
+	}
+
+	if err != nil {
+		log.Error("schemas.%s.Compare: %s", process.ID, err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+
+	report, err := CompareSnapshots(source, another)
+	if err != nil {
+		log.Error("schemas.%s.Compare: %s", process.ID, err.Error())
+		exception.New(err.Error(), 500).Throw()
+		return nil
+	}
+	return report
+}
+
+// filesOption the table prefix and the file system of the option, {"prefix": "erp_", "fs": "system"}
+func filesOption(process *process.Process, method string, option map[string]interface{}) ([]string, fs.FileSystem) {
+	prefix := []string{}
+	if v, ok := option["prefix"].(string); ok && v != "" {
+		prefix = append(prefix, v)
+	}
+
+	name := "system"
+	if v, ok := option["fs"].(string); ok && v != "" {
+		name = v
+	}
+
+	stor, err := fs.Get(name)
+	if err != nil {
+		log.Error("schemas.%s.%s: %s", process.ID, method, err.Error())
+		exception.New(err.Error(), 400).Throw()
+		return nil, nil
+	}
+	return prefix, stor
+}
@@ -149,3 +149,24 @@ func prepareData(t *testing.T) map[string]interface{} {
 	}
 	return data
 }
+
+func TestSchemaProcessesConnector(t *testing.T) {
+	_, err := Select("unit_not_loaded")
+	assert.NotNil(t, err)
+
+	_, err = process.New("schemas.unit_not_loaded.Tables").Exec()
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "404")
+	}
+
+	// the connectors of the snapshots are resolved in the same way
+	_, err = process.New("schemas.unit_not_loaded.Snapshot", "snapshot.json").Exec()
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "404")
+	}
+
+	_, err = process.New("schemas.unit_not_loaded.Compare", "default").Exec()
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "404")
+	}
+}
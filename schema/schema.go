@@ -1,8 +1,13 @@
 package schema
 
 import (
+	"fmt"
+
+	"github.com/yaoapp/gou/connector"
+	"github.com/yaoapp/gou/connector/database"
 	"github.com/yaoapp/gou/schema/types"
 	"github.com/yaoapp/gou/schema/xun"
+	"github.com/yaoapp/kun/exception"
 	"github.com/yaoapp/xun/capsule"
 )
 
@@ -10,14 +15,43 @@ import (
  * Schema helpers and processes
  */
 
-// Use pick a schema driver
+// Use pick a schema driver via the connector name, the default connection if the name is empty or default.
+// it throws an exception if the connector does not exist (404) or is not a connected database (400)
 func Use(name string) types.Schema {
-	switch name {
-	case "tests":
-		return &xun.Xun{}
-	default:
+	sch, err := Select(name)
+	if err != nil {
+		code := 400
+		if _, has := connector.Connectors[name]; !has {
+			code = 404
+		}
+		exception.New(err.Error(), code).Throw()
+	}
+	return sch
+}
+
+// Select pick a schema driver via the connector name, the default connection if the name is empty or default
+func Select(name string) (types.Schema, error) {
+	if name == "" || name == "default" {
 		return &xun.Xun{
 			Option: xun.Option{Manager: capsule.Global},
-		}
+		}, nil
 	}
+
+	c, err := connector.Select(name)
+	if err != nil {
+		return nil, err
+	}
+
+	db, ok := c.(*database.Xun)
+	if !ok || !c.Is(connector.DATABASE) {
+		return nil, fmt.Errorf("connector %s is not a database connector", name)
+	}
+
+	if db.Manager == nil {
+		return nil, fmt.Errorf("connector %s does not connected", name)
+	}
+
+	return &xun.Xun{
+		Option: xun.Option{Manager: db.Manager},
+	}, nil
 }
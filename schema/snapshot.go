@@ -0,0 +1,118 @@
+package schema
+
+import (
+	"sort"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/yaoapp/gou/fs"
+	"github.com/yaoapp/gou/schema/types"
+)
+
+// Dump the blueprints of the tables to a snapshot, filter the tables by the given prefix (optional)
+func Dump(sch types.Schema, prefix ...string) (types.Snapshot, error) {
+	tables, err := sch.Tables(prefix...)
+	if err != nil {
+		return types.Snapshot{}, err
+	}
+
+	snapshot := types.Snapshot{
+		CreatedAt: time.Now().Format(time.RFC3339),
+		Tables:    map[string]types.Blueprint{},
+	}
+
+	if len(prefix) > 0 {
+		snapshot.Prefix = prefix[0]
+	}
+
+	for _, name := range tables {
+		blueprint, err := sch.TableGet(name)
+		if err != nil {
+			return types.Snapshot{}, err
+		}
+		snapshot.Tables[name] = blueprint
+	}
+	return snapshot, nil
+}
+
+// SaveSnapshot write the snapshot file to the given filesystem
+func SaveSnapshot(stor fs.FileSystem, file string, snapshot types.Snapshot) error {
+	data, err := jsoniter.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fs.WriteFile(stor, file, data, 0644)
+	return err
+}
+
+// LoadSnapshot read the snapshot file from the given filesystem
+func LoadSnapshot(stor fs.FileSystem, file string) (types.Snapshot, error) {
+	data, err := fs.ReadFile(stor, file)
+	if err != nil {
+		return types.Snapshot{}, err
+	}
+
+	snapshot := types.Snapshot{}
+	err = jsoniter.Unmarshal(data, &snapshot)
+	if err != nil {
+		return types.Snapshot{}, err
+	}
+
+	if snapshot.Tables == nil {
+		snapshot.Tables = map[string]types.Blueprint{}
+	}
+	return snapshot, nil
+}
+
+// CompareSnapshots compare the two snapshots, the report is the changes to make the source same as the target
+func CompareSnapshots(source, target types.Snapshot) (types.Report, error) {
+	report := types.Report{Add: []string{}, Del: []string{}, Alt: map[string]types.TableReport{}}
+
+	for _, name := range sortedTableNames(source.Tables) {
+		if _, has := target.Tables[name]; !has {
+			report.Del = append(report.Del, name)
+		}
+	}
+
+	for _, name := range sortedTableNames(target.Tables) {
+		blueprint, has := source.Tables[name]
+		if !has {
+			report.Add = append(report.Add, name)
+			continue
+		}
+
+		diff, err := types.Compare(blueprint, target.Tables[name])
+		if err != nil {
+			return report, err
+		}
+
+		table := types.TableReport{
+			AddColumns:  diff.Columns.Add,
+			AltColumns:  diff.Columns.Alt,
+			DelColumns:  diff.Columns.Del,
+			AddIndexes:  diff.Indexes.Add,
+			AltIndexes:  diff.Indexes.Alt,
+			DelIndexes:  diff.Indexes.Del,
+			AddForeigns: diff.Foreigns.Add,
+			DelForeigns: diff.Foreigns.Del,
+			Option:      diff.Option,
+		}
+
+		if len(table.AddColumns)+len(table.AltColumns)+len(table.DelColumns)+
+			len(table.AddIndexes)+len(table.AltIndexes)+len(table.DelIndexes)+
+			len(table.AddForeigns)+len(table.DelForeigns)+len(table.Option) > 0 {
+			report.Alt[name] = table
+		}
+	}
+
+	return report, nil
+}
+
+func sortedTableNames(tables map[string]types.Blueprint) []string {
+	names := []string{}
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
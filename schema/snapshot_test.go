@@ -0,0 +1,126 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/fs/system"
+	"github.com/yaoapp/gou/schema/types"
+)
+
+func TestSnapshot(t *testing.T) {
+	sch := newXunSchema(t)
+	defer sch.Close()
+
+	createGenerateTables(t, sch)
+	defer sch.TableDrop("schema_tests_gen_user")
+	defer sch.TableDrop("schema_tests_gen_pet")
+
+	snapshot, err := Dump(sch, "schema_tests_gen_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(snapshot.Tables))
+	assert.Equal(t, "schema_tests_gen_", snapshot.Prefix)
+
+	stor := system.New(t.TempDir())
+	err = SaveSnapshot(stor, "snapshot.json", snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := LoadSnapshot(stor, "snapshot.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, len(saved.Tables["schema_tests_gen_pet"].Columns))
+
+	report, err := CompareSnapshots(saved, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, report.Add)
+	assert.Empty(t, report.Del)
+	assert.Empty(t, report.Alt)
+}
+
+func TestCompareSnapshots(t *testing.T) {
+	sch := newXunSchema(t)
+	defer sch.Close()
+
+	createGenerateTables(t, sch)
+	defer sch.TableDrop("schema_tests_gen_user")
+	defer sch.TableDrop("schema_tests_gen_pet")
+
+	source, err := Dump(sch, "schema_tests_gen_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sch.ColumnAdd("schema_tests_gen_user", types.Column{Name: "mobile", Type: "string", Length: 20, Nullable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sch.TableCreate("schema_tests_gen_car", types.Blueprint{Columns: []types.Column{{Name: "id", Type: "ID"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sch.TableDrop("schema_tests_gen_car")
+
+	err = sch.TableDrop("schema_tests_gen_pet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := Dump(sch, "schema_tests_gen_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CompareSnapshots(source, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"schema_tests_gen_car"}, report.Add)
+	assert.Equal(t, []string{"schema_tests_gen_pet"}, report.Del)
+	assert.Equal(t, 1, len(report.Alt))
+	assert.Equal(t, "mobile", report.Alt["schema_tests_gen_user"].AddColumns[0].Name)
+}
+
+func TestCompareSnapshotsForeigns(t *testing.T) {
+	sch := newXunSchema(t)
+	defer sch.Close()
+
+	createGenerateTables(t, sch)
+	defer sch.TableDrop("schema_tests_gen_user")
+	defer sch.TableDrop("schema_tests_gen_pet")
+
+	source, err := Dump(sch, "schema_tests_gen_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sch.ForeignAdd("schema_tests_gen_pet", types.Foreign{Name: "schema_tests_gen_pet_user_id_foreign", Column: "user_id", Table: "schema_tests_gen_user", Key: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := Dump(sch, "schema_tests_gen_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CompareSnapshots(source, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(report.Alt))
+	assert.Equal(t, 1, len(report.Alt["schema_tests_gen_pet"].AddForeigns))
+
+	report, err = CompareSnapshots(target, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(report.Alt["schema_tests_gen_pet"].DelForeigns))
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	jsoniter "github.com/json-iterator/go"
 )
@@ -68,6 +69,17 @@ func NewIndexAny(data interface{}) (Index, error) {
 	return index, err
 }
 
+// NewForeignAny create a foreign key of Blueprint
+func NewForeignAny(data interface{}) (Foreign, error) {
+	foreign := Foreign{}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return Foreign{}, err
+	}
+	err = jsoniter.Unmarshal(bytes, &foreign)
+	return foreign, err
+}
+
 // NewDiff create a new Diff
 func NewDiff() Diff {
 	diff := Diff{}
@@ -77,6 +89,8 @@ func NewDiff() Diff {
 	diff.Indexes.Add = []Index{}
 	diff.Indexes.Del = []Index{}
 	diff.Indexes.Alt = []Index{}
+	diff.Foreigns.Add = []Foreign{}
+	diff.Foreigns.Del = []Foreign{}
 	diff.Option = map[string]bool{}
 	return diff
 }
@@ -101,6 +115,32 @@ func (blueprint Blueprint) IndexesMapping() map[string]Index {
 	return mapping
 }
 
+// ForeignsMapping get the mapping of foreign keys
+func (blueprint Blueprint) ForeignsMapping() map[string]Foreign {
+	mapping := map[string]Foreign{}
+	for _, foreign := range blueprint.Foreigns {
+		mapping[foreign.Name] = foreign
+	}
+	return mapping
+}
+
+// ManagedForeigns get the foreign keys of the live table managed by the given blueprint,
+// the ones named <table>_<column>_foreign if the blueprint opts into the constraints.
+// the foreign keys made by hand are never changed
+func (blueprint Blueprint) ManagedForeigns(another Blueprint) []Foreign {
+	foreigns := []Foreign{}
+	if !another.Option.Constraints {
+		return foreigns
+	}
+
+	for _, foreign := range blueprint.Foreigns {
+		if strings.HasSuffix(foreign.Name, "_foreign") {
+			foreigns = append(foreigns, foreign)
+		}
+	}
+	return foreigns
+}
+
 // Hash get the column hash
 func (column Column) Hash() string {
 	switch column.Type {
@@ -119,6 +159,24 @@ func (index Index) Hash() string {
 	return hash(unique)
 }
 
+// Hash get the foreign key hash
+func (foreign Foreign) Hash() string {
+	unique := fmt.Sprintf("%v|%v|%v|%v|%v",
+		foreign.Column, foreign.Table, foreign.Key,
+		ForeignAction(foreign.OnDelete), ForeignAction(foreign.OnUpdate),
+	)
+	return hash(unique)
+}
+
+// ForeignAction normalize the on delete/update action, RESTRICT and NO ACTION are the default
+func ForeignAction(action string) string {
+	action = strings.ToUpper(strings.TrimSpace(action))
+	if action == "RESTRICT" || action == "NO ACTION" {
+		return ""
+	}
+	return action
+}
+
 func hash(s string) string {
 	h := md5.New()
 	return string(h.Sum([]byte(s)))
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 )
@@ -10,12 +11,34 @@ func Compare(blueprint, another Blueprint) (Diff, error) {
 	diff := NewDiff()
 	diff.ColumnsDiff(blueprint, another)
 	diff.IndexesDiff(blueprint, another)
+	diff.ForeignsDiff(blueprint, another)
 	diff.OptionDiff(blueprint, another)
 	return diff, nil
 }
 
-// Apply apply the changes
-func (diff Diff) Apply(sch Schema, name string) error {
+// Apply apply the changes, the table will be rebuilt if the strategy option is rebuild and the columns are changed
+func (diff Diff) Apply(sch Schema, name string, option ...ApplyOption) error {
+
+	if len(option) > 0 && option[0].Strategy == "rebuild" &&
+		len(diff.Columns.Add)+len(diff.Columns.Alt)+len(diff.Columns.Del) > 0 {
+		current, err := sch.TableGet(name)
+		if err != nil {
+			return err
+		}
+		return sch.TableRebuild(name, diff.Patch(current), option[0])
+	}
+
+	// Foreigns Del (before the columns changing)
+	deletes := []string{}
+	for _, foreign := range diff.Foreigns.Del {
+		deletes = append(deletes, foreign.Name)
+	}
+	if len(deletes) > 0 {
+		err := sch.ForeignDel(name, deletes...)
+		if err != nil {
+			return err
+		}
+	}
 
 	// columns Add
 	for _, column := range diff.Columns.Add {
@@ -34,7 +57,7 @@ func (diff Diff) Apply(sch Schema, name string) error {
 	}
 
 	// columns Del
-	deletes := []string{}
+	deletes = []string{}
 	for _, column := range diff.Columns.Del {
 		deletes = append(deletes, column.Name)
 	}
@@ -66,9 +89,107 @@ func (diff Diff) Apply(sch Schema, name string) error {
 		}
 	}
 
+	// Foreigns Add
+	for _, foreign := range diff.Foreigns.Add {
+		err := sch.ForeignAdd(name, foreign)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// Patch apply the changes to the blueprint, return the changed blueprint.
+// the deleted columns are renamed to __DEL__<name> as same as the ColumnDel does
+func (diff Diff) Patch(blueprint Blueprint) Blueprint {
+	result := Blueprint{Columns: []Column{}, Indexes: []Index{}, Foreigns: []Foreign{}, Option: blueprint.Option}
+
+	// Columns
+	alters := map[string]Column{}
+	for _, column := range diff.Columns.Alt {
+		alters[column.Name] = column
+	}
+
+	deletes := map[string]bool{}
+	for _, column := range diff.Columns.Del {
+		deletes[column.Name] = true
+	}
+
+	for _, column := range blueprint.Columns {
+		if deletes[column.Name] {
+			column.Name = fmt.Sprintf("__DEL__%s", column.Name)
+			column.Nullable = true
+			column.Index = false
+			column.Unique = false
+			column.Primary = false
+			result.Columns = append(result.Columns, column)
+			continue
+		}
+
+		if alter, has := alters[column.Name]; has {
+			column = alter
+		}
+		result.Columns = append(result.Columns, column)
+	}
+	result.Columns = append(result.Columns, diff.Columns.Add...)
+
+	// Indexes
+	deletes = map[string]bool{}
+	for _, index := range diff.Indexes.Del {
+		deletes[index.Name] = true
+	}
+
+	for _, index := range blueprint.Indexes {
+		if !deletes[index.Name] {
+			result.Indexes = append(result.Indexes, index)
+		}
+	}
+	result.Indexes = append(result.Indexes, diff.Indexes.Add...)
+
+	// Foreigns
+	deletes = map[string]bool{}
+	for _, foreign := range diff.Foreigns.Del {
+		deletes[foreign.Name] = true
+	}
+
+	for _, foreign := range blueprint.Foreigns {
+		if !deletes[foreign.Name] {
+			result.Foreigns = append(result.Foreigns, foreign)
+		}
+	}
+	result.Foreigns = append(result.Foreigns, diff.Foreigns.Add...)
+
+	// Option
+	if v, has := diff.Option["soft_deletes"]; has {
+		result.Option.SoftDeletes = v
+	}
+
+	if v, has := diff.Option["timestamps"]; has {
+		result.Option.Timestamps = v
+	}
+
+	return result
+}
+
+// ForeignsDiff find the foreign key difference
+// filter the foreign keys of the live table with ManagedForeigns before applying the difference
+func (diff *Diff) ForeignsDiff(blueprint, another Blueprint) {
+	mapping := blueprint.ForeignsMapping()
+	mappingAnother := another.ForeignsMapping()
+	for _, foreign := range blueprint.Foreigns {
+		if origin, has := mappingAnother[foreign.Name]; !has || origin.Hash() != foreign.Hash() {
+			diff.Foreigns.Del = append(diff.Foreigns.Del, foreign)
+		}
+	}
+
+	for _, foreign := range another.Foreigns {
+		if origin, has := mapping[foreign.Name]; !has || origin.Hash() != foreign.Hash() {
+			diff.Foreigns.Add = append(diff.Foreigns.Add, foreign)
+		}
+	}
+}
+
 // OptionDiff find the option difference
 func (diff *Diff) OptionDiff(blueprint, another Blueprint) {
 	if blueprint.Option.SoftDeletes != another.Option.SoftDeletes {
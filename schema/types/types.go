@@ -12,7 +12,8 @@ type Schema interface {
 	TableExists(name string) (bool, error)
 	TableGet(name string) (Blueprint, error)
 	TableCreate(name string, blueprint Blueprint) error
-	TableSave(name string, blueprint Blueprint) error
+	TableSave(name string, blueprint Blueprint, option ...ApplyOption) error
+	TableRebuild(name string, blueprint Blueprint, option ApplyOption) error
 	TableDrop(name string) error
 	TableRename(name string, new string) error
 	TableDiff(name Blueprint, another Blueprint) (Diff, error)
@@ -24,6 +25,9 @@ type Schema interface {
 	IndexAdd(name string, index Index) error
 	IndexAlt(name string, index Index) error
 	IndexDel(name string, indexes ...string) error
+
+	ForeignAdd(name string, foreign Foreign) error
+	ForeignDel(name string, foreigns ...string) error
 }
 
 // Diff the different of schema
@@ -38,14 +42,26 @@ type Diff struct {
 		Del []Index
 		Alt []Index
 	}
+	Foreigns struct {
+		Add []Foreign
+		Del []Foreign
+	}
 	Option map[string]bool
 }
 
+// ApplyOption the option of applying the changes
+type ApplyOption struct {
+	Strategy  string                  `json:"strategy,omitempty"`   // alter (default), rebuild: copy the rows to a shadow table then swap the names, SQLite rebuilds by default to alter the columns
+	ChunkSize int                     `json:"chunk_size,omitempty"` // the rows of each copying chunk for the rebuild strategy, default 1000
+	Progress  func(copied, total int) `json:"-"`                    // the copying progress callback for the rebuild strategy
+}
+
 // Blueprint the blueprint of schema
 type Blueprint struct {
-	Columns []Column        `json:"columns,omitempty"`
-	Indexes []Index         `json:"indexes,omitempty"`
-	Option  BlueprintOption `json:"option,omitempty"`
+	Columns  []Column        `json:"columns,omitempty"`
+	Indexes  []Index         `json:"indexes,omitempty"`
+	Foreigns []Foreign       `json:"foreigns,omitempty"`
+	Option   BlueprintOption `json:"option,omitempty"`
 }
 
 // BlueprintOption the blueprint option
@@ -93,3 +109,68 @@ type Index struct {
 	Type    string   `json:"type,omitempty"` // primary,unique,index,match
 	Origin  string   `json:"origin,omitempty"`
 }
+
+// Foreign the foreign key constraint
+type Foreign struct {
+	Name     string `json:"name,omitempty"`
+	Column   string `json:"column"`
+	Table    string `json:"table"`               // the referenced table
+	Key      string `json:"key"`                 // the referenced column
+	OnDelete string `json:"on_delete,omitempty"` // CASCADE, SET NULL, SET DEFAULT, RESTRICT, NO ACTION
+	OnUpdate string `json:"on_update,omitempty"` // CASCADE, SET NULL, SET DEFAULT, RESTRICT, NO ACTION
+}
+
+// Model the model DSL generated from the table blueprint
+type Model struct {
+	Name      string              `json:"name,omitempty"`
+	Connector string              `json:"connector,omitempty"`
+	Table     ModelTable          `json:"table"`
+	Columns   []Column            `json:"columns,omitempty"`
+	Indexes   []Index             `json:"indexes,omitempty"`
+	Relations map[string]Relation `json:"relations,omitempty"`
+	Option    BlueprintOption     `json:"option,omitempty"`
+}
+
+// ModelTable the table section of the model DSL
+type ModelTable struct {
+	Name    string `json:"name"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// Relation the model relation
+type Relation struct {
+	Type     string `json:"type"`
+	Key      string `json:"key,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Foreign  string `json:"foreign,omitempty"`
+	OnDelete string `json:"on_delete,omitempty"`
+	OnUpdate string `json:"on_update,omitempty"`
+}
+
+// Snapshot the blueprints of all the tables of a connector
+type Snapshot struct {
+	Connector string               `json:"connector,omitempty"`
+	Prefix    string               `json:"prefix,omitempty"`
+	CreatedAt string               `json:"created_at,omitempty"`
+	Tables    map[string]Blueprint `json:"tables"`
+}
+
+// Report the difference between two snapshots
+type Report struct {
+	Add []string               `json:"add"` // the tables only in the target
+	Del []string               `json:"del"` // the tables only in the source
+	Alt map[string]TableReport `json:"alt"` // the tables changed
+}
+
+// TableReport the difference of a table
+type TableReport struct {
+	AddColumns  []Column        `json:"add_columns,omitempty"`
+	AltColumns  []Column        `json:"alt_columns,omitempty"`
+	DelColumns  []Column        `json:"del_columns,omitempty"`
+	AddIndexes  []Index         `json:"add_indexes,omitempty"`
+	AltIndexes  []Index         `json:"alt_indexes,omitempty"`
+	DelIndexes  []Index         `json:"del_indexes,omitempty"`
+	AddForeigns []Foreign       `json:"add_foreigns,omitempty"`
+	DelForeigns []Foreign       `json:"del_foreigns,omitempty"`
+	Option      map[string]bool `json:"option,omitempty"`
+}
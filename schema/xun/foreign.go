@@ -0,0 +1,263 @@
+package xun
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/yaoapp/gou/schema/types"
+)
+
+var reSQLiteForeign = regexp.MustCompile("(?i),?\\s*CONSTRAINT\\s+[\"`]?(\\w+)[\"`]?\\s+FOREIGN\\s+KEY\\s*\\(\\s*[\"`]?(\\w+)[\"`]?\\s*\\)\\s*REFERENCES\\s+[\"`]?(\\w+)[\"`]?\\s*\\(\\s*[\"`]?(\\w+)[\"`]?\\s*\\)((?:\\s+ON\\s+(?:DELETE|UPDATE)\\s+(?:SET\\s+NULL|SET\\s+DEFAULT|NO\\s+ACTION|CASCADE|RESTRICT))*)")
+var reSQLiteAction = regexp.MustCompile("(?i)ON\\s+(DELETE|UPDATE)\\s+(SET\\s+NULL|SET\\s+DEFAULT|NO\\s+ACTION|CASCADE|RESTRICT)")
+var reSQLiteCreate = regexp.MustCompile("(?i)^\\s*CREATE\\s+TABLE\\s+[\"`]?\\w+[\"`]?")
+
+// ForeignAdd add a foreign key to the given table
+func (x *Xun) ForeignAdd(name string, foreign types.Foreign) error {
+	if foreign.Column == "" || foreign.Table == "" || foreign.Key == "" {
+		return fmt.Errorf("foreign key %s missing column, table or key", foreign.Name)
+	}
+
+	if foreign.Name == "" {
+		foreign.Name = fmt.Sprintf("%s_%s_foreign", name, foreign.Column)
+	}
+
+	m, err := x.Manager.Primary()
+	if err != nil {
+		return err
+	}
+
+	table := x.Manager.Option.Prefix + name
+	switch m.Config.Driver {
+	case "mysql":
+		_, err = m.DB.Exec(fmt.Sprintf("ALTER TABLE `%s` ADD %s", table, foreignSQL(foreign, x.Manager.Option.Prefix, "`")))
+		return err
+
+	case "postgres":
+		_, err = m.DB.Exec(fmt.Sprintf(`ALTER TABLE "%s" ADD %s`, table, foreignSQL(foreign, x.Manager.Option.Prefix, `"`)))
+		return err
+
+	case "sqlite3":
+		return sqliteRebuild(&m.DB, table, func(sql string) string {
+			pos := strings.LastIndex(sql, ")")
+			return sql[:pos] + ", " + foreignSQL(foreign, x.Manager.Option.Prefix, `"`) + sql[pos:]
+		})
+	}
+
+	return fmt.Errorf("the driver %s does not support foreign keys", m.Config.Driver)
+}
+
+// ForeignDel delete the foreign keys from the given table
+func (x *Xun) ForeignDel(name string, foreigns ...string) error {
+	if len(foreigns) == 0 {
+		return fmt.Errorf("missing foreigns")
+	}
+
+	m, err := x.Manager.Primary()
+	if err != nil {
+		return err
+	}
+
+	table := x.Manager.Option.Prefix + name
+	switch m.Config.Driver {
+	case "mysql":
+		for _, foreign := range foreigns {
+			_, err = m.DB.Exec(fmt.Sprintf("ALTER TABLE `%s` DROP FOREIGN KEY `%s`", table, foreign))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "postgres":
+		for _, foreign := range foreigns {
+			_, err = m.DB.Exec(fmt.Sprintf(`ALTER TABLE "%s" DROP CONSTRAINT "%s"`, table, foreign))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "sqlite3":
+		deletes := map[string]bool{}
+		for _, foreign := range foreigns {
+			deletes[strings.ToLower(foreign)] = true
+		}
+		return sqliteRebuild(&m.DB, table, func(sql string) string {
+			return reSQLiteForeign.ReplaceAllStringFunc(sql, func(constraint string) string {
+				match := reSQLiteForeign.FindStringSubmatch(constraint)
+				if deletes[strings.ToLower(match[1])] {
+					return ""
+				}
+				return constraint
+			})
+		})
+	}
+
+	return fmt.Errorf("the driver %s does not support foreign keys", m.Config.Driver)
+}
+
+// foreignsGet get the foreign keys of the given table
+func (x *Xun) foreignsGet(name string) ([]types.Foreign, error) {
+	m, err := x.Manager.Primary()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := x.Manager.Option.Prefix
+	table := prefix + name
+	foreigns := []types.Foreign{}
+	rows := []struct {
+		Name     string `db:"name"`
+		Column   string `db:"column_name"`
+		Table    string `db:"table_name"`
+		Key      string `db:"key_name"`
+		OnDelete string `db:"on_delete"`
+		OnUpdate string `db:"on_update"`
+	}{}
+
+	switch m.Config.Driver {
+	case "mysql":
+		err = m.DB.Select(&rows, "SELECT "+
+			"k.CONSTRAINT_NAME AS name, k.COLUMN_NAME AS column_name, "+
+			"k.REFERENCED_TABLE_NAME AS table_name, k.REFERENCED_COLUMN_NAME AS key_name, "+
+			"r.DELETE_RULE AS on_delete, r.UPDATE_RULE AS on_update "+
+			"FROM information_schema.KEY_COLUMN_USAGE k "+
+			"JOIN information_schema.REFERENTIAL_CONSTRAINTS r "+
+			"ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME "+
+			"WHERE k.TABLE_SCHEMA = DATABASE() AND k.TABLE_NAME = ? AND k.REFERENCED_TABLE_NAME IS NOT NULL "+
+			"ORDER BY k.CONSTRAINT_NAME", table)
+
+	case "postgres":
+		err = m.DB.Select(&rows, "SELECT "+
+			"tc.constraint_name AS name, kcu.column_name AS column_name, "+
+			"ccu.table_name AS table_name, ccu.column_name AS key_name, "+
+			"rc.delete_rule AS on_delete, rc.update_rule AS on_update "+
+			"FROM information_schema.table_constraints tc "+
+			"JOIN information_schema.key_column_usage kcu "+
+			"ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema "+
+			"JOIN information_schema.constraint_column_usage ccu "+
+			"ON ccu.constraint_name = tc.constraint_name AND ccu.table_schema = tc.table_schema "+
+			"JOIN information_schema.referential_constraints rc "+
+			"ON rc.constraint_name = tc.constraint_name AND rc.constraint_schema = tc.table_schema "+
+			"WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_name = $1 AND tc.table_schema = current_schema() "+
+			"ORDER BY tc.constraint_name", table)
+
+	case "sqlite3":
+		// only the named constraints (CONSTRAINT <name> FOREIGN KEY ...) are supported
+		sql := ""
+		err = m.DB.Get(&sql, "SELECT sql FROM sqlite_master WHERE type='table' AND name=?", table)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range reSQLiteForeign.FindAllStringSubmatch(sql, -1) {
+			foreign := types.Foreign{Name: match[1], Column: match[2], Table: strings.TrimPrefix(match[3], prefix), Key: match[4]}
+			for _, action := range reSQLiteAction.FindAllStringSubmatch(match[5], -1) {
+				if strings.ToUpper(action[1]) == "DELETE" {
+					foreign.OnDelete = strings.ToUpper(action[2])
+					continue
+				}
+				foreign.OnUpdate = strings.ToUpper(action[2])
+			}
+			foreigns = append(foreigns, foreign)
+		}
+		return foreigns, nil
+
+	default:
+		return foreigns, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		foreigns = append(foreigns, types.Foreign{
+			Name:     row.Name,
+			Column:   row.Column,
+			Table:    strings.TrimPrefix(row.Table, prefix),
+			Key:      row.Key,
+			OnDelete: row.OnDelete,
+			OnUpdate: row.OnUpdate,
+		})
+	}
+	return foreigns, nil
+}
+
+func foreignSQL(foreign types.Foreign, prefix string, quote string) string {
+	sql := fmt.Sprintf("CONSTRAINT %s%s%s FOREIGN KEY (%s%s%s) REFERENCES %s%s%s (%s%s%s)",
+		quote, foreign.Name, quote,
+		quote, foreign.Column, quote,
+		quote, prefix+foreign.Table, quote,
+		quote, foreign.Key, quote,
+	)
+
+	if action := types.ForeignAction(foreign.OnDelete); action != "" {
+		sql = fmt.Sprintf("%s ON DELETE %s", sql, action)
+	}
+
+	if action := types.ForeignAction(foreign.OnUpdate); action != "" {
+		sql = fmt.Sprintf("%s ON UPDATE %s", sql, action)
+	}
+	return sql
+}
+
+// sqliteRebuild rebuild the table with the modified create statement.
+// SQLite does not support altering the constraints, see https://www.sqlite.org/lang_altertable.html
+func sqliteRebuild(db *sqlx.DB, table string, modify func(sql string) string) error {
+	ctx := context.Background()
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	sql := ""
+	err = conn.GetContext(ctx, &sql, "SELECT sql FROM sqlite_master WHERE type='table' AND name=?", table)
+	if err != nil {
+		return err
+	}
+
+	indexes := []string{}
+	err = conn.SelectContext(ctx, &indexes, "SELECT sql FROM sqlite_master WHERE type='index' AND tbl_name=? AND sql IS NOT NULL", table)
+	if err != nil {
+		return err
+	}
+
+	enabled := 0
+	err = conn.GetContext(ctx, &enabled, "PRAGMA foreign_keys")
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, fmt.Sprintf("PRAGMA foreign_keys = %d", enabled))
+
+	tmp := fmt.Sprintf("__rebuild_%s", table)
+	stmts := []string{
+		modify(reSQLiteCreate.ReplaceAllString(sql, fmt.Sprintf(`CREATE TABLE "%s"`, tmp))),
+		fmt.Sprintf(`INSERT INTO "%s" SELECT * FROM "%s"`, tmp, table),
+		fmt.Sprintf(`DROP TABLE "%s"`, table),
+		fmt.Sprintf(`ALTER TABLE "%s" RENAME TO "%s"`, tmp, table),
+	}
+	stmts = append(stmts, indexes...)
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range stmts {
+		_, err = tx.ExecContext(ctx, stmt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,512 @@
+package xun
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/yaoapp/gou/schema/types"
+	"github.com/yaoapp/kun/log"
+	"github.com/yaoapp/xun/capsule"
+)
+
+// TableRebuild rebuild the table with the given blueprint.
+// create a shadow table with the indexes and foreign keys, copy the rows in chunks by the primary key,
+// copy the rows changed during the copying again, then swap the table names with the writes locked.
+// the foreign keys of the other tables are repointed to the new table, the backup table is dropped after all succeeded.
+// the rows updated during the copying are found by the updated_at column only, stop writing the tables without timestamps.
+// MySQL requires 8.0.13+ to rename the locked tables.
+func (x *Xun) TableRebuild(name string, blueprint types.Blueprint, option types.ApplyOption) error {
+	m, err := x.Manager.Primary()
+	if err != nil {
+		return err
+	}
+
+	if option.ChunkSize <= 0 {
+		option.ChunkSize = 1000
+	}
+
+	shadow := fmt.Sprintf("__shadow_%s", name)
+	backup := fmt.Sprintf("__backup_%s", name)
+
+	// The names of the indexes, the column indexes are named by the column
+	indexes := []string{}
+	for _, index := range blueprint.Indexes {
+		indexes = append(indexes, index.Name)
+	}
+	for _, column := range blueprint.Columns {
+		if column.Index {
+			indexes = append(indexes, fmt.Sprintf("%s_index", column.Name))
+		}
+		if column.Unique {
+			indexes = append(indexes, fmt.Sprintf("%s_unique", column.Name))
+		}
+	}
+
+	// The foreign keys are named by the table, the names of MySQL are unique in the database,
+	// they are added after the backup ones dropped. the self-referencing ones are added after the swap
+	foreigns := []types.Foreign{}
+	swapped := []types.Foreign{}
+	for _, foreign := range blueprint.Foreigns {
+		if foreign.Name == "" {
+			foreign.Name = fmt.Sprintf("%s_%s_foreign", name, foreign.Column)
+		}
+		if m.Config.Driver == "mysql" || foreign.Table == name {
+			swapped = append(swapped, foreign)
+			continue
+		}
+		foreigns = append(foreigns, foreign)
+	}
+
+	err = x.TableDrop(shadow)
+	if err != nil {
+		return err
+	}
+
+	err = x.TableCreate(shadow, types.Blueprint{Columns: blueprint.Columns, Indexes: blueprint.Indexes, Foreigns: foreigns, Option: blueprint.Option})
+	if err != nil {
+		x.TableDrop(shadow)
+		return err
+	}
+
+	// The auto-increment columns
+	serials := []string{}
+	for _, column := range blueprint.Columns {
+		typ := strings.ToLower(column.Type)
+		if typ == "id" || strings.HasSuffix(typ, "increments") {
+			serials = append(serials, column.Name)
+		}
+	}
+
+	delta, err := x.tableCopy(m, name, shadow, serials, option)
+	if err != nil {
+		x.TableDrop(shadow)
+		return err
+	}
+
+	// The delta pass runs once before locking the writes, and once again in the swap
+	err = delta(&m.DB)
+	if err != nil {
+		x.TableDrop(shadow)
+		return err
+	}
+
+	// The foreign keys of the other tables referencing the table
+	children, err := x.foreignsTo(name)
+	if err != nil {
+		x.TableDrop(shadow)
+		return err
+	}
+
+	err = x.TableDrop(backup)
+	if err != nil {
+		x.TableDrop(shadow)
+		return err
+	}
+
+	err = x.tableSwap(m, name, indexes, delta)
+	if err != nil {
+		x.TableDrop(shadow)
+		return err
+	}
+
+	err = x.tableSwapped(m, name, swapped, children)
+	if err != nil {
+		return fmt.Errorf("rebuild %s: %s, the original table is kept as %s", name, err.Error(), backup)
+	}
+
+	return x.TableDrop(backup)
+}
+
+// execer the database, the connection or the transaction the statements of the rebuilding run on
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	Rebind(query string) string
+}
+
+// tableSwap lock the writes of the table, run the delta pass again and swap the names of the table and the shadow table.
+// MySQL renames the locked tables in one statement, PostgreSQL and SQLite swap them in one transaction,
+// the table name is never missing and the rows written during the rebuilding are not lost
+func (x *Xun) tableSwap(m *capsule.Connection, name string, indexes []string, delta func(db execer) error) error {
+	ctx := context.Background()
+	prefix := x.Manager.Option.Prefix
+	table := quoteName(m.Config.Driver, prefix+name)
+	shadow := quoteName(m.Config.Driver, fmt.Sprintf("%s__shadow_%s", prefix, name))
+	backup := quoteName(m.Config.Driver, fmt.Sprintf("%s__backup_%s", prefix, name))
+
+	if m.Config.Driver == "mysql" {
+		conn, err := m.DB.Connx(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		// the aliases are locked for the subqueries of the delta pass
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("LOCK TABLES %s WRITE, %s AS s READ, %s WRITE, %s AS t READ", table, table, shadow, shadow))
+		if err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "UNLOCK TABLES")
+
+		err = delta(conn)
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s", table, backup, shadow, table))
+		return err
+	}
+
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return err
+	}
+
+	// SQLite locks the database at the first write of the delta pass
+	stmts := []string{}
+	if m.Config.Driver == "postgres" {
+		stmts = append(stmts, fmt.Sprintf("LOCK TABLE %s IN EXCLUSIVE MODE", table))
+	}
+
+	for _, stmt := range stmts {
+		_, err = tx.ExecContext(ctx, stmt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = delta(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	stmts = []string{
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", table, backup),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", shadow, table),
+	}
+	for _, stmt := range stmts {
+		_, err = tx.ExecContext(ctx, stmt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = x.indexesSwapped(tx, m.Config.Driver, name, indexes)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// indexesSwapped rename the indexes of the shadow table to the ones of the table.
+// the index names of PostgreSQL and SQLite are prefixed by the table name
+func (x *Xun) indexesSwapped(db execer, driver string, name string, indexes []string) error {
+	ctx := context.Background()
+	prefix := x.Manager.Option.Prefix
+	if driver == "postgres" {
+		indexes = append(indexes, "pkey")
+	}
+
+	for _, index := range indexes {
+		current := fmt.Sprintf("%s%s_%s", prefix, name, index)
+		shadow := fmt.Sprintf("%s__shadow_%s_%s", prefix, name, index)
+		switch driver {
+		case "postgres":
+			stmts := []string{
+				fmt.Sprintf(`ALTER INDEX IF EXISTS "%s" RENAME TO "%s__backup_%s_%s"`, current, prefix, name, index),
+				fmt.Sprintf(`ALTER INDEX IF EXISTS "%s" RENAME TO "%s"`, shadow, current),
+			}
+			for _, stmt := range stmts {
+				_, err := db.ExecContext(ctx, stmt)
+				if err != nil {
+					return err
+				}
+			}
+
+		case "sqlite3":
+			// SQLite does not support renaming the indexes
+			creates := []string{}
+			err := db.SelectContext(ctx, &creates, "SELECT sql FROM sqlite_master WHERE type='index' AND name=? AND sql IS NOT NULL", shadow)
+			if err != nil {
+				return err
+			}
+
+			if len(creates) == 0 {
+				continue
+			}
+
+			stmts := []string{
+				fmt.Sprintf(`DROP INDEX IF EXISTS "%s"`, current),
+				fmt.Sprintf(`DROP INDEX "%s"`, shadow),
+				strings.Replace(creates[0], shadow, current, 1),
+			}
+			for _, stmt := range stmts {
+				_, err := db.ExecContext(ctx, stmt)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// tableSwapped add the foreign keys of the rebuilt table and repoint the foreign keys of the other tables
+func (x *Xun) tableSwapped(m *capsule.Connection, name string, foreigns []types.Foreign, children map[string][]types.Foreign) error {
+	if m.Config.Driver == "mysql" && len(foreigns) > 0 {
+		backups, err := x.foreignsGet(fmt.Sprintf("__backup_%s", name))
+		if err != nil {
+			return err
+		}
+
+		names := []string{}
+		for _, foreign := range backups {
+			names = append(names, foreign.Name)
+		}
+
+		if len(names) > 0 {
+			err = x.ForeignDel(fmt.Sprintf("__backup_%s", name), names...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, foreign := range foreigns {
+		err := x.ForeignAdd(name, foreign)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The foreign keys follow the renamed table to the backup one, repoint them
+	for child, foreigns := range children {
+		for _, foreign := range foreigns {
+			err := x.ForeignDel(child, foreign.Name)
+			if err != nil {
+				return err
+			}
+
+			err = x.ForeignAdd(child, foreign)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// foreignsTo the foreign keys of the other tables referencing the given table, the table name => the foreign keys
+func (x *Xun) foreignsTo(name string) (map[string][]types.Foreign, error) {
+	tables, err := x.Tables()
+	if err != nil {
+		return nil, err
+	}
+
+	children := map[string][]types.Foreign{}
+	for _, table := range tables {
+		if table == name || strings.HasPrefix(table, "__shadow_") || strings.HasPrefix(table, "__backup_") {
+			continue
+		}
+
+		foreigns, err := x.foreignsGet(table)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, foreign := range foreigns {
+			if foreign.Table == name {
+				children[table] = append(children[table], foreign)
+			}
+		}
+	}
+	return children, nil
+}
+
+// tableCopy copy the rows of the same name columns from the table to the shadow table in chunks by the primary key,
+// returns the delta pass copying the rows deleted, updated or inserted during the copying again.
+// the __DEL__<name> column of the shadow table is copied from the <name> column
+func (x *Xun) tableCopy(m *capsule.Connection, name string, shadow string, serials []string, option types.ApplyOption) (func(db execer) error, error) {
+	sch := x.Manager.Schema()
+	source, err := sch.GetTable(name)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := sch.GetTable(shadow)
+	if err != nil {
+		return nil, err
+	}
+
+	id := func(name string) string {
+		return quoteName(m.Config.Driver, name)
+	}
+
+	sources := []string{}
+	targets := []string{}
+	for _, column := range target.GetColumnNames() {
+		if source.HasColumn(column) {
+			sources = append(sources, id(column))
+			targets = append(targets, id(column))
+			continue
+		}
+
+		origin := strings.TrimPrefix(column, "__DEL__")
+		if origin != column && source.HasColumn(origin) {
+			sources = append(sources, id(origin))
+			targets = append(targets, id(column))
+		}
+	}
+
+	if len(sources) == 0 {
+		return func(db execer) error { return nil }, nil
+	}
+
+	from := id(x.Manager.Option.Prefix + name)
+	to := id(x.Manager.Option.Prefix + shadow)
+
+	// The rows are paged by the primary key
+	keys := []string{}
+	descs := []string{}
+	if primary := source.Get().Primary; primary != nil {
+		for _, column := range primary.Columns {
+			if !target.HasColumn(column.Name) {
+				return nil, fmt.Errorf("the primary key %s of %s is not in the blueprint", column.Name, name)
+			}
+			keys = append(keys, id(column.Name))
+			descs = append(descs, id(column.Name)+" DESC")
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("the table %s has no primary key, it can not be rebuilt", name)
+	}
+
+	// The primary keys of the two tables are the same, the table aliases are s (source) and t (target)
+	match := func(left, right string) string {
+		conds := []string{}
+		for _, key := range keys {
+			conds = append(conds, fmt.Sprintf("%s.%s = %s.%s", left, key, right, key))
+		}
+		return strings.Join(conds, " AND ")
+	}
+
+	// The time of the database the copying started, the rows updated after it are copied again
+	var started interface{}
+	updated := source.HasColumn("updated_at") && target.HasColumn("updated_at")
+	if updated {
+		err = m.DB.QueryRowx("SELECT CURRENT_TIMESTAMP").Scan(&started)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	total := 0
+	err = m.DB.Get(&total, fmt.Sprintf("SELECT COUNT(*) FROM %s", from))
+	if err != nil {
+		return nil, err
+	}
+
+	copied := 0
+	var last []interface{}
+	for {
+		where := ""
+		if last != nil {
+			where = fmt.Sprintf(" WHERE (%s) > (%s)", strings.Join(keys, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", "))
+		}
+
+		sql := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s%s ORDER BY %s LIMIT %d",
+			to, strings.Join(targets, ", "),
+			strings.Join(sources, ", "), from, where,
+			strings.Join(keys, ", "), option.ChunkSize,
+		)
+
+		res, err := m.DB.Exec(m.DB.Rebind(sql), last...)
+		if err != nil {
+			return nil, err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if affected == 0 {
+			break
+		}
+
+		copied = copied + int(affected)
+		if copied > total {
+			total = copied
+		}
+
+		if option.Progress != nil {
+			option.Progress(copied, total)
+		} else {
+			log.Trace("[TableRebuild] %s %d/%d", name, copied, total)
+		}
+
+		if int(affected) < option.ChunkSize {
+			break
+		}
+
+		last, err = m.DB.QueryRowx(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s LIMIT 1", strings.Join(keys, ", "), to, strings.Join(descs, ", "))).SliceScan()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The delta pass: the rows deleted, updated and inserted during the copying
+	stmts := []string{fmt.Sprintf("DELETE FROM %s WHERE NOT EXISTS (SELECT 1 FROM %s s WHERE %s)", to, from, match("s", to))}
+	args := [][]interface{}{nil}
+	if updated {
+		stmts = append(stmts, fmt.Sprintf("DELETE FROM %s WHERE EXISTS (SELECT 1 FROM %s s WHERE %s AND s.%s >= ?)", to, from, match("s", to), id("updated_at")))
+		args = append(args, []interface{}{started})
+	}
+
+	columns := []string{}
+	for _, column := range sources {
+		columns = append(columns, "s."+column)
+	}
+	stmts = append(stmts, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s s WHERE NOT EXISTS (SELECT 1 FROM %s t WHERE %s)",
+		to, strings.Join(targets, ", "), strings.Join(columns, ", "), from, to, match("t", "s"),
+	))
+	args = append(args, nil)
+
+	// Reset the sequences of the auto-increment columns (PostgreSQL)
+	if m.Config.Driver == "postgres" {
+		for _, column := range serials {
+			stmts = append(stmts, fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX(%s), 0) + 1, false) FROM %s",
+				x.Manager.Option.Prefix+shadow, column, id(column), to,
+			))
+			args = append(args, nil)
+		}
+	}
+
+	return func(db execer) error {
+		for i, stmt := range stmts {
+			_, err := db.ExecContext(context.Background(), db.Rebind(stmt), args[i]...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// quoteName quote the name of the table or the column
+func quoteName(driver string, name string) string {
+	quote := `"`
+	if driver == "mysql" {
+		quote = "`"
+	}
+	return fmt.Sprintf("%s%s%s", quote, strings.ReplaceAll(name, quote, quote+quote), quote)
+}
@@ -125,7 +125,13 @@ func (x *Xun) TableGet(name string) (types.Blueprint, error) {
 	if err != nil {
 		return types.Blueprint{}, err
 	}
-	return TableToBlueprint(table), nil
+
+	blueprint := TableToBlueprint(table)
+	blueprint.Foreigns, err = x.foreignsGet(name)
+	if err != nil {
+		return types.Blueprint{}, err
+	}
+	return blueprint, nil
 }
 
 // TableExists check if a table exists
@@ -171,7 +177,19 @@ func (x *Xun) TableCreate(name string, blueprint types.Blueprint) error {
 		}
 	})
 
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Create foreign keys
+	for _, foreign := range blueprint.Foreigns {
+		err = x.ForeignAdd(name, foreign)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // TableDrop a table if exist
@@ -192,7 +210,7 @@ func (x *Xun) TableDiff(blueprint types.Blueprint, another types.Blueprint) (typ
 }
 
 // TableSave a table, if the table exists update, otherwise create
-func (x *Xun) TableSave(name string, blueprint types.Blueprint) error {
+func (x *Xun) TableSave(name string, blueprint types.Blueprint, option ...types.ApplyOption) error {
 	sch := x.Manager.Schema()
 	table, err := sch.GetTable(name)
 	if err != nil && !strings.Contains(err.Error(), "does not exists") {
@@ -205,12 +223,31 @@ func (x *Xun) TableSave(name string, blueprint types.Blueprint) error {
 	}
 
 	// Update
-	diff, err := types.Compare(TableToBlueprint(table), blueprint)
+	current := TableToBlueprint(table)
+	current.Foreigns, err = x.foreignsGet(name)
 	if err != nil {
 		return err
 	}
+	current.Foreigns = current.ManagedForeigns(blueprint)
+
+	diff, err := types.Compare(current, blueprint)
+	if err != nil {
+		return err
+	}
+
+	// SQLite does not support altering the columns, the table is rebuilt by default
+	if len(diff.Columns.Alt) > 0 && (len(option) == 0 || option[0].Strategy == "") {
+		if m, err := x.Manager.Primary(); err == nil && m.Config.Driver == "sqlite3" {
+			rebuild := types.ApplyOption{}
+			if len(option) > 0 {
+				rebuild = option[0]
+			}
+			rebuild.Strategy = "rebuild"
+			option = []types.ApplyOption{rebuild}
+		}
+	}
 
-	return diff.Apply(x, name)
+	return diff.Apply(x, name, option...)
 }
 
 // ColumnAdd add a column to the given table
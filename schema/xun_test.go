@@ -7,8 +7,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/yaoapp/gou/connector"
+	"github.com/yaoapp/gou/connector/database"
 	"github.com/yaoapp/gou/schema/types"
-	"github.com/yaoapp/gou/schema/xun"
 	"github.com/yaoapp/xun/capsule"
 )
 
@@ -161,6 +162,38 @@ func TestXunTableSave(t *testing.T) {
 	// }
 }
 
+func TestXunTableSaveAlt(t *testing.T) {
+	sch := newXunSchema(t)
+	defer sch.Close()
+
+	sch.TableDrop("schema_tests_alt")
+	defer sch.TableDrop("schema_tests_alt")
+
+	blueprint := types.Blueprint{
+		Columns: []types.Column{
+			{Name: "id", Type: "ID"},
+			{Name: "name", Type: "string", Length: 20},
+		},
+	}
+	err := sch.TableSave("schema_tests_alt", blueprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SQLite rebuilds the table without the strategy option
+	blueprint.Columns[1].Length = 40
+	err = sch.TableSave("schema_tests_alt", blueprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := sch.TableGet("schema_tests_alt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 40, table.ColumnsMapping()["name"].Length)
+}
+
 func TestXunColumnAddDelAlt(t *testing.T) {
 	sch := newXunSchema(t)
 	defer sch.Close()
@@ -281,6 +314,272 @@ func TestXunIndexAdd(t *testing.T) {
 	assert.Equal(t, []string{"mobile", "type"}, newIndex.Columns)
 }
 
+func TestXunForeignAddDel(t *testing.T) {
+	sch := newXunSchema(t)
+	defer sch.Close()
+
+	sch.TableDrop("schema_tests_fk_pet")
+	sch.TableDrop("schema_tests_fk_user")
+	defer sch.TableDrop("schema_tests_fk_user")
+	defer sch.TableDrop("schema_tests_fk_pet")
+
+	err := sch.TableCreate("schema_tests_fk_user", types.Blueprint{
+		Columns: []types.Column{{Name: "id", Type: "ID"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pet := types.Blueprint{
+		Columns: []types.Column{
+			{Name: "id", Type: "ID"},
+			{Name: "user_id", Type: "unsignedBigInteger", Nullable: true, Index: true},
+		},
+		Foreigns: []types.Foreign{
+			{Name: "schema_tests_fk_pet_user_id_foreign", Column: "user_id", Table: "schema_tests_fk_user", Key: "id"},
+		},
+		Option: types.BlueprintOption{Constraints: true},
+	}
+
+	err = sch.TableCreate("schema_tests_fk_pet", pet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := sch.TableGet("schema_tests_fk_pet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(table.Foreigns))
+	assert.Equal(t, "user_id", table.Foreigns[0].Column)
+	assert.Equal(t, "schema_tests_fk_user", table.Foreigns[0].Table)
+	assert.Equal(t, "id", table.Foreigns[0].Key)
+
+	// Del
+	err = sch.ForeignDel("schema_tests_fk_pet", "schema_tests_fk_pet_user_id_foreign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err = sch.TableGet("schema_tests_fk_pet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, len(table.Foreigns))
+	assert.True(t, table.ColumnsMapping()["user_id"].Index)
+
+	// Add
+	err = sch.ForeignAdd("schema_tests_fk_pet", types.Foreign{Column: "user_id", Table: "schema_tests_fk_user", Key: "id", OnDelete: "cascade"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err = sch.TableGet("schema_tests_fk_pet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(table.Foreigns))
+	assert.Equal(t, "schema_tests_fk_pet_user_id_foreign", table.Foreigns[0].Name)
+	assert.Equal(t, "CASCADE", table.Foreigns[0].OnDelete)
+
+	// Save (on delete changed)
+	diff, err := sch.TableDiff(table, pet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(diff.Foreigns.Del))
+	assert.Equal(t, 1, len(diff.Foreigns.Add))
+
+	// SQLite can not alter the columns, the table is rebuilt explicitly
+	options := []types.ApplyOption{}
+	if os.Getenv("GOU_TEST_DB_DRIVER") == "sqlite3" {
+		options = append(options, types.ApplyOption{Strategy: "rebuild"})
+	}
+	err = sch.TableSave("schema_tests_fk_pet", pet, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err = sch.TableGet("schema_tests_fk_pet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(table.Foreigns))
+	assert.Equal(t, "", types.ForeignAction(table.Foreigns[0].OnDelete))
+
+	// the constraints turned off, the foreign keys are not managed
+	pet.Foreigns = nil
+	pet.Option.Constraints = false
+	err = sch.TableSave("schema_tests_fk_pet", pet, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err = sch.TableGet("schema_tests_fk_pet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(table.Foreigns))
+
+	// the foreign keys made by hand are kept
+	err = sch.ForeignAdd("schema_tests_fk_pet", types.Foreign{Name: "schema_tests_fk_pet_owner", Column: "id", Table: "schema_tests_fk_user", Key: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pet.Option.Constraints = true
+	err = sch.TableSave("schema_tests_fk_pet", pet, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err = sch.TableGet("schema_tests_fk_pet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 1, len(table.Foreigns)) {
+		assert.Equal(t, "schema_tests_fk_pet_owner", table.Foreigns[0].Name)
+	}
+}
+
+func TestXunTableRebuild(t *testing.T) {
+	sch := newXunSchema(t)
+	defer sch.Close()
+
+	sch.TableDrop("schema_tests_rebuild_child")
+	sch.TableDrop("schema_tests_rebuild")
+	defer sch.TableDrop("schema_tests_rebuild")
+	defer sch.TableDrop("schema_tests_rebuild_child")
+
+	err := sch.TableCreate("schema_tests_rebuild", types.Blueprint{
+		Columns: []types.Column{
+			{Name: "id", Type: "ID"},
+			{Name: "code", Type: "string", Length: 20, Index: true},
+			{Name: "remark", Type: "string", Length: 80, Nullable: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the child table referencing the rebuilt table
+	err = sch.TableCreate("schema_tests_rebuild_child", types.Blueprint{
+		Columns: []types.Column{
+			{Name: "id", Type: "ID"},
+			{Name: "rebuild_id", Type: "unsignedBigInteger", Nullable: true, Index: true},
+		},
+		Foreigns: []types.Foreign{
+			{Name: "schema_tests_rebuild_child_rebuild_id_foreign", Column: "rebuild_id", Table: "schema_tests_rebuild", Key: "id"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := capsule.Add("rebuild", os.Getenv("GOU_TEST_DB_DRIVER"), os.Getenv("GOU_TEST_DSN"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	rows := []map[string]interface{}{}
+	for i := 1; i <= 5; i++ {
+		rows = append(rows, map[string]interface{}{"code": fmt.Sprintf("%d", i*10), "remark": "test"})
+	}
+	err = manager.Query().Table("schema_tests_rebuild").Insert(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := [][]int{}
+	err = sch.TableSave("schema_tests_rebuild", types.Blueprint{
+		Columns: []types.Column{
+			{Name: "id", Type: "ID"},
+			{Name: "code", Type: "integer", Index: true},
+			{Name: "level", Type: "integer", Nullable: true},
+		},
+	}, types.ApplyOption{Strategy: "rebuild", ChunkSize: 2, Progress: func(copied, total int) {
+		progress = append(progress, []int{copied, total})
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, [][]int{{2, 5}, {4, 5}, {5, 5}}, progress)
+
+	table, err := sch.TableGet("schema_tests_rebuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := table.ColumnsMapping()
+	assert.Equal(t, "integer", columns["code"].Type)
+	assert.True(t, columns["code"].Index)
+	assert.Contains(t, columns, "level")
+
+	has, err := sch.TableExists("__shadow_schema_tests_rebuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, has)
+
+	has, err = sch.TableExists("__backup_schema_tests_rebuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, has)
+
+	child, err := sch.TableGet("schema_tests_rebuild_child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(child.Foreigns))
+	assert.Equal(t, "schema_tests_rebuild", child.Foreigns[0].Table)
+
+	total, err := manager.Query().Table("schema_tests_rebuild").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(5), total)
+
+	row, err := manager.Query().Table("schema_tests_rebuild").OrderBy("id").First()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "10", fmt.Sprintf("%v", row.Get("code")))
+	assert.Equal(t, "test", fmt.Sprintf("%s", row.Get("__DEL__remark")))
+
+	// the indexes are renamed after the swap, the table can be rebuilt again
+	// the rows written during the copying are copied by the delta pass
+	err = sch.TableSave("schema_tests_rebuild", types.Blueprint{
+		Columns: []types.Column{
+			{Name: "id", Type: "ID"},
+			{Name: "code", Type: "bigInteger", Index: true},
+			{Name: "level", Type: "integer", Nullable: true},
+		},
+	}, types.ApplyOption{Strategy: "rebuild", Progress: func(copied, total int) {
+		_, err := manager.Query().Table("schema_tests_rebuild").Where("code", 10).Delete()
+		if err != nil {
+			t.Error(err)
+		}
+		err = manager.Query().Table("schema_tests_rebuild").Insert(map[string]interface{}{"code": 60})
+		if err != nil {
+			t.Error(err)
+		}
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err = sch.TableGet("schema_tests_rebuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, table.ColumnsMapping()["code"].Index)
+
+	codes := []string{}
+	records, err := manager.Query().Table("schema_tests_rebuild").OrderBy("id").Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range records {
+		codes = append(codes, fmt.Sprintf("%v", row.Get("code")))
+	}
+	assert.Equal(t, []string{"20", "30", "40", "50", "60"}, codes)
+}
+
 func newXunSchema(t *testing.T) types.Schema {
 	dsn := os.Getenv("GOU_TEST_DSN")
 	driver := os.Getenv("GOU_TEST_DB_DRIVER")
@@ -288,8 +587,9 @@ func newXunSchema(t *testing.T) types.Schema {
 	if err != nil {
 		t.Fatal(err)
 	}
-	sch := Use("tests")
-	err = sch.SetOption(xun.Option{Manager: manager})
+
+	connector.Connectors["schema-tests"] = &database.Xun{Manager: manager, Driver: driver}
+	sch, err := Select("schema-tests")
 	if err != nil {
 		t.Fatal(err)
 	}
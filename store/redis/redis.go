@@ -190,3 +190,12 @@ func (store *Store) GetSetMulti(keys []string, ttl time.Duration, getValue func(
 	}
 	return values
 }
+
+// Eval run the lua script atomically, the keys are prefixed
+func (store *Store) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	prefixed := []string{}
+	for _, key := range keys {
+		prefixed = append(prefixed, fmt.Sprintf("%s%s", store.Option.Prefix, key))
+	}
+	return store.rdb.Eval(context.Background(), script, prefixed, args...).Result()
+}
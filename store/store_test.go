@@ -26,6 +26,15 @@ func TestRedis(t *testing.T) {
 	redis := newStore(t, getConnector(t, "redis"))
 	testBasic(t, redis)
 	testMulti(t, redis)
+
+	res, err := redis.(interface {
+		Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+	}).Eval("return redis.call('INCRBY', KEYS[1], ARGV[1])", []string{"eval"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(2), res)
+	redis.Del("eval")
 }
 
 func TestMongo(t *testing.T) {